@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -15,42 +20,155 @@ import (
 type ApiServer struct {
 	ListenAddr string
 	Store      Storage
+	Hub        *Hub
+	Reactions  []string
+
+	autocomplete *autocompleteCache
+	trending     *trendingCache
 }
 
 func NewApiServer(addr string, store Storage) *ApiServer {
 	return &ApiServer{
 		ListenAddr: addr,
 		Store:      store,
+		Hub:        NewHub(),
+		Reactions:  loadReactions(),
+
+		autocomplete: newAutocompleteCache(),
+		trending:     newTrendingCache(),
+	}
+}
+
+// reservedUserNames are the top-level paths of the router, which would shadow
+// the profile routes of a user named after one of them
+var reservedUserNames = map[string]bool{
+	"comments":      true,
+	"conversations": true,
+	"events":        true,
+	"feed":          true,
+	"login":         true,
+	"logout":        true,
+	"me":            true,
+	"notifications": true,
+	"posts":         true,
+	"reactions":     true,
+	"search":        true,
+	"signup":        true,
+	"tags":          true,
+	"tokens":        true,
+	"trending":      true,
+	"users":         true,
+	"ws":            true,
+}
+
+func validUserName(userName string) bool {
+	return !reservedUserNames[strings.ToLower(userName)]
+}
+
+// shutdownTimeout is how long Run lets requests in flight finish once it's
+// told to stop
+const shutdownTimeout = 10 * time.Second
+
+// Run serves the API until ctx is done, then shuts the server down gracefully
+func (s *ApiServer) Run(ctx context.Context) {
+	server := &http.Server{Addr: s.ListenAddr, Handler: s.Router()}
+	// Shutdown doesn't wait for WebSockets, and would wait for event streams
+	// until it times out, so the hub ends both
+	server.RegisterOnShutdown(s.Hub.Close)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down gracefully: %v", err)
 	}
 }
 
-func (s *ApiServer) Run() {
+func (s *ApiServer) Router() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(middleware.RealIP)
+	r.Use(newRequestLogger())
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`{"message": "welcome"}`))
 	})
 	r.HandleFunc("/signup", makeHttpHandlerFunc(s.handleSignUp))
 	r.HandleFunc("/login", makeHttpHandlerFunc(s.handleLogin))
-	r.HandleFunc("/{username}", makeHttpHandlerFunc(s.handleUsersByName))
+	r.Post("/tokens/refresh", makeHttpHandlerFunc(s.handleRefreshToken))
+	r.Post("/logout", verifyUser(makeHttpHandlerFunc(s.handleLogout), s.Store))
+	r.Get("/me/sessions", verifyUser(makeHttpHandlerFunc(s.handleGetSessions), s.Store))
+	r.Delete("/me/sessions/{id}", verifyUser(makeHttpHandlerFunc(s.handleDeleteSession), s.Store))
+	r.Get("/me/follow-requests", verifyUser(makeHttpHandlerFunc(s.handleGetFollowRequests), s.Store))
+	r.Post("/me/follow-requests/{username}/approve", verifyUser(makeHttpHandlerFunc(s.handleApproveFollowRequest), s.Store))
+	r.Post("/me/follow-requests/{username}/deny", verifyUser(makeHttpHandlerFunc(s.handleDenyFollowRequest), s.Store))
+	r.Get("/me/mentions", verifyUser(makeHttpHandlerFunc(s.handleGetMentions), s.Store))
+	r.Get("/me/suggestions", verifyUser(makeHttpHandlerFunc(s.handleGetSuggestions), s.Store))
+	r.Get("/me/bookmarks", verifyUser(makeHttpHandlerFunc(s.handleGetBookmarks), s.Store))
+	r.Get("/me/collections", verifyUser(makeHttpHandlerFunc(s.handleGetCollections), s.Store))
+	r.Post("/me/collections", verifyUser(makeHttpHandlerFunc(s.handleCreateCollection), s.Store))
+	r.Patch("/me/collections/{id}", verifyUser(makeHttpHandlerFunc(s.handleRenameCollection), s.Store))
+	r.Delete("/me/collections/{id}", verifyUser(makeHttpHandlerFunc(s.handleDeleteCollection), s.Store))
+	r.Get("/feed", verifyUser(makeHttpHandlerFunc(s.handleGetFeed), s.Store))
+	r.Get("/tags/{tag}", identifyUser(makeHttpHandlerFunc(s.handleGetTagPosts), s.Store))
+	r.Get("/trending", identifyUser(makeHttpHandlerFunc(s.handleGetTrending), s.Store))
+	r.Get("/search", identifyUser(makeHttpHandlerFunc(s.handleSearch), s.Store))
+	r.Get("/users/autocomplete", verifyUser(makeHttpHandlerFunc(s.handleAutocompleteUsers), s.Store))
+	r.Get("/ws", verifyUser(s.handleWebSocket, s.Store))
+	r.Get("/events", verifyUser(s.handleEvents, s.Store))
+	r.Get("/notifications", verifyUser(makeHttpHandlerFunc(s.handleGetNotifications), s.Store))
+	r.Post("/notifications/read", verifyUser(makeHttpHandlerFunc(s.handleMarkNotificationsRead), s.Store))
+	r.Post("/conversations", verifyUser(makeHttpHandlerFunc(s.handleCreateConversation), s.Store))
+	r.Get("/conversations", verifyUser(makeHttpHandlerFunc(s.handleGetConversations), s.Store))
+	r.Post("/conversations/groups", verifyUser(makeHttpHandlerFunc(s.handleCreateGroup), s.Store))
+	r.Get("/conversations/{id}", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleGetConversation), s.Store, "conversation"))
+	r.Patch("/conversations/{id}", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleUpdateGroup), s.Store, "groupAdmin"))
+	r.HandleFunc("/conversations/{id}/messages", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleConversationMessages), s.Store, "conversation"))
+	r.Post("/conversations/{id}/members", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleAddMembers), s.Store, "groupAdmin"))
+	r.Put("/conversations/{id}/members/{username}", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleUpdateMember), s.Store, "groupAdmin"))
+	r.Delete("/conversations/{id}/members/{username}", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleRemoveMember), s.Store, "groupAdmin"))
+	r.Post("/conversations/{id}/leave", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleLeaveGroup), s.Store, "conversation"))
+	r.Post("/conversations/{id}/read", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleMarkConversationRead), s.Store, "conversation"))
+	r.Post("/conversations/{id}/typing", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleTyping), s.Store, "conversation"))
+	r.Get("/{username}", identifyUser(makeHttpHandlerFunc(s.handleUsersByName), s.Store))
+	r.Put("/{username}", authoriseCurrentUser(makeHttpHandlerFunc(s.handleUsersByName), s.Store))
+	r.Patch("/{username}", authoriseCurrentUser(makeHttpHandlerFunc(s.handleUsersByName), s.Store))
+	r.Delete("/{username}", authoriseCurrentUser(makeHttpHandlerFunc(s.handleUsersByName), s.Store))
 	r.Get("/{username}/posts", verifyUser(makeHttpHandlerFunc(s.handleUserPosts), s.Store))
 	r.Post("/{username}/posts", authoriseCurrentUser(makeHttpHandlerFunc(s.handleUserPosts), s.Store))
-	r.HandleFunc("/{username}/followers", makeHttpHandlerFunc(s.handleGetFollowers))
-	r.HandleFunc("/{username}/following", makeHttpHandlerFunc(s.handleGetFollowing))
+	r.HandleFunc("/{username}/followers", identifyUser(makeHttpHandlerFunc(s.handleGetFollowers), s.Store))
+	r.HandleFunc("/{username}/following", identifyUser(makeHttpHandlerFunc(s.handleGetFollowing), s.Store))
 	r.HandleFunc("/{username}/follow", authoriseCurrentUser(makeHttpHandlerFunc(s.handleFollow), s.Store))
 	r.HandleFunc("/{username}/unfollow", authoriseCurrentUser(makeHttpHandlerFunc(s.handleUnfollow), s.Store))
+	r.Post("/{username}/block", verifyUser(makeHttpHandlerFunc(s.handleBlock), s.Store))
+	r.Delete("/{username}/block", verifyUser(makeHttpHandlerFunc(s.handleUnblock), s.Store))
+	r.Post("/{username}/mute", verifyUser(makeHttpHandlerFunc(s.handleMute), s.Store))
+	r.Delete("/{username}/mute", verifyUser(makeHttpHandlerFunc(s.handleUnmute), s.Store))
 	r.HandleFunc("/posts/{id}", resourceBasedJWTauth(makeHttpHandlerFunc(s.handlePostsByID), s.Store, "post"))
+	r.Post("/posts/{id}/repost", verifyUser(makeHttpHandlerFunc(s.handleRepost), s.Store))
+	r.Delete("/posts/{id}/repost", verifyUser(makeHttpHandlerFunc(s.handleUndoRepost), s.Store))
+	r.Post("/posts/{id}/bookmark", verifyUser(makeHttpHandlerFunc(s.handleBookmark), s.Store))
+	r.Delete("/posts/{id}/bookmark", verifyUser(makeHttpHandlerFunc(s.handleDeleteBookmark), s.Store))
+	r.Post("/posts/{id}/quote", verifyUser(makeHttpHandlerFunc(s.handleQuotePost), s.Store))
 	r.HandleFunc("/posts/{id}/like", verifyUser(makeHttpHandlerFunc(s.handleLikePost), s.Store))
 	r.HandleFunc("/posts/{id}/unlike", verifyUser(makeHttpHandlerFunc(s.handleUnlikePost), s.Store))
+	r.Get("/reactions", makeHttpHandlerFunc(s.handleGetReactions))
+	r.HandleFunc("/posts/{id}/reactions", verifyUser(makeHttpHandlerFunc(s.handlePostReactions), s.Store))
+	r.HandleFunc("/comments/{id}/reactions", verifyUser(makeHttpHandlerFunc(s.handleCommentReactions), s.Store))
 	r.HandleFunc("/posts/{id}/likes", verifyUser(makeHttpHandlerFunc(s.handleGetPostlikes), s.Store))
 	r.HandleFunc("/posts/{id}/comments", verifyUser(makeHttpHandlerFunc(s.handlePostComments), s.Store))
 	r.HandleFunc("/comments/{id}", resourceBasedJWTauth(makeHttpHandlerFunc(s.handleCommentsByID), s.Store, "comment"))
+	r.HandleFunc("/comments/{id}/replies", verifyUser(makeHttpHandlerFunc(s.handleCommentReplies), s.Store))
 	r.HandleFunc("/comments/{id}/like", verifyUser(makeHttpHandlerFunc(s.handleLikeComment), s.Store))
 	r.HandleFunc("/comments/{id}/unlike", verifyUser(makeHttpHandlerFunc(s.handleUnlikeComment), s.Store))
-	err := http.ListenAndServe(s.ListenAddr, r)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return r
 }
 
 func (s *ApiServer) handleSignUp(w http.ResponseWriter, r *http.Request) error {
@@ -64,6 +182,13 @@ func (s *ApiServer) handleSignUp(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	if !validUserName(req.UserName) {
+		return fmt.Errorf("Username %s is reserved", req.UserName)
+	}
+	if req.AllowMessagesFrom != "" && !validAllowMessagesFrom(req.AllowMessagesFrom) {
+		return fmt.Errorf("Invalid allowMessagesFrom: %v", req.AllowMessagesFrom)
+	}
+
 	user, err := NewUser(req)
 	if err != nil {
 		return err
@@ -95,19 +220,142 @@ func (s *ApiServer) handleLogin(w http.ResponseWriter, r *http.Request) error {
 		return WriteJson(w, http.StatusBadRequest, fmt.Errorf("access denied"))
 	}
 
-	token, err := CreateAccessToken(user)
+	session, refreshToken, err := NewSession(user.ID)
+	if err != nil {
+		return err
+	}
+	session.Device = req.Device
+	session.IP = getClientIP(r)
+	session.UserAgent = r.UserAgent()
+
+	if err := s.Store.CreateSession(session); err != nil {
+		return err
+	}
+
+	token, err := CreateAccessToken(user, session.ID)
+	if err != nil {
+		return err
+	}
+
+	res := &LoginResponse{
+		UserName:     user.UserName,
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+
+	return WriteJson(w, http.StatusOK, res)
+}
+
+func (s *ApiServer) handleRefreshToken(w http.ResponseWriter, r *http.Request) error {
+	req := new(RefreshTokenRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return err
+	}
+
+	oldRefreshToken := hashRefreshToken(req.RefreshToken)
+	session, err := s.Store.GetSessionByRefreshToken(oldRefreshToken)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.IsBlocked {
+		permissionDenied(w)
+		return nil
+	}
+	// refresh tokens are rotated so each one can only be used once. Using the
+	// one the session was rotated from again means it was replayed, possibly
+	// by someone who stole it, so the session is revoked.
+	if session.RefreshToken != oldRefreshToken {
+		if err := s.Store.DeleteSession(session.ID); err != nil {
+			return err
+		}
+		permissionDenied(w)
+		return nil
+	}
+	if time.Now().After(session.ExpirationTime) {
+		return WriteJson(w, http.StatusUnauthorized, ApiError{Error: "refresh token is expired, please log in again"})
+	}
+
+	user, err := s.Store.GetUserByID(session.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		permissionDenied(w)
+		return nil
+	}
+
+	// rotation only succeeds while the session still has the token being
+	// used, so when it doesn't another request used it in the meantime, and
+	// the session is revoked too
+	refreshToken, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().UTC().Add(refreshTokenTTL)
+	rotated, err := s.Store.RotateSession(session.ID, oldRefreshToken, hashRefreshToken(refreshToken), expiresAt)
+	if err != nil {
+		return err
+	}
+	if !rotated {
+		if err := s.Store.DeleteSession(session.ID); err != nil {
+			return err
+		}
+		permissionDenied(w)
+		return nil
+	}
+
+	token, err := CreateAccessToken(user, session.ID)
 	if err != nil {
 		return err
 	}
 
 	res := &LoginResponse{
-		UserName: user.UserName,
-		Token:    token,
+		UserName:     user.UserName,
+		Token:        token,
+		RefreshToken: refreshToken,
 	}
 
 	return WriteJson(w, http.StatusOK, res)
 }
 
+// HANDLERS FOR SESSIONS
+func (s *ApiServer) handleLogout(w http.ResponseWriter, r *http.Request) error {
+	if err := s.Store.DeleteSession(getAuthSessionID(r)); err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, "Logged out successfully")
+}
+
+func (s *ApiServer) handleGetSessions(w http.ResponseWriter, r *http.Request) error {
+	sessions, err := s.Store.GetUserSessions(getAuthUserID(r))
+	if err != nil {
+		return err
+	}
+
+	current := getAuthSessionID(r)
+	for _, session := range sessions {
+		session.Current = session.ID == current
+	}
+	return WriteJson(w, http.StatusOK, sessions)
+}
+
+func (s *ApiServer) handleDeleteSession(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	session, err := s.Store.GetSession(id)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != getAuthUserID(r) {
+		return WriteJson(w, http.StatusNotFound, ApiError{Error: fmt.Sprintf("session %s not found", id)})
+	}
+
+	if err := s.Store.DeleteSession(id); err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Revoked session %s successfully", id))
+}
+
 // HANDLERS FOR USERS
 func (s *ApiServer) handleUsersByName(w http.ResponseWriter, r *http.Request) error {
 	if r.Method == http.MethodGet {
@@ -132,20 +380,31 @@ func (s *ApiServer) handleUpdateUser(w http.ResponseWriter, r *http.Request) err
 		return err
 	}
 
-	passwordHash, err := "", errors.New("")
-	if req.Password != "" {
-		passwordHash, err = generateHash(req.Password)
+	if !validUserName(req.UserName) {
+		return fmt.Errorf("Username %s is reserved", req.UserName)
 	}
-	if err != nil {
-		return nil
+	if req.AllowMessagesFrom != "" && !validAllowMessagesFrom(req.AllowMessagesFrom) {
+		return fmt.Errorf("Invalid allowMessagesFrom: %v", req.AllowMessagesFrom)
+	}
+
+	passwordHash := ""
+	if req.Password != "" {
+		hash, err := generateHash(req.Password)
+		if err != nil {
+			return err
+		}
+		passwordHash = hash
 	}
 
 	finalReq := &UpdateUserRequest{
-		UserName:     req.UserName,
-		Name:         req.Name,
-		Email:        req.Email,
-		Bio:          req.Bio,
-		PasswordHash: string(passwordHash),
+		UserName:          req.UserName,
+		Name:              req.Name,
+		Email:             req.Email,
+		Bio:               req.Bio,
+		PasswordHash:      string(passwordHash),
+		AllowMessagesFrom: req.AllowMessagesFrom,
+		HideReadReceipts:  req.HideReadReceipts,
+		IsPrivate:         req.IsPrivate,
 	}
 
 	if err := s.Store.UpdateUser(username, finalReq); err != nil {
@@ -167,7 +426,7 @@ func (s *ApiServer) handleDeleteUser(w http.ResponseWriter, r *http.Request) err
 func (s *ApiServer) handleGetUserProfile(w http.ResponseWriter, r *http.Request) error {
 	username := getUserName(r)
 
-	user, err := s.Store.GetUserProfile(username)
+	user, err := s.Store.GetUserProfile(username, getAuthUserID(r))
 	if err != nil {
 		return WriteJson(w, http.StatusBadRequest, fmt.Errorf(err.Error()))
 	}
@@ -180,8 +439,17 @@ func (s *ApiServer) handleGetFollowers(w http.ResponseWriter, r *http.Request) e
 		return fmt.Errorf("Unexpected method: %v", r.Method)
 	}
 
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
 	username := getUserName(r)
-	followers, err := s.Store.GetFollowers(username)
+	if ok, err := s.canViewUser(w, r, username); err != nil || !ok {
+		return err
+	}
+
+	followers, err := s.Store.GetFollowers(username, page)
 	if err != nil {
 		return fmt.Errorf("Couldn't get followers")
 	}
@@ -194,8 +462,17 @@ func (s *ApiServer) handleGetFollowing(w http.ResponseWriter, r *http.Request) e
 		return fmt.Errorf("Unexpected method: %v", r.Method)
 	}
 
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
 	username := getUserName(r)
-	following, err := s.Store.GetFollowing(username)
+	if ok, err := s.canViewUser(w, r, username); err != nil || !ok {
+		return err
+	}
+
+	following, err := s.Store.GetFollowing(username, page)
 	if err != nil {
 		return fmt.Errorf("Couldn't get following")
 	}
@@ -211,11 +488,25 @@ func (s *ApiServer) handleFollow(w http.ResponseWriter, r *http.Request) error {
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		return err
 	}
+	// the follower is always the authenticated user
+	req.UserID = getAuthUserID(r)
+
+	account, err := s.Store.GetUserByID(req.FollowingID)
+	if err != nil || account == nil {
+		return WriteJson(w, http.StatusNotFound, ApiError{Error: "user not found"})
+	}
+	if account.IsPrivate {
+		return s.requestFollow(w, req)
+	}
 
-	err := s.Store.CreateFollow(req)
+	err = s.Store.CreateFollow(req)
+	if err == errBlocked {
+		return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to follow user with id: %v", req.FollowingID)
 	}
+	s.publishFollow(req)
 
 	return WriteJson(w, http.StatusOK, fmt.Sprintf("Followed user with id: %v", req.FollowingID))
 }
@@ -228,15 +519,225 @@ func (s *ApiServer) handleUnfollow(w http.ResponseWriter, r *http.Request) error
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		return err
 	}
+	// the follower is always the authenticated user
+	req.UserID = getAuthUserID(r)
 
 	err := s.Store.DeleteFollow(req)
 	if err != nil {
 		return fmt.Errorf("Failed to unfollow user with id: %v", req.FollowingID)
 	}
+	// unfollowing a private account also cancels a pending request, there
+	// usually isn't one
+	s.Store.DeleteFollowRequest(req.FollowingID, req.UserID)
 
 	return WriteJson(w, http.StatusOK, fmt.Sprintf("Unfollowed user with id: %v", req.FollowingID))
 }
 
+// requestFollow asks a private account to approve req.UserID following it
+func (s *ApiServer) requestFollow(w http.ResponseWriter, req *FollowRequest) error {
+	err := s.Store.CreateFollowRequest(req)
+	if err == errBlocked {
+		return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to request to follow user with id: %v", req.FollowingID)
+	}
+	s.publishUnreadCount(req.FollowingID)
+
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Requested to follow user with id: %v", req.FollowingID))
+}
+
+// HANDLERS FOR FOLLOW SUGGESTIONS
+func (s *ApiServer) handleGetSuggestions(w http.ResponseWriter, r *http.Request) error {
+	limit, err := getPageLimit(r)
+	if err != nil {
+		return err
+	}
+
+	suggestions, err := s.Store.GetSuggestions(getAuthUserID(r), limit)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, suggestions)
+}
+
+// HANDLERS FOR FOLLOW REQUESTS
+func (s *ApiServer) handleGetFollowRequests(w http.ResponseWriter, r *http.Request) error {
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	requests, err := s.Store.GetFollowRequests(getAuthUserID(r), page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, requests)
+}
+
+func (s *ApiServer) handleApproveFollowRequest(w http.ResponseWriter, r *http.Request) error {
+	requester, err := s.Store.GetUserByName(getUserName(r))
+	if err != nil || requester == nil {
+		return WriteJson(w, http.StatusNotFound, ApiError{Error: "user not found"})
+	}
+
+	userID := getAuthUserID(r)
+	if err := s.Store.ApproveFollowRequest(userID, requester.ID); err != nil {
+		return err
+	}
+	s.publishUnreadCount(requester.ID)
+
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Approved follow request from %s", requester.UserName))
+}
+
+func (s *ApiServer) handleDenyFollowRequest(w http.ResponseWriter, r *http.Request) error {
+	requester, err := s.Store.GetUserByName(getUserName(r))
+	if err != nil || requester == nil {
+		return WriteJson(w, http.StatusNotFound, ApiError{Error: "user not found"})
+	}
+
+	if err := s.Store.DeleteFollowRequest(getAuthUserID(r), requester.ID); err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Denied follow request from %s", requester.UserName))
+}
+
+// HANDLERS FOR BLOCKS AND MUTES
+func (s *ApiServer) handleBlock(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.getOtherUser(w, r)
+	if err != nil || user == nil {
+		return err
+	}
+
+	if err := s.Store.BlockUser(getAuthUserID(r), user.ID); err != nil {
+		return fmt.Errorf("Failed to block user %s", user.UserName)
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Blocked user %s", user.UserName))
+}
+
+func (s *ApiServer) handleUnblock(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.getOtherUser(w, r)
+	if err != nil || user == nil {
+		return err
+	}
+
+	if err := s.Store.UnblockUser(getAuthUserID(r), user.ID); err != nil {
+		return fmt.Errorf("Failed to unblock user %s", user.UserName)
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Unblocked user %s", user.UserName))
+}
+
+func (s *ApiServer) handleMute(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.getOtherUser(w, r)
+	if err != nil || user == nil {
+		return err
+	}
+
+	if err := s.Store.MuteUser(getAuthUserID(r), user.ID); err != nil {
+		return fmt.Errorf("Failed to mute user %s", user.UserName)
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Muted user %s", user.UserName))
+}
+
+func (s *ApiServer) handleUnmute(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.getOtherUser(w, r)
+	if err != nil || user == nil {
+		return err
+	}
+
+	if err := s.Store.UnmuteUser(getAuthUserID(r), user.ID); err != nil {
+		return fmt.Errorf("Failed to unmute user %s", user.UserName)
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Unmuted user %s", user.UserName))
+}
+
+// canViewUser checks that the authenticated user, if any, may see the posts
+// and follows of username, replying with an error and returning false when
+// they can't. Users who blocked each other can't see each other at all, and
+// private accounts are only visible to their approved followers.
+func (s *ApiServer) canViewUser(w http.ResponseWriter, r *http.Request, username string) (bool, error) {
+	user, err := s.Store.GetUserByName(username)
+	if err != nil || user == nil {
+		return false, WriteJson(w, http.StatusNotFound, ApiError{Error: "user not found"})
+	}
+
+	viewerID := getAuthUserID(r)
+	if viewerID == user.ID {
+		return true, nil
+	}
+
+	blocked, err := s.Store.IsBlocked(viewerID, user.ID)
+	if err != nil {
+		return false, err
+	}
+	if blocked {
+		return false, WriteJson(w, http.StatusNotFound, ApiError{Error: "user not found"})
+	}
+
+	if !user.IsPrivate {
+		return true, nil
+	}
+	following, err := s.Store.IsFollowing(viewerID, user.ID)
+	if err != nil {
+		return false, err
+	}
+	if !following {
+		return false, WriteJson(w, http.StatusForbidden, ApiError{Error: "this account is private"})
+	}
+	return true, nil
+}
+
+// getVisiblePost returns the post with the given id, replying with an error
+// and returning nil when it doesn't exist or the authenticated user can't see
+// its author, as checked by canViewUser
+func (s *ApiServer) getVisiblePost(w http.ResponseWriter, r *http.Request, id int64) (*Post, error) {
+	post, err := s.Store.GetPost(id)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, WriteJson(w, http.StatusNotFound, ApiError{Error: "post not found"})
+	}
+	author, err := s.Store.GetUserByID(post.UserID)
+	if err != nil || author == nil {
+		return nil, WriteJson(w, http.StatusNotFound, ApiError{Error: "post not found"})
+	}
+	if ok, err := s.canViewUser(w, r, author.UserName); err != nil || !ok {
+		return nil, err
+	}
+	return post, nil
+}
+
+// getVisibleComment returns the comment with the given id, replying with an
+// error and returning nil when it doesn't exist or the authenticated user
+// can't see the post it's on
+func (s *ApiServer) getVisibleComment(w http.ResponseWriter, r *http.Request, id int64) (*Comment, error) {
+	comment, err := s.Store.GetComment(id)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil {
+		return nil, WriteJson(w, http.StatusNotFound, ApiError{Error: "comment not found"})
+	}
+	if post, err := s.getVisiblePost(w, r, comment.PostID); err != nil || post == nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// getOtherUser returns the user named in the path, replying with an error
+// and returning nil when they don't exist or are the authenticated user
+func (s *ApiServer) getOtherUser(w http.ResponseWriter, r *http.Request) (*User, error) {
+	user, err := s.Store.GetUserByName(getUserName(r))
+	if err != nil || user == nil {
+		return nil, WriteJson(w, http.StatusNotFound, ApiError{Error: "user not found"})
+	}
+	if user.ID == getAuthUserID(r) {
+		return nil, fmt.Errorf("Can't block or mute yourself")
+	}
+	return user, nil
+}
+
 // HANDLERS FOR USER POSTS
 func (s *ApiServer) handleUserPosts(w http.ResponseWriter, r *http.Request) error {
 	if r.Method == http.MethodPost {
@@ -250,14 +751,36 @@ func (s *ApiServer) handleUserPosts(w http.ResponseWriter, r *http.Request) erro
 }
 
 func (s *ApiServer) handleGetUserPosts(w http.ResponseWriter, r *http.Request) error {
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
 	username := getUserName(r)
-	posts, err := s.Store.GetUserPosts(username)
+	if ok, err := s.canViewUser(w, r, username); err != nil || !ok {
+		return err
+	}
+
+	posts, err := s.Store.GetUserPosts(username, page)
 	if err != nil {
 		return err
 	}
 	return WriteJson(w, http.StatusOK, posts)
 }
 
+func (s *ApiServer) handleGetFeed(w http.ResponseWriter, r *http.Request) error {
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	feed, err := s.Store.GetFeed(getAuthUserID(r), page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, feed)
+}
+
 // HANDLERS FOR POSTS AS A RESOURCE
 func (s *ApiServer) handlePostsByID(w http.ResponseWriter, r *http.Request) error {
 	if r.Method == http.MethodGet {
@@ -280,11 +803,17 @@ func (s *ApiServer) handleCreatePost(w http.ResponseWriter, r *http.Request) err
 		return err
 	}
 
-	if err := s.Store.CreatePost(req); err != nil {
+	// the author is always the authenticated user
+	req.UserID = getAuthUserID(r)
+
+	post, err := s.Store.CreatePost(req)
+	if err != nil {
 		return err
 	}
+	s.publishPost(post)
+	s.publishMentions(post.UserID, post.Mentions)
 
-	return WriteJson(w, http.StatusOK, req)
+	return WriteJson(w, http.StatusCreated, post)
 }
 
 func (s *ApiServer) handleGetPostByID(w http.ResponseWriter, r *http.Request) error {
@@ -311,6 +840,14 @@ func (s *ApiServer) handleUpdatePostByID(w http.ResponseWriter, r *http.Request)
 		return err
 	}
 
+	post, err := s.Store.GetPost(id)
+	if err != nil {
+		return err
+	}
+	if post != nil && post.RepostOfID != nil {
+		return fmt.Errorf("Reposts can't be edited")
+	}
+
 	if err := s.Store.UpdatePost(id, req); err != nil {
 		return err
 	}
@@ -330,212 +867,1275 @@ func (s *ApiServer) handleDeletePostByID(w http.ResponseWriter, r *http.Request)
 	return WriteJson(w, http.StatusOK, fmt.Errorf(deletedMsg))
 }
 
-// HANDLERS FOR POST LIKES
-func (s *ApiServer) handleGetPostlikes(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != http.MethodGet {
-		return fmt.Errorf("Unexpected method: %s", r.Method)
+// HANDLERS FOR REPOSTS AND QUOTES
+func (s *ApiServer) handleRepost(w http.ResponseWriter, r *http.Request) error {
+	original, err := s.getShareablePost(w, r)
+	if err != nil || original == nil {
+		return err
 	}
-	id, err := getID(r)
-	if err != nil {
+
+	req := &CreatePostRequest{UserID: getAuthUserID(r), RepostOfID: &original.ID}
+	return s.sharePost(w, req)
+}
+
+func (s *ApiServer) handleQuotePost(w http.ResponseWriter, r *http.Request) error {
+	req := new(CreatePostRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		return err
 	}
+	if req.Content == "" {
+		return fmt.Errorf("A quote needs content")
+	}
 
-	likedby, err := s.Store.GetPostLikes(id)
-	if err != nil {
+	original, err := s.getShareablePost(w, r)
+	if err != nil || original == nil {
 		return err
 	}
 
-	return WriteJson(w, http.StatusOK, likedby)
+	req.UserID = getAuthUserID(r)
+	req.QuoteOfID = &original.ID
+	return s.sharePost(w, req)
 }
 
-func (s *ApiServer) handleLikePost(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != http.MethodPost {
-		return fmt.Errorf("Unexpected method %s", r.Method)
-	}
+func (s *ApiServer) handleUndoRepost(w http.ResponseWriter, r *http.Request) error {
 	postID, err := getID(r)
 	if err != nil {
 		return err
 	}
 
-	userID, err := getUserIDFromParams(r)
-	if err != nil {
+	if err := s.Store.DeleteRepost(getAuthUserID(r), postID); err != nil {
 		return err
 	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Undid repost of post: %v successfully", postID))
+}
 
-	if err := s.Store.LikePost(userID, postID); err != nil {
-		return fmt.Errorf("Failed to like post")
+// getShareablePost returns the post with the id in the path, or the post it
+// reposts, so that reposting a repost shares the original. Posts of private
+// accounts can only be shared by their author.
+func (s *ApiServer) getShareablePost(w http.ResponseWriter, r *http.Request) (*Post, error) {
+	id, err := getID(r)
+	if err != nil {
+		return nil, err
 	}
-	return WriteJson(w, http.StatusOK, fmt.Sprintf("Liked post: %v successfully", postID))
-}
+
+	post, err := s.Store.GetPost(id)
+	if err != nil {
+		return nil, err
+	}
+	if post != nil && post.RepostOfID != nil {
+		post = post.Original
+	}
+	if post == nil {
+		return nil, WriteJson(w, http.StatusNotFound, ApiError{Error: "post not found"})
+	}
+
+	if post.UserID == getAuthUserID(r) {
+		return post, nil
+	}
+	author, err := s.Store.GetUserByID(post.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if author != nil && author.IsPrivate {
+		return nil, WriteJson(w, http.StatusForbidden, ApiError{Error: "posts of private accounts can't be shared"})
+	}
+	return post, nil
+}
+
+func (s *ApiServer) sharePost(w http.ResponseWriter, req *CreatePostRequest) error {
+	post, err := s.Store.CreatePost(req)
+	if err == errBlocked {
+		return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	s.publishPost(post)
+	s.publishShare(post)
+	s.publishMentions(post.UserID, post.Mentions)
+
+	return WriteJson(w, http.StatusOK, post)
+}
+
+// HANDLERS FOR BOOKMARKS
+func (s *ApiServer) handleBookmark(w http.ResponseWriter, r *http.Request) error {
+	postID, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	req := new(BookmarkRequest)
+	if err := decodeOptionalJson(r, req); err != nil {
+		return err
+	}
+
+	if post, err := s.getVisiblePost(w, r, postID); err != nil || post == nil {
+		return err
+	}
+
+	err = s.Store.BookmarkPost(getAuthUserID(r), postID, req.CollectionID)
+	if err == errBlocked {
+		return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Bookmarked post: %v successfully", postID))
+}
+
+func (s *ApiServer) handleDeleteBookmark(w http.ResponseWriter, r *http.Request) error {
+	postID, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.DeleteBookmark(getAuthUserID(r), postID); err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Removed bookmark of post: %v successfully", postID))
+}
+
+func (s *ApiServer) handleGetBookmarks(w http.ResponseWriter, r *http.Request) error {
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	var collectionID *int64
+	if collectionStr := r.URL.Query().Get("collection"); collectionStr != "" {
+		id, err := strconv.ParseInt(collectionStr, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid collection: %v", collectionStr)
+		}
+		collectionID = &id
+	}
+
+	bookmarks, err := s.Store.GetBookmarks(getAuthUserID(r), collectionID, page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, bookmarks)
+}
+
+// HANDLERS FOR BOOKMARK COLLECTIONS
+func (s *ApiServer) handleGetCollections(w http.ResponseWriter, r *http.Request) error {
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	collections, err := s.Store.GetCollections(getAuthUserID(r), page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, collections)
+}
+
+func (s *ApiServer) handleCreateCollection(w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	req := new(CollectionRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return err
+	}
+	name, err := validateCollectionName(req.Name)
+	if err != nil {
+		return err
+	}
+
+	collection, err := s.Store.CreateCollection(getAuthUserID(r), name)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, collection)
+}
+
+func (s *ApiServer) handleRenameCollection(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	req := new(CollectionRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return err
+	}
+	name, err := validateCollectionName(req.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.RenameCollection(getAuthUserID(r), id, name); err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Renamed collection: %v to %s successfully", id, name))
+}
+
+func (s *ApiServer) handleDeleteCollection(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.DeleteCollection(getAuthUserID(r), id); err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Collection with id: %d deleted successfully", id))
+}
+
+// HANDLERS FOR HASHTAGS
+func (s *ApiServer) handleGetTagPosts(w http.ResponseWriter, r *http.Request) error {
+	tag, err := getHashtag(chi.URLParam(r, "tag"))
+	if err != nil {
+		return err
+	}
+
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	posts, err := s.Store.GetTagPosts(tag, getAuthUserID(r), page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, posts)
+}
+
+// HANDLERS FOR TRENDING
+func (s *ApiServer) handleGetTrending(w http.ResponseWriter, r *http.Request) error {
+	window, err := getTrendingWindow(r)
+	if err != nil {
+		return err
+	}
+
+	limit, err := getPageLimit(r)
+	if err != nil {
+		return err
+	}
+
+	entry, err := s.getTrending(window)
+	if err != nil {
+		return err
+	}
+
+	ids := []int64{}
+	scores := map[int64]float64{}
+	for _, score := range entry.posts {
+		ids = append(ids, score.PostID)
+		scores[score.PostID] = score.Score
+	}
+	// posts are read at request time so they're filtered for the viewer and
+	// their counts are current
+	posts, err := s.Store.GetPostsByIDs(ids, getAuthUserID(r))
+	if err != nil {
+		return err
+	}
+
+	trending := &Trending{
+		Window:     window,
+		ComputedAt: entry.computedAt,
+		Posts:      []*TrendingPost{},
+		Tags:       entry.tags,
+	}
+	for _, post := range posts {
+		if len(trending.Posts) == limit {
+			break
+		}
+		trending.Posts = append(trending.Posts, &TrendingPost{Score: scores[post.ID], Post: post})
+	}
+	if len(trending.Tags) > limit {
+		trending.Tags = trending.Tags[:limit]
+	}
+	return WriteJson(w, http.StatusOK, trending)
+}
+
+// HANDLERS FOR SEARCH
+func (s *ApiServer) handleSearch(w http.ResponseWriter, r *http.Request) error {
+	req, err := getSearchRequest(r)
+	if err != nil {
+		return err
+	}
+
+	var results *Page[*SearchResult]
+	viewerID := getAuthUserID(r)
+	switch req.Type {
+	case SearchComments:
+		results, err = s.Store.SearchComments(req, viewerID)
+	case SearchUsers:
+		results, err = s.Store.SearchUsers(req, viewerID)
+	default:
+		results, err = s.Store.SearchPosts(req, viewerID)
+	}
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, results)
+}
+
+// HANDLERS FOR USER AUTOCOMPLETE
+func (s *ApiServer) handleAutocompleteUsers(w http.ResponseWriter, r *http.Request) error {
+	prefix, limit, err := getAutocompleteRequest(r)
+	if err != nil {
+		return err
+	}
+
+	viewerID := getAuthUserID(r)
+	key := autocompleteKey(viewerID, prefix, limit)
+	if users, ok := s.autocomplete.get(key); ok {
+		return WriteJson(w, http.StatusOK, users)
+	}
+
+	users, err := s.Store.AutocompleteUsers(prefix, viewerID, limit)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return WriteJson(w, http.StatusServiceUnavailable, ApiError{Error: "Autocomplete timed out"})
+	}
+	if err != nil {
+		return err
+	}
+	s.autocomplete.set(key, users)
+	return WriteJson(w, http.StatusOK, users)
+}
+
+// HANDLERS FOR MENTIONS
+func (s *ApiServer) handleGetMentions(w http.ResponseWriter, r *http.Request) error {
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	mentions, err := s.Store.GetMentions(getAuthUserID(r), page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, mentions)
+}
+
+// HANDLERS FOR POST LIKES
+func (s *ApiServer) handleGetPostlikes(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return fmt.Errorf("Unexpected method: %s", r.Method)
+	}
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	if post, err := s.getVisiblePost(w, r, id); err != nil || post == nil {
+		return err
+	}
+
+	likedby, err := s.Store.GetPostLikes(id, getAuthUserID(r), page)
+	if err != nil {
+		return err
+	}
+
+	return WriteJson(w, http.StatusOK, likedby)
+}
+
+func (s *ApiServer) handleLikePost(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return fmt.Errorf("Unexpected method %s", r.Method)
+	}
+	postID, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	if post, err := s.getVisiblePost(w, r, postID); err != nil || post == nil {
+		return err
+	}
+	userID := getAuthUserID(r)
+
+	err = s.Store.LikePost(userID, postID)
+	if err == errBlocked {
+		return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to like post")
+	}
+	s.publishPostLike(userID, postID, s.Reactions[0])
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Liked post: %v successfully", postID))
+}
 
 func (s *ApiServer) handleUnlikePost(w http.ResponseWriter, r *http.Request) error {
 	if r.Method != http.MethodDelete {
 		return fmt.Errorf("Unexpected method %s", r.Method)
 	}
 
-	postID, err := getID(r)
+	postID, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	userID := getAuthUserID(r)
+
+	if err := s.Store.UnlikePost(userID, postID); err != nil {
+		return fmt.Errorf("Failed to like post")
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Unliked post:%v successfully", postID))
+}
+
+// HANDLERS FOR REACTIONS
+func (s *ApiServer) handleGetReactions(w http.ResponseWriter, r *http.Request) error {
+	return WriteJson(w, http.StatusOK, s.Reactions)
+}
+
+func (s *ApiServer) handlePostReactions(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	userID := getAuthUserID(r)
+
+	if r.Method == http.MethodGet || r.Method == http.MethodPost {
+		if post, err := s.getVisiblePost(w, r, id); err != nil || post == nil {
+			return err
+		}
+	}
+
+	if r.Method == http.MethodGet {
+		return s.handleGetReactedBy(w, r, id, s.Store.GetPostReactions)
+	}
+
+	if r.Method == http.MethodPost {
+		req, err := s.getReactionRequest(r)
+		if err != nil {
+			return err
+		}
+		err = s.Store.ReactToPost(userID, id, req.Reaction)
+		if err == errBlocked {
+			return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+		}
+		if err != nil {
+			return err
+		}
+		s.publishPostLike(userID, id, req.Reaction)
+		return WriteJson(w, http.StatusOK, fmt.Sprintf("Reacted to post: %v with %s successfully", id, req.Reaction))
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := s.Store.UnlikePost(userID, id); err != nil {
+			return err
+		}
+		return WriteJson(w, http.StatusOK, fmt.Sprintf("Removed reaction to post: %v successfully", id))
+	}
+
+	return fmt.Errorf("Unexpected method %s", r.Method)
+}
+
+func (s *ApiServer) handleCommentReactions(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	userID := getAuthUserID(r)
+
+	if r.Method == http.MethodGet || r.Method == http.MethodPost {
+		if comment, err := s.getVisibleComment(w, r, id); err != nil || comment == nil {
+			return err
+		}
+	}
+
+	if r.Method == http.MethodGet {
+		return s.handleGetReactedBy(w, r, id, s.Store.GetCommentReactions)
+	}
+
+	if r.Method == http.MethodPost {
+		req, err := s.getReactionRequest(r)
+		if err != nil {
+			return err
+		}
+		err = s.Store.ReactToComment(userID, id, req.Reaction)
+		if err == errBlocked {
+			return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+		}
+		if err != nil {
+			return err
+		}
+		s.publishCommentLike(userID, id, req.Reaction)
+		return WriteJson(w, http.StatusOK, fmt.Sprintf("Reacted to comment: %v with %s successfully", id, req.Reaction))
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := s.Store.UnlikeComment(userID, id); err != nil {
+			return err
+		}
+		return WriteJson(w, http.StatusOK, fmt.Sprintf("Removed reaction to comment: %v successfully", id))
+	}
+
+	return fmt.Errorf("Unexpected method %s", r.Method)
+}
+
+// handleGetReactedBy lists who reacted to a post or comment, with the
+// ?reaction= query param or with any reaction when it's missing
+func (s *ApiServer) handleGetReactedBy(w http.ResponseWriter, r *http.Request, id int64,
+	getReactions func(id int64, reaction string, viewerID int64, page *PageRequest) (*Page[string], error)) error {
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	reaction := r.URL.Query().Get("reaction")
+	if reaction != "" {
+		if err := checkReaction(s.Reactions, reaction); err != nil {
+			return err
+		}
+	}
+
+	reactedBy, err := getReactions(id, reaction, getAuthUserID(r), page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, reactedBy)
+}
+
+// getReactionRequest reads a reaction from the request body, defaulting to
+// the default reaction when it's left out
+func (s *ApiServer) getReactionRequest(r *http.Request) (*ReactionRequest, error) {
+	defer r.Body.Close()
+	req := new(ReactionRequest)
+	if err := decodeOptionalJson(r, req); err != nil {
+		return nil, err
+	}
+	if req.Reaction == "" {
+		req.Reaction = s.Reactions[0]
+	}
+	return req, nil
+}
+
+func makeHttpHandlerFunc(f apiFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := f(w, r); err != nil {
+			WriteJson(w, http.StatusBadRequest, ApiError{Error: err.Error()})
+		}
+	}
+}
+
+// HANDLERS FOR COMMENTS
+func (s *ApiServer) handlePostComments(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == http.MethodGet {
+		return s.handleGetCommentsFromPost(w, r)
+	}
+
+	if r.Method == http.MethodPost {
+		return s.handleCreateComment(w, r)
+	}
+
+	return nil
+}
+
+func (s *ApiServer) handleCommentsByID(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == http.MethodGet {
+		return s.handleGetCommentByID(w, r)
+	}
+
+	if r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		return s.handleUpdateCommentByID(w, r)
+	}
+
+	if r.Method == http.MethodDelete {
+		return s.handleDeleteCommentByID(w, r)
+	}
+	return nil
+}
+
+func (s *ApiServer) handleGetCommentsFromPost(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return fmt.Errorf("Invalid id")
+	}
+
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	view, err := getCommentsView(r)
+	if err != nil {
+		return err
+	}
+
+	if post, err := s.getVisiblePost(w, r, id); err != nil || post == nil {
+		return err
+	}
+
+	comments, err := s.Store.GetCommentsFromPost(id, view, getAuthUserID(r), page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, comments)
+}
+
+func (s *ApiServer) handleCreateComment(w http.ResponseWriter, r *http.Request) error {
+	postID, err := getID(r)
+	if err != nil {
+		return WriteJson(w, http.StatusBadRequest, err)
+	}
+	req := new(CreateCommentRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return err
+	}
+	// the author is always the authenticated user
+	req.UserID = getAuthUserID(r)
+
+	if post, err := s.getVisiblePost(w, r, postID); err != nil || post == nil {
+		return err
+	}
+
+	comment, err := s.Store.CreateComment(postID, req)
+	if err == errBlocked {
+		return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	s.publishComment(comment)
+	s.publishMentions(comment.UserID, comment.Mentions)
+	return WriteJson(w, http.StatusCreated, comment)
+}
+
+// HANDLERS FOR COMMENT REPLIES
+func (s *ApiServer) handleCommentReplies(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == http.MethodGet {
+		return s.handleGetCommentReplies(w, r)
+	}
+
+	if r.Method == http.MethodPost {
+		return s.handleReplyToComment(w, r)
+	}
+
+	return nil
+}
+
+func (s *ApiServer) handleGetCommentReplies(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	if comment, err := s.getVisibleComment(w, r, id); err != nil || comment == nil {
+		return err
+	}
+
+	replies, err := s.Store.GetCommentReplies(id, getAuthUserID(r), page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, replies)
+}
+
+func (s *ApiServer) handleReplyToComment(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	parent, err := s.getVisibleComment(w, r, id)
+	if err != nil || parent == nil {
+		return err
+	}
+
+	req := new(CreateCommentRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return err
+	}
+	// the author is always the authenticated user
+	req.UserID = getAuthUserID(r)
+	req.ParentCommentID = &parent.ID
+
+	reply, err := s.Store.CreateComment(parent.PostID, req)
+	if err == errBlocked {
+		return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	s.publishComment(reply)
+	s.publishMentions(reply.UserID, reply.Mentions)
+	return WriteJson(w, http.StatusOK, reply)
+}
+
+func (s *ApiServer) handleUpdateCommentByID(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return WriteJson(w, http.StatusBadRequest, err)
+	}
+
+	req := new(CreateCommentRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return err
+	}
+	if err := s.Store.UpdateComment(id, req); err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, req)
+}
+
+func (s *ApiServer) handleGetCommentByID(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	comment, err := s.Store.GetComment(id)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, comment)
+}
+
+func (s *ApiServer) handleDeleteCommentByID(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.DeleteComment(id); err != nil {
+		return err
+	}
+	deletedMsg := fmt.Sprintf("Deleted comment %v succesfully", id)
+	return WriteJson(w, http.StatusOK, fmt.Errorf(deletedMsg))
+}
+
+func (s *ApiServer) handleLikeComment(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return fmt.Errorf("Unexpected method %s", r.Method)
+	}
+
+	commentID, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	if comment, err := s.getVisibleComment(w, r, commentID); err != nil || comment == nil {
+		return err
+	}
+	userID := getAuthUserID(r)
+
+	err = s.Store.LikeComment(userID, commentID)
+	if err == errBlocked {
+		return WriteJson(w, http.StatusForbidden, ApiError{Error: err.Error()})
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to like comment: %v", commentID)
+	}
+	s.publishCommentLike(userID, commentID, s.Reactions[0])
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Liked post: %v successfuly", commentID))
+}
+
+func (s *ApiServer) handleUnlikeComment(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodDelete {
+		return fmt.Errorf("Unexpected method %s", r.Method)
+	}
+
+	commentID, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	userID := getAuthUserID(r)
+
+	if err := s.Store.UnlikeComment(userID, commentID); err != nil {
+		return fmt.Errorf("Failed to unlike comment: %v", commentID)
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Unliked post: %v successfuly", commentID))
+}
+
+// HANDLERS FOR CONVERSATIONS
+func (s *ApiServer) handleCreateConversation(w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	req := new(CreateConversationRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return err
+	}
+
+	userID := getAuthUserID(r)
+	recipient, err := s.Store.GetUserByName(req.UserName)
+	if err != nil || recipient == nil {
+		return WriteJson(w, http.StatusNotFound, ApiError{Error: "user not found"})
+	}
+	if recipient.ID == userID {
+		return fmt.Errorf("Can't start a conversation with yourself")
+	}
+
+	ok, err := s.canMessage(userID, recipient)
 	if err != nil {
 		return err
 	}
+	if !ok {
+		return WriteJson(w, http.StatusForbidden, ApiError{Error: fmt.Sprintf("%s doesn't accept messages from you", recipient.UserName)})
+	}
 
-	userID, err := getUserIDFromParams(r)
+	conversation, err := s.Store.GetOrCreateDirectConversation(userID, recipient.ID)
 	if err != nil {
 		return err
 	}
+	s.prepareConversations(userID, conversation)
+	return WriteJson(w, http.StatusOK, conversation)
+}
 
-	if err := s.Store.UnlikePost(userID, postID); err != nil {
-		return fmt.Errorf("Failed to like post")
+func (s *ApiServer) handleGetConversations(w http.ResponseWriter, r *http.Request) error {
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
 	}
-	return WriteJson(w, http.StatusOK, fmt.Sprintf("Unliked post:%v successfully", postID))
+
+	userID := getAuthUserID(r)
+	conversations, err := s.Store.GetUserConversations(userID, page)
+	if err != nil {
+		return err
+	}
+	s.prepareConversations(userID, conversations.Items...)
+	return WriteJson(w, http.StatusOK, conversations)
 }
 
-func makeHttpHandlerFunc(f apiFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if err := f(w, r); err != nil {
-			WriteJson(w, http.StatusBadRequest, ApiError{Error: err.Error()})
-		}
+func (s *ApiServer) handleGetConversation(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+
+	conversation, err := s.Store.GetConversation(id)
+	if err != nil {
+		return err
 	}
+	s.prepareConversations(getAuthUserID(r), conversation)
+	return WriteJson(w, http.StatusOK, conversation)
 }
 
-// HANDLERS FOR COMMENTS
-func (s *ApiServer) handlePostComments(w http.ResponseWriter, r *http.Request) error {
+func (s *ApiServer) handleConversationMessages(w http.ResponseWriter, r *http.Request) error {
 	if r.Method == http.MethodGet {
-		return s.handleGetCommentsFromPost(w, r)
+		return s.handleGetMessages(w, r)
 	}
 
 	if r.Method == http.MethodPost {
-		return s.handleCreateComment(w, r)
+		return s.handleCreateMessage(w, r)
 	}
+	return fmt.Errorf("Unexpected method %s", r.Method)
+}
 
-	return nil
+func (s *ApiServer) handleGetMessages(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	messages, err := s.Store.GetMessages(id, page)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, messages)
 }
 
-func (s *ApiServer) handleCommentsByID(w http.ResponseWriter, r *http.Request) error {
-	if r.Method == http.MethodGet {
-		return s.handleGetCommentByID(w, r)
+func (s *ApiServer) handleCreateMessage(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
 	}
 
-	if r.Method == http.MethodPut || r.Method == http.MethodPatch {
-		return s.handleUpdateCommentByID(w, r)
+	defer r.Body.Close()
+	req := new(CreateMessageRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return err
+	}
+	// the sender is always the authenticated user
+	req.UserID = getAuthUserID(r)
+	if err := validateMessage(req); err != nil {
+		return err
 	}
 
-	if r.Method == http.MethodDelete {
-		return s.handleDeleteCommentByID(w, r)
+	conversation, err := s.Store.GetConversation(id)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	// the other member's settings may have changed since the conversation started
+	for _, member := range conversation.Members {
+		if conversation.Kind != ConversationDirect || member.UserID == req.UserID {
+			continue
+		}
+		recipient, err := s.Store.GetUserByID(member.UserID)
+		if err != nil || recipient == nil {
+			return fmt.Errorf("Failed to get conversation member %v", member.UserID)
+		}
+		ok, err := s.canMessage(req.UserID, recipient)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return WriteJson(w, http.StatusForbidden, ApiError{Error: fmt.Sprintf("%s doesn't accept messages from you", recipient.UserName)})
+		}
+	}
+
+	message, err := s.Store.CreateMessage(id, req)
+	if err != nil {
+		return err
+	}
+	s.publishMessage(conversation, message)
+	return WriteJson(w, http.StatusOK, message)
 }
 
-func (s *ApiServer) handleGetCommentsFromPost(w http.ResponseWriter, r *http.Request) error {
+func (s *ApiServer) handleMarkConversationRead(w http.ResponseWriter, r *http.Request) error {
 	id, err := getID(r)
 	if err != nil {
-		return fmt.Errorf("Invalid id")
+		return err
+	}
+
+	defer r.Body.Close()
+	req := new(MarkReadRequest)
+	if err := decodeOptionalJson(r, req); err != nil {
+		return err
 	}
 
-	comments, err := s.Store.GetCommentsFromPost(id)
+	userID := getAuthUserID(r)
+	lastRead, err := s.Store.MarkConversationRead(id, userID, req.MessageID)
 	if err != nil {
 		return err
 	}
-	return WriteJson(w, http.StatusOK, comments)
+
+	conversation, err := s.Store.GetConversation(id)
+	if err != nil {
+		return err
+	}
+	if lastRead != 0 {
+		s.publishReadReceipt(conversation, userID, lastRead)
+	}
+	return WriteJson(w, http.StatusOK, map[string]int64{"lastReadMessageID": lastRead})
 }
 
-func (s *ApiServer) handleCreateComment(w http.ResponseWriter, r *http.Request) error {
-	postID, err := getID(r)
+func (s *ApiServer) handleTyping(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
 	if err != nil {
-		return WriteJson(w, http.StatusBadRequest, err)
+		return err
 	}
-	req := new(CreateCommentRequest)
+
+	user, err := s.Store.GetUserByID(getAuthUserID(r))
+	if err != nil {
+		return err
+	}
+	conversation, err := s.Store.GetConversation(id)
+	if err != nil {
+		return err
+	}
+
+	s.publishTyping(conversation, user)
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Typing in conversation: %v", id))
+}
+
+// HANDLERS FOR GROUP CONVERSATIONS
+func (s *ApiServer) handleCreateGroup(w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	req := new(CreateGroupRequest)
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		return err
 	}
-	err = s.Store.CreateComment(postID, req)
+
+	title, err := validateGroupTitle(req.Title)
 	if err != nil {
 		return err
 	}
-	return WriteJson(w, http.StatusOK, req)
+
+	creator, err := s.Store.GetUserByID(getAuthUserID(r))
+	if err != nil {
+		return err
+	}
+
+	memberIDs, err := s.newGroupMembers(w, creator, req.UserNames)
+	if err != nil || memberIDs == nil {
+		return err
+	}
+	if len(memberIDs)+1 > maxGroupMembers {
+		return errGroupFull
+	}
+
+	notice := systemMessage(creator.ID, "%s created the group %s", creator.UserName, title)
+	conversation, err := s.Store.CreateGroupConversation(creator.ID, title, memberIDs, notice)
+	if err != nil {
+		return err
+	}
+	s.publishMessage(conversation, conversation.LastMessage)
+	s.prepareConversations(creator.ID, conversation)
+	return WriteJson(w, http.StatusOK, conversation)
 }
 
-func (s *ApiServer) handleUpdateCommentByID(w http.ResponseWriter, r *http.Request) error {
+func (s *ApiServer) handleUpdateGroup(w http.ResponseWriter, r *http.Request) error {
 	id, err := getID(r)
 	if err != nil {
-		return WriteJson(w, http.StatusBadRequest, err)
+		return err
 	}
 
-	req := new(CreateCommentRequest)
+	defer r.Body.Close()
+	req := new(UpdateGroupRequest)
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		return err
 	}
-	if err := s.Store.UpdateComment(id, req); err != nil {
+	title, err := validateGroupTitle(req.Title)
+	if err != nil {
 		return err
 	}
-	return WriteJson(w, http.StatusOK, req)
+
+	actor, err := s.Store.GetUserByID(getAuthUserID(r))
+	if err != nil {
+		return err
+	}
+
+	notice := systemMessage(actor.ID, "%s renamed the group to %s", actor.UserName, title)
+	message, err := s.Store.UpdateConversationTitle(id, title, notice)
+	if err != nil {
+		return err
+	}
+	return s.writeGroupChange(w, r, id, message)
 }
 
-func (s *ApiServer) handleGetCommentByID(w http.ResponseWriter, r *http.Request) error {
+func (s *ApiServer) handleAddMembers(w http.ResponseWriter, r *http.Request) error {
 	id, err := getID(r)
 	if err != nil {
 		return err
 	}
 
-	comment, err := s.Store.GetComment(id)
+	defer r.Body.Close()
+	req := new(AddMembersRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return err
+	}
+
+	actor, err := s.Store.GetUserByID(getAuthUserID(r))
 	if err != nil {
 		return err
 	}
-	return WriteJson(w, http.StatusOK, comment)
+
+	memberIDs, err := s.newGroupMembers(w, actor, req.UserNames)
+	if err != nil || memberIDs == nil {
+		return err
+	}
+	if len(memberIDs) == 0 {
+		return fmt.Errorf("No users to add")
+	}
+
+	notice := systemMessage(actor.ID, "%s added %s", actor.UserName, joinNames(req.UserNames))
+	message, err := s.Store.AddConversationMembers(id, memberIDs, notice)
+	if err != nil {
+		return err
+	}
+	return s.writeGroupChange(w, r, id, message)
 }
 
-func (s *ApiServer) handleDeleteCommentByID(w http.ResponseWriter, r *http.Request) error {
+func (s *ApiServer) handleUpdateMember(w http.ResponseWriter, r *http.Request) error {
 	id, err := getID(r)
 	if err != nil {
 		return err
 	}
 
-	if err := s.Store.DeleteComment(id); err != nil {
+	defer r.Body.Close()
+	req := new(UpdateMemberRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		return err
 	}
-	deletedMsg := fmt.Sprintf("Deleted comment %v succesfully", id)
-	return WriteJson(w, http.StatusOK, fmt.Errorf(deletedMsg))
+	if !validRole(req.Role) {
+		return fmt.Errorf("Invalid role: %v", req.Role)
+	}
+
+	conversation, member, err := s.getGroupMember(id, getUserName(r))
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return WriteJson(w, http.StatusNotFound, ApiError{Error: "member not found"})
+	}
+
+	if req.Role == RoleMember && member.Role == RoleAdmin && countAdmins(conversation) == 1 {
+		return fmt.Errorf("A group needs at least one admin")
+	}
+
+	if err := s.Store.SetConversationMemberRole(id, member.UserID, req.Role); err != nil {
+		return err
+	}
+	return s.writeGroupChange(w, r, id, nil)
 }
 
-func (s *ApiServer) handleLikeComment(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != http.MethodPost {
-		return fmt.Errorf("Unexpected method %s", r.Method)
+func (s *ApiServer) handleRemoveMember(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
 	}
 
-	commentID, err := getID(r)
+	_, member, err := s.getGroupMember(id, getUserName(r))
 	if err != nil {
 		return err
 	}
+	if member == nil {
+		return WriteJson(w, http.StatusNotFound, ApiError{Error: "member not found"})
+	}
 
-	userID, err := getUserIDFromParams(r)
+	actor, err := s.Store.GetUserByID(getAuthUserID(r))
 	if err != nil {
 		return err
 	}
 
-	if err := s.Store.LikeComment(userID, commentID); err != nil {
-		return fmt.Errorf("Failed to like comment: %v", commentID)
+	notice := systemMessage(actor.ID, "%s removed %s", actor.UserName, member.UserName)
+	if member.UserID == actor.ID {
+		notice = systemMessage(actor.ID, "%s left", actor.UserName)
 	}
-	return WriteJson(w, http.StatusOK, fmt.Sprintf("Liked post: %v successfuly", commentID))
+	message, err := s.Store.RemoveConversationMember(id, member.UserID, notice)
+	if err != nil {
+		return err
+	}
+	return s.writeGroupChange(w, r, id, message, member.UserID)
 }
 
-func (s *ApiServer) handleUnlikeComment(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != http.MethodDelete {
-		return fmt.Errorf("Unexpected method %s", r.Method)
+func (s *ApiServer) handleLeaveGroup(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
 	}
 
-	commentID, err := getID(r)
+	conversation, err := s.Store.GetConversation(id)
 	if err != nil {
 		return err
 	}
+	if conversation.Kind != ConversationGroup {
+		return fmt.Errorf("Only group conversations can be left")
+	}
 
-	userID, err := getUserIDFromParams(r)
+	actor, err := s.Store.GetUserByID(getAuthUserID(r))
 	if err != nil {
 		return err
 	}
 
-	if err := s.Store.UnlikeComment(userID, commentID); err != nil {
-		return fmt.Errorf("Failed to unlike comment: %v", commentID)
+	message, err := s.Store.RemoveConversationMember(id, actor.ID, systemMessage(actor.ID, "%s left", actor.UserName))
+	if err != nil {
+		return err
 	}
-	return WriteJson(w, http.StatusOK, fmt.Sprintf("Unliked post: %v successfuly", commentID))
+	if message != nil {
+		s.publishMessage(conversation, message)
+	}
+	return WriteJson(w, http.StatusOK, fmt.Sprintf("Left conversation: %v", id))
+}
+
+// newGroupMembers looks up the users to add to a group by actor, replying
+// with an error and returning nil ids when one doesn't exist or doesn't
+// accept messages from actor
+func (s *ApiServer) newGroupMembers(w http.ResponseWriter, actor *User, userNames []string) ([]int64, error) {
+	memberIDs := []int64{}
+	seen := map[int64]bool{actor.ID: true}
+	for _, userName := range userNames {
+		user, err := s.Store.GetUserByName(userName)
+		if err != nil || user == nil {
+			return nil, WriteJson(w, http.StatusNotFound, ApiError{Error: fmt.Sprintf("user %s not found", userName)})
+		}
+		if seen[user.ID] {
+			continue
+		}
+		seen[user.ID] = true
+
+		ok, err := s.canMessage(actor.ID, user)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, WriteJson(w, http.StatusForbidden, ApiError{Error: fmt.Sprintf("%s doesn't accept messages from you", user.UserName)})
+		}
+		memberIDs = append(memberIDs, user.ID)
+	}
+	return memberIDs, nil
+}
+
+// getGroupMember returns a group and its member with the given username, or
+// a nil member if they aren't in it
+func (s *ApiServer) getGroupMember(id int64, userName string) (*Conversation, *ConversationMember, error) {
+	conversation, err := s.Store.GetConversation(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, member := range conversation.Members {
+		if member.UserName == userName {
+			return conversation, member, nil
+		}
+	}
+	return conversation, nil, nil
+}
+
+// writeGroupChange publishes the system message recording a change to a
+// group, if any, and replies with the updated group
+func (s *ApiServer) writeGroupChange(w http.ResponseWriter, r *http.Request, id int64, message *Message, others ...int64) error {
+	conversation, err := s.Store.GetConversation(id)
+	if err != nil {
+		return err
+	}
+	if message != nil {
+		s.publishMessage(conversation, message, others...)
+	}
+	s.prepareConversations(getAuthUserID(r), conversation)
+	return WriteJson(w, http.StatusOK, conversation)
+}
+
+func countAdmins(conversation *Conversation) int {
+	admins := 0
+	for _, member := range conversation.Members {
+		if member.Role == RoleAdmin {
+			admins++
+		}
+	}
+	return admins
+}
+
+// HANDLERS FOR NOTIFICATIONS
+func (s *ApiServer) handleGetNotifications(w http.ResponseWriter, r *http.Request) error {
+	page, err := getPageRequest(r)
+	if err != nil {
+		return err
+	}
+
+	userID := getAuthUserID(r)
+	notifications, err := s.Store.GetNotifications(userID, page)
+	if err != nil {
+		return err
+	}
+	unread, err := s.Store.CountUnreadNotifications(userID)
+	if err != nil {
+		return err
+	}
+
+	return WriteJson(w, http.StatusOK, &NotificationsResponse{
+		UnreadCount: unread,
+		Items:       notifications.Items,
+		NextCursor:  notifications.NextCursor,
+	})
+}
+
+func (s *ApiServer) handleMarkNotificationsRead(w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	req := new(MarkNotificationsReadRequest)
+	if err := decodeOptionalJson(r, req); err != nil {
+		return err
+	}
+
+	userID := getAuthUserID(r)
+	if err := s.Store.MarkNotificationsRead(userID, req.IDs); err != nil {
+		return err
+	}
+
+	unread, err := s.Store.CountUnreadNotifications(userID)
+	if err != nil {
+		return err
+	}
+	return WriteJson(w, http.StatusOK, map[string]int{"unreadCount": unread})
 }
 
 // HELPER FUNCTIONS
@@ -545,6 +2145,15 @@ func WriteJson(w http.ResponseWriter, status int, v any) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
+// decodeOptionalJson decodes the request body into v, leaving v as is when
+// the body is empty. ContentLength can't tell, it's -1 for chunked bodies.
+func decodeOptionalJson(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
 func getID(r *http.Request) (int64, error) {
 	idStr := chi.URLParam(r, "id")
 	idInt, err := strconv.Atoi(idStr)
@@ -555,18 +2164,12 @@ func getID(r *http.Request) (int64, error) {
 	return id, nil
 }
 
-func getUserIDFromParams(r *http.Request) (int64, error) {
-	userID_str := r.URL.Query().Get("userID")
-	if userID_str == "" {
-		return 0, fmt.Errorf("userID is required")
-	}
-	userID_int, err := strconv.Atoi(userID_str)
+func getClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return 0, err
+		return r.RemoteAddr
 	}
-
-	userID := int64(userID_int)
-	return userID, nil
+	return host
 }
 
 func getUserName(r *http.Request) string {
@@ -0,0 +1,1611 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *MemoryStore) {
+	store := NewMemoryStore()
+	server := httptest.NewServer(NewApiServer("", store).Router())
+	t.Cleanup(server.Close)
+	return server, store
+}
+
+// doRequest sends body as JSON, authenticating with token when it's not empty
+func doRequest(t *testing.T, server *httptest.Server, method, path, token string, body any) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to marshal body: %v", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("x-jwt-token", token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func expectStatus(t *testing.T, res *http.Response, status int) {
+	t.Helper()
+	if res.StatusCode != status {
+		body, _ := io.ReadAll(res.Body)
+		t.Fatalf("%s %s: expected status %d, got %d: %s",
+			res.Request.Method, res.Request.URL.Path, status, res.StatusCode, body)
+	}
+}
+
+func decodeBody(t *testing.T, res *http.Response, v any) {
+	t.Helper()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+}
+
+// signUp creates a user and logs them in, returning the user and login response
+func signUp(t *testing.T, server *httptest.Server, username string) (*User, *LoginResponse) {
+	t.Helper()
+
+	res := doRequest(t, server, http.MethodPost, "/signup", "", CreateUserRequest{
+		UserName: username,
+		Name:     username,
+		Email:    username + "@example.com",
+		Password: "password",
+	})
+	expectStatus(t, res, http.StatusOK)
+	user := new(User)
+	decodeBody(t, res, user)
+
+	return user, login(t, server, username)
+}
+
+func login(t *testing.T, server *httptest.Server, username string) *LoginResponse {
+	t.Helper()
+
+	res := doRequest(t, server, http.MethodPost, "/login", "", LoginRequest{
+		UserName: username,
+		Password: "password",
+		Device:   "test",
+	})
+	expectStatus(t, res, http.StatusOK)
+	login := new(LoginResponse)
+	decodeBody(t, res, login)
+	return login
+}
+
+func TestWelcome(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := doRequest(t, server, http.MethodGet, "/", "", nil)
+	expectStatus(t, res, http.StatusOK)
+}
+
+func TestSignUpAndLogin(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	user, auth := signUp(t, server, "alice")
+	if user.ID == 0 {
+		t.Error("Expected signup to return the stored user id")
+	}
+	if auth.Token == "" || auth.RefreshToken == "" {
+		t.Error("Expected login to return an access and refresh token")
+	}
+
+	// usernames are unique
+	res := doRequest(t, server, http.MethodPost, "/signup", "", CreateUserRequest{UserName: "alice", Password: "pw"})
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res = doRequest(t, server, http.MethodPost, "/login", "", LoginRequest{UserName: "alice", Password: "wrong"})
+	expectStatus(t, res, http.StatusBadRequest)
+
+	// names of the router's own paths would shadow the profile routes
+	for _, name := range []string{"feed", "Trending"} {
+		res = doRequest(t, server, http.MethodPost, "/signup", "", CreateUserRequest{UserName: name, Password: "pw"})
+		expectStatus(t, res, http.StatusBadRequest)
+	}
+	res = doRequest(t, server, http.MethodPatch, "/alice", auth.Token, CreateUserRequest{UserName: "search"})
+	expectStatus(t, res, http.StatusBadRequest)
+}
+
+func TestReservedUserNames(t *testing.T) {
+	router := NewApiServer("", NewMemoryStore()).Router().(chi.Routes)
+	err := chi.Walk(router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		if segment != "" && !strings.HasPrefix(segment, "{") && !reservedUserNames[segment] {
+			t.Errorf("Expected /%s to be a reserved username, it shadows /{username}", segment)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, auth := signUp(t, server, "alice")
+
+	res := doRequest(t, server, http.MethodPost, "/tokens/refresh", "", RefreshTokenRequest{RefreshToken: auth.RefreshToken})
+	expectStatus(t, res, http.StatusOK)
+	refreshed := new(LoginResponse)
+	decodeBody(t, res, refreshed)
+
+	if refreshed.RefreshToken == auth.RefreshToken {
+		t.Error("Expected the refresh token to be rotated")
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/me/sessions", refreshed.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	// a request that read the session before it was rotated can't rotate it
+	sessions, _ := store.GetUserSessions(alice.ID)
+	rotated, err := store.RotateSession(sessions[0].ID, hashRefreshToken(auth.RefreshToken), hashRefreshToken("replayed"), time.Now().Add(time.Hour))
+	if err != nil || rotated {
+		t.Errorf("Expected a stale refresh token not to rotate the session, got %v, %v", rotated, err)
+	}
+
+	// an unknown refresh token is rejected without touching the session
+	res = doRequest(t, server, http.MethodPost, "/tokens/refresh", "", RefreshTokenRequest{RefreshToken: "unknown"})
+	expectStatus(t, res, http.StatusUnauthorized)
+	if sessions, _ := store.GetUserSessions(alice.ID); len(sessions) != 1 {
+		t.Fatalf("Expected alice's session to be kept, got %+v", sessions)
+	}
+
+	// the old refresh token can't be used again, and replaying it revokes
+	// the session, so the current one stops working too
+	res = doRequest(t, server, http.MethodPost, "/tokens/refresh", "", RefreshTokenRequest{RefreshToken: auth.RefreshToken})
+	expectStatus(t, res, http.StatusUnauthorized)
+	if sessions, _ := store.GetUserSessions(alice.ID); len(sessions) != 0 {
+		t.Errorf("Expected the replay to revoke alice's session, got %+v", sessions)
+	}
+	res = doRequest(t, server, http.MethodPost, "/tokens/refresh", "", RefreshTokenRequest{RefreshToken: refreshed.RefreshToken})
+	expectStatus(t, res, http.StatusUnauthorized)
+}
+
+func TestLogout(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, auth := signUp(t, server, "alice")
+
+	res := doRequest(t, server, http.MethodPost, "/logout", auth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	// the access token is rejected although it hasn't expired
+	res = doRequest(t, server, http.MethodGet, "/me/sessions", auth.Token, nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodPost, "/tokens/refresh", "", RefreshTokenRequest{RefreshToken: auth.RefreshToken})
+	expectStatus(t, res, http.StatusUnauthorized)
+}
+
+func TestSessions(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, phone := signUp(t, server, "alice")
+	laptop := login(t, server, "alice")
+	_, bob := signUp(t, server, "bob")
+
+	res := doRequest(t, server, http.MethodGet, "/me/sessions", laptop.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	sessions := []*Session{}
+	decodeBody(t, res, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+
+	var phoneSession string
+	for _, session := range sessions {
+		if !session.Current {
+			phoneSession = session.ID
+		}
+		if session.Device != "test" {
+			t.Errorf("Expected device to be recorded, got %q", session.Device)
+		}
+	}
+
+	// sessions can only be revoked by their owner
+	res = doRequest(t, server, http.MethodDelete, "/me/sessions/"+phoneSession, bob.Token, nil)
+	expectStatus(t, res, http.StatusNotFound)
+
+	res = doRequest(t, server, http.MethodDelete, "/me/sessions/"+phoneSession, laptop.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, "/me/sessions", phone.Token, nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+}
+
+func TestUserRoutes(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, alice := signUp(t, server, "alice")
+	_, bob := signUp(t, server, "bob")
+
+	res := doRequest(t, server, http.MethodGet, "/alice", "", nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodPatch, "/alice", "", CreateUserRequest{Bio: "hacked"})
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodPatch, "/alice", bob.Token, CreateUserRequest{Bio: "hacked"})
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodPatch, "/alice", alice.Token, CreateUserRequest{Bio: "hello"})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodPut, "/alice", alice.Token, CreateUserRequest{Name: "Alice"})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, "/alice", "", nil)
+	expectStatus(t, res, http.StatusOK)
+	profile := new(UserProfile)
+	decodeBody(t, res, profile)
+	if profile.Bio != "hello" || profile.Name != "Alice" {
+		t.Errorf("Expected profile to be updated, got %+v", profile)
+	}
+
+	res = doRequest(t, server, http.MethodDelete, "/alice", bob.Token, nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodDelete, "/alice", alice.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, "/alice", "", nil)
+	expectStatus(t, res, http.StatusBadRequest)
+}
+
+func TestPostRoutes(t *testing.T) {
+	server, _ := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	_, bobAuth := signUp(t, server, "bob")
+
+	res := doRequest(t, server, http.MethodPost, "/alice/posts", bobAuth.Token,
+		CreatePostRequest{UserID: alice.ID, Content: "not mine"})
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodPost, "/alice/posts", aliceAuth.Token,
+		CreatePostRequest{UserID: alice.ID, Content: "first post"})
+	expectStatus(t, res, http.StatusCreated)
+	created := new(Post)
+	decodeBody(t, res, created)
+	if created.ID == 0 || created.UserID != alice.ID {
+		t.Fatalf("Expected the stored post back, got %+v", created)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/alice/posts", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	posts := new(Page[*Post])
+	decodeBody(t, res, posts)
+	if len(posts.Items) != 1 || posts.Items[0].Content != "first post" {
+		t.Fatalf("Expected alice's post, got %+v", posts.Items)
+	}
+	postPath := fmt.Sprintf("/posts/%d", posts.Items[0].ID)
+
+	res = doRequest(t, server, http.MethodGet, postPath, aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodPut, postPath, bobAuth.Token, CreatePostRequest{Content: "edited"})
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodPut, postPath, aliceAuth.Token, CreatePostRequest{Content: "edited"})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodPatch, postPath, aliceAuth.Token, CreatePostRequest{MediaUrl: "https://example.com/a.png"})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, postPath, aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	post := new(Post)
+	decodeBody(t, res, post)
+	if post.Content != "edited" || post.MediaUrl != "https://example.com/a.png" {
+		t.Errorf("Expected post to be updated, got %+v", post)
+	}
+
+	res = doRequest(t, server, http.MethodDelete, postPath, aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, postPath, aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+}
+
+func TestFollowRoutes(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+
+	res := doRequest(t, server, http.MethodPost, "/alice/follow", bobAuth.Token, FollowRequest{FollowingID: bob.ID})
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodPost, "/alice/follow", aliceAuth.Token, FollowRequest{FollowingID: bob.ID})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, "/bob/followers", "", nil)
+	expectStatus(t, res, http.StatusOK)
+	followers := new(Page[string])
+	decodeBody(t, res, followers)
+	if len(followers.Items) != 1 || followers.Items[0] != "alice" {
+		t.Errorf("Expected bob to be followed by alice, got %v", followers.Items)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/alice/following", "", nil)
+	expectStatus(t, res, http.StatusOK)
+	following := new(Page[string])
+	decodeBody(t, res, following)
+	if len(following.Items) != 1 || following.Items[0] != "bob" {
+		t.Errorf("Expected alice to follow bob, got %v", following.Items)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/bob", "", nil)
+	profile := new(UserProfile)
+	decodeBody(t, res, profile)
+	if profile.Followers != 1 || profile.Following != 0 {
+		t.Errorf("Expected bob to have 1 follower, got %+v", profile)
+	}
+
+	res = doRequest(t, server, http.MethodDelete, "/alice/unfollow", aliceAuth.Token, FollowRequest{FollowingID: bob.ID})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, "/bob/followers", "", nil)
+	followers = new(Page[string])
+	decodeBody(t, res, followers)
+	if len(followers.Items) != 0 {
+		t.Errorf("Expected bob to have no followers, got %v", followers.Items)
+	}
+}
+
+func TestPostLikeAndCommentRoutes(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+
+	if _, err := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	posts, _ := store.GetUserPosts("alice", &PageRequest{Limit: 1})
+	postPath := fmt.Sprintf("/posts/%d", posts.Items[0].ID)
+
+	// likes
+	res := doRequest(t, server, http.MethodPost, postPath+"/like", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodPost, postPath+"/like", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res = doRequest(t, server, http.MethodGet, postPath+"/likes", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	likedBy := new(Page[string])
+	decodeBody(t, res, likedBy)
+	if len(likedBy.Items) != 1 || likedBy.Items[0] != "bob" {
+		t.Errorf("Expected post to be liked by bob, got %v", likedBy.Items)
+	}
+
+	res = doRequest(t, server, http.MethodDelete, postPath+"/unlike", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	// comments
+	res = doRequest(t, server, http.MethodPost, postPath+"/comments", bobAuth.Token,
+		CreateCommentRequest{Text: "nice", UserID: bob.ID})
+	expectStatus(t, res, http.StatusCreated)
+	comment := new(Comment)
+	decodeBody(t, res, comment)
+	if comment.ID == 0 || comment.PostID != posts.Items[0].ID {
+		t.Fatalf("Expected the stored comment back, got %+v", comment)
+	}
+
+	res = doRequest(t, server, http.MethodGet, postPath+"/comments", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	comments := new(Page[*Comment])
+	decodeBody(t, res, comments)
+	if len(comments.Items) != 1 || comments.Items[0].Text != "nice" {
+		t.Fatalf("Expected bob's comment, got %+v", comments.Items)
+	}
+	commentID := comments.Items[0].ID
+	commentPath := fmt.Sprintf("/comments/%d", commentID)
+
+	res = doRequest(t, server, http.MethodGet, commentPath, bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodPut, commentPath, aliceAuth.Token, CreateCommentRequest{Text: "edited"})
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodPatch, commentPath, bobAuth.Token, CreateCommentRequest{Text: "very nice"})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodPost, commentPath+"/like", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodDelete, commentPath+"/unlike", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodDelete, commentPath, bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	if comment, _ := store.GetComment(commentID); comment != nil {
+		t.Error("Expected comment to be deleted")
+	}
+}
+
+func TestFeed(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, _ := signUp(t, server, "bob")
+	carol, _ := signUp(t, server, "carol")
+
+	store.CreateFollow(&FollowRequest{UserID: alice.ID, FollowingID: bob.ID})
+	for i := 0; i < 3; i++ {
+		store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: fmt.Sprintf("alice %d", i)})
+		store.CreatePost(&CreatePostRequest{UserID: bob.ID, Content: fmt.Sprintf("bob %d", i)})
+		store.CreatePost(&CreatePostRequest{UserID: carol.ID, Content: fmt.Sprintf("carol %d", i)})
+	}
+
+	res := doRequest(t, server, http.MethodGet, "/feed", "", nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	seen := []*Post{}
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		res := doRequest(t, server, http.MethodGet, "/feed?limit=4&cursor="+cursor, aliceAuth.Token, nil)
+		expectStatus(t, res, http.StatusOK)
+		page := new(Page[*Post])
+		decodeBody(t, res, page)
+
+		seen = append(seen, page.Items...)
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+
+	if len(seen) != 6 {
+		t.Fatalf("Expected 6 posts from alice and bob, got %d", len(seen))
+	}
+	for i, post := range seen {
+		if post.UserID == carol.ID {
+			t.Errorf("Feed contains a post from carol who alice doesn't follow: %+v", post)
+		}
+		if i > 0 && !newerThan(postCursor(seen[i-1]), postCursor(post)) {
+			t.Errorf("Feed is not ordered newest first at position %d", i)
+		}
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/feed?cursor=garbage", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+}
+
+func TestListPagination(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, _ := signUp(t, server, "alice")
+	for i := 0; i < 5; i++ {
+		follower := createTestUser(t, store, fmt.Sprintf("follower%d", i))
+		store.CreateFollow(&FollowRequest{UserID: follower.ID, FollowingID: alice.ID})
+	}
+
+	seen := map[string]bool{}
+	cursor := ""
+	for pages := 1; ; pages++ {
+		res := doRequest(t, server, http.MethodGet, "/alice/followers?limit=2&cursor="+cursor, "", nil)
+		expectStatus(t, res, http.StatusOK)
+		page := new(Page[string])
+		decodeBody(t, res, page)
+
+		if len(page.Items) > 2 {
+			t.Fatalf("Expected at most 2 followers per page, got %d", len(page.Items))
+		}
+		for _, name := range page.Items {
+			if seen[name] {
+				t.Errorf("Follower %s was listed twice", name)
+			}
+			seen[name] = true
+		}
+
+		if cursor = page.NextCursor; cursor == "" {
+			if pages != 3 {
+				t.Errorf("Expected 3 pages, got %d", pages)
+			}
+			break
+		}
+	}
+
+	if len(seen) != 5 {
+		t.Errorf("Expected 5 followers, got %d", len(seen))
+	}
+	// newest first
+	res := doRequest(t, server, http.MethodGet, "/alice/followers?limit=1", "", nil)
+	page := new(Page[string])
+	decodeBody(t, res, page)
+	if page.Items[0] != "follower4" {
+		t.Errorf("Expected the latest follower first, got %s", page.Items[0])
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	carol, _ := signUp(t, server, "carol")
+
+	store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "hello"})
+	posts, _ := store.GetUserPosts("alice", &PageRequest{Limit: 1})
+	postID := posts.Items[0].ID
+
+	store.LikePost(alice.ID, postID)
+	store.LikePost(bob.ID, postID)
+	store.LikePost(carol.ID, postID)
+	store.CreateComment(postID, &CreateCommentRequest{UserID: bob.ID, Text: "nice"})
+	store.CreateFollow(&FollowRequest{UserID: carol.ID, FollowingID: alice.ID})
+
+	res := doRequest(t, server, http.MethodGet, "/notifications", "", nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodGet, "/notifications", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	notifications := new(NotificationsResponse)
+	decodeBody(t, res, notifications)
+
+	if notifications.UnreadCount != 4 {
+		t.Errorf("Expected 4 unread notifications, alice's own like excluded, got %d", notifications.UnreadCount)
+	}
+	messages := []string{}
+	for _, group := range notifications.Items {
+		messages = append(messages, group.Message)
+	}
+	expected := []string{"carol started following you", "bob commented on your post", "carol and bob liked your post"}
+	if fmt.Sprint(messages) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, messages)
+	}
+
+	// unliking withdraws the notification
+	store.UnlikePost(carol.ID, postID)
+	if count, _ := store.CountUnreadNotifications(alice.ID); count != 3 {
+		t.Errorf("Expected the like notification to be removed on unlike, got %d unread", count)
+	}
+
+	// marking some and then all notifications as read
+	res = doRequest(t, server, http.MethodPost, "/notifications/read", aliceAuth.Token,
+		MarkNotificationsReadRequest{IDs: notifications.Items[0].NotificationIDs})
+	expectStatus(t, res, http.StatusOK)
+	if count, _ := store.CountUnreadNotifications(alice.ID); count != 2 {
+		t.Errorf("Expected 2 unread notifications, got %d", count)
+	}
+
+	res = doRequest(t, server, http.MethodPost, "/notifications/read", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	if count, _ := store.CountUnreadNotifications(alice.ID); count != 2 {
+		t.Errorf("Expected bob not to be able to read alice's notifications, got %d unread", count)
+	}
+
+	res = doRequest(t, server, http.MethodPost, "/notifications/read", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	if count, _ := store.CountUnreadNotifications(alice.ID); count != 0 {
+		t.Errorf("Expected every notification to be read, got %d unread", count)
+	}
+}
+
+func TestConversations(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	_, carolAuth := signUp(t, server, "carol")
+
+	res := doRequest(t, server, http.MethodPost, "/conversations", aliceAuth.Token, CreateConversationRequest{UserName: "bob"})
+	expectStatus(t, res, http.StatusOK)
+	conversation := new(Conversation)
+	decodeBody(t, res, conversation)
+	if len(conversation.Members) != 2 {
+		t.Fatalf("Expected alice and bob to be members, got %+v", conversation.Members)
+	}
+
+	// starting the same conversation from the other side reuses it
+	res = doRequest(t, server, http.MethodPost, "/conversations", bobAuth.Token, CreateConversationRequest{UserName: "alice"})
+	expectStatus(t, res, http.StatusOK)
+	again := new(Conversation)
+	decodeBody(t, res, again)
+	if again.ID != conversation.ID {
+		t.Errorf("Expected conversation %d to be reused, got %d", conversation.ID, again.ID)
+	}
+
+	messagesPath := fmt.Sprintf("/conversations/%d/messages", conversation.ID)
+	for _, content := range []string{"hi bob", "how are you?"} {
+		res = doRequest(t, server, http.MethodPost, messagesPath, aliceAuth.Token, CreateMessageRequest{Content: content, UserID: bob.ID})
+		expectStatus(t, res, http.StatusOK)
+	}
+	res = doRequest(t, server, http.MethodPost, messagesPath, aliceAuth.Token, CreateMessageRequest{Content: "  "})
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res = doRequest(t, server, http.MethodGet, messagesPath, bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	messages := new(Page[*Message])
+	decodeBody(t, res, messages)
+	if len(messages.Items) != 2 || messages.Items[0].Content != "how are you?" || messages.Items[0].UserID != alice.ID {
+		t.Errorf("Expected alice's messages newest first, got %+v", messages.Items)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/conversations", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	conversations := new(Page[*Conversation])
+	decodeBody(t, res, conversations)
+	if len(conversations.Items) != 1 || conversations.Items[0].LastMessage.Content != "how are you?" {
+		t.Errorf("Expected bob's conversation with alice's last message, got %+v", conversations.Items)
+	}
+
+	// only members can read or write
+	res = doRequest(t, server, http.MethodGet, messagesPath, carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+	res = doRequest(t, server, http.MethodPost, messagesPath, carolAuth.Token, CreateMessageRequest{Content: "hey"})
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	// bob only accepts messages from people he follows
+	res = doRequest(t, server, http.MethodPatch, "/bob", bobAuth.Token, CreateUserRequest{AllowMessagesFrom: MessagesFromFollowing})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, "/conversations", carolAuth.Token, CreateConversationRequest{UserName: "bob"})
+	expectStatus(t, res, http.StatusForbidden)
+	res = doRequest(t, server, http.MethodPost, messagesPath, aliceAuth.Token, CreateMessageRequest{Content: "still there?"})
+	expectStatus(t, res, http.StatusForbidden)
+
+	store.CreateFollow(&FollowRequest{UserID: bob.ID, FollowingID: alice.ID})
+	res = doRequest(t, server, http.MethodPost, messagesPath, aliceAuth.Token, CreateMessageRequest{Content: "still there?"})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodPatch, "/bob", bobAuth.Token, CreateUserRequest{AllowMessagesFrom: "nobody"})
+	expectStatus(t, res, http.StatusBadRequest)
+}
+
+func TestGroupConversations(t *testing.T) {
+	server, _ := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	_, carolAuth := signUp(t, server, "carol")
+	signUp(t, server, "dave")
+
+	res := doRequest(t, server, http.MethodPost, "/conversations/groups", aliceAuth.Token, CreateGroupRequest{Title: " ", UserNames: []string{"bob"}})
+	expectStatus(t, res, http.StatusBadRequest)
+	res = doRequest(t, server, http.MethodPost, "/conversations/groups", aliceAuth.Token, CreateGroupRequest{Title: "Trip", UserNames: []string{"bob", "nobody"}})
+	expectStatus(t, res, http.StatusNotFound)
+
+	res = doRequest(t, server, http.MethodPost, "/conversations/groups", aliceAuth.Token, CreateGroupRequest{Title: "Trip", UserNames: []string{"bob", "carol"}})
+	expectStatus(t, res, http.StatusOK)
+	group := new(Conversation)
+	decodeBody(t, res, group)
+	if group.Kind != ConversationGroup || len(group.Members) != 3 {
+		t.Fatalf("Expected a group of three, got %+v", group)
+	}
+	if group.LastMessage == nil || group.LastMessage.Kind != MessageSystem || group.LastMessage.Content != "alice created the group Trip" {
+		t.Errorf("Expected a system message for the new group, got %+v", group.LastMessage)
+	}
+
+	groupPath := fmt.Sprintf("/conversations/%d", group.ID)
+
+	// only admins can manage the group
+	res = doRequest(t, server, http.MethodPatch, groupPath, bobAuth.Token, UpdateGroupRequest{Title: "Bob's trip"})
+	expectStatus(t, res, http.StatusUnauthorized)
+	res = doRequest(t, server, http.MethodPost, groupPath+"/members", bobAuth.Token, AddMembersRequest{UserNames: []string{"dave"}})
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = doRequest(t, server, http.MethodPatch, groupPath, aliceAuth.Token, UpdateGroupRequest{Title: "Road trip"})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, groupPath+"/members", aliceAuth.Token, AddMembersRequest{UserNames: []string{"dave"}})
+	expectStatus(t, res, http.StatusOK)
+	decodeBody(t, res, group)
+	if group.Title != "Road trip" || len(group.Members) != 4 {
+		t.Errorf("Expected the renamed group with dave, got %+v", group)
+	}
+
+	res = doRequest(t, server, http.MethodDelete, groupPath+"/members/carol", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodGet, groupPath+"/messages", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	// members other than the sender don't need to accept direct messages
+	res = doRequest(t, server, http.MethodPatch, "/bob", bobAuth.Token, CreateUserRequest{AllowMessagesFrom: MessagesFromFollowing})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, groupPath+"/messages", aliceAuth.Token, CreateMessageRequest{Content: "who's driving?"})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, groupPath+"/messages", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	messages := new(Page[*Message])
+	decodeBody(t, res, messages)
+	expected := []string{"who's driving?", "alice removed carol", "alice added dave", "alice renamed the group to Road trip", "alice created the group Trip"}
+	if len(messages.Items) != len(expected) {
+		t.Fatalf("Expected %d messages, got %+v", len(expected), messages.Items)
+	}
+	for i, message := range messages.Items {
+		if message.Content != expected[i] {
+			t.Errorf("Expected message %d to be %q, got %q", i, expected[i], message.Content)
+		}
+	}
+
+	// the last admin can't step down but leaving hands the group over
+	res = doRequest(t, server, http.MethodPut, groupPath+"/members/alice", aliceAuth.Token, UpdateMemberRequest{Role: RoleMember})
+	expectStatus(t, res, http.StatusBadRequest)
+	res = doRequest(t, server, http.MethodPost, groupPath+"/leave", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, groupPath, bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	decodeBody(t, res, group)
+	for _, member := range group.Members {
+		if member.UserID == alice.ID {
+			t.Errorf("Expected alice to have left, got %+v", group.Members)
+		}
+		if member.UserID == bob.ID && member.Role != RoleAdmin {
+			t.Errorf("Expected bob to become admin, got %+v", member)
+		}
+	}
+
+	// direct conversations aren't groups
+	res = doRequest(t, server, http.MethodPost, "/conversations", bobAuth.Token, CreateConversationRequest{UserName: "dave"})
+	expectStatus(t, res, http.StatusOK)
+	direct := new(Conversation)
+	decodeBody(t, res, direct)
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/conversations/%d/leave", direct.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+	res = doRequest(t, server, http.MethodPatch, fmt.Sprintf("/conversations/%d", direct.ID), bobAuth.Token, UpdateGroupRequest{Title: "Us"})
+	expectStatus(t, res, http.StatusUnauthorized)
+}
+
+func TestBlocksAndMutes(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	carol, carolAuth := signUp(t, server, "carol")
+
+	store.CreateFollow(&FollowRequest{UserID: bob.ID, FollowingID: alice.ID})
+	store.CreateFollow(&FollowRequest{UserID: carol.ID, FollowingID: alice.ID})
+	post, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "hello"})
+	postPath := fmt.Sprintf("/posts/%d", post.ID)
+	store.CreateComment(post.ID, &CreateCommentRequest{UserID: bob.ID, Text: "first"})
+	store.LikePost(bob.ID, post.ID)
+
+	res := doRequest(t, server, http.MethodPost, "/alice/block", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+	res = doRequest(t, server, http.MethodPost, "/bob/block", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	if following, _ := store.IsFollowing(bob.ID, alice.ID); following {
+		t.Error("Expected blocking to remove bob's follow")
+	}
+
+	// bob can no longer interact with alice, and her posts look gone to him
+	res = doRequest(t, server, http.MethodPost, "/bob/follow", bobAuth.Token, FollowRequest{FollowingID: alice.ID})
+	expectStatus(t, res, http.StatusForbidden)
+	res = doRequest(t, server, http.MethodPost, postPath+"/comments", bobAuth.Token, CreateCommentRequest{Text: "hey"})
+	expectStatus(t, res, http.StatusNotFound)
+	res = doRequest(t, server, http.MethodPost, postPath+"/like", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusNotFound)
+	// likes are always by the token's user, whatever the query says
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("%s/like?userID=%d", postPath, carol.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusNotFound)
+	res = doRequest(t, server, http.MethodGet, postPath+"/comments", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusNotFound)
+	res = doRequest(t, server, http.MethodPost, "/conversations", bobAuth.Token, CreateConversationRequest{UserName: "alice"})
+	expectStatus(t, res, http.StatusForbidden)
+	res = doRequest(t, server, http.MethodGet, "/alice", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+	res = doRequest(t, server, http.MethodGet, "/alice/posts", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusNotFound)
+	// profiles stay public to anonymous viewers
+	res = doRequest(t, server, http.MethodGet, "/alice", "", nil)
+	expectStatus(t, res, http.StatusOK)
+
+	// bob's comment and like are hidden from alice, not from carol
+	for _, viewer := range []struct {
+		token string
+		count int
+	}{{aliceAuth.Token, 0}, {carolAuth.Token, 1}} {
+		res = doRequest(t, server, http.MethodGet, postPath+"/comments", viewer.token, nil)
+		expectStatus(t, res, http.StatusOK)
+		comments := new(Page[*Comment])
+		decodeBody(t, res, comments)
+		if len(comments.Items) != viewer.count {
+			t.Errorf("Expected %d comments, got %+v", viewer.count, comments.Items)
+		}
+		res = doRequest(t, server, http.MethodGet, postPath+"/likes", viewer.token, nil)
+		expectStatus(t, res, http.StatusOK)
+		likes := new(Page[string])
+		decodeBody(t, res, likes)
+		if len(likes.Items) != viewer.count {
+			t.Errorf("Expected %d likes, got %v", viewer.count, likes.Items)
+		}
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/feed", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	feed := new(Page[*Post])
+	decodeBody(t, res, feed)
+	if len(feed.Items) != 0 {
+		t.Errorf("Expected alice's posts to leave bob's feed, got %+v", feed.Items)
+	}
+
+	res = doRequest(t, server, http.MethodDelete, "/bob/block", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, "/bob/follow", bobAuth.Token, FollowRequest{FollowingID: alice.ID})
+	expectStatus(t, res, http.StatusOK)
+
+	// muting only hides alice from carol's feed and notifications
+	carolPost, _ := store.CreatePost(&CreatePostRequest{UserID: carol.ID, Content: "hi"})
+	res = doRequest(t, server, http.MethodPost, "/alice/mute", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/posts/%d/like", carolPost.ID), aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, "/feed", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	feed = new(Page[*Post])
+	decodeBody(t, res, feed)
+	if len(feed.Items) != 1 || feed.Items[0].UserID != carol.ID {
+		t.Errorf("Expected only carol's own post in her feed, got %+v", feed.Items)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/notifications", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	notifications := new(NotificationsResponse)
+	decodeBody(t, res, notifications)
+	if notifications.UnreadCount != 0 || len(notifications.Items) != 0 {
+		t.Errorf("Expected alice's like to be hidden from carol, got %+v", notifications)
+	}
+
+	res = doRequest(t, server, http.MethodDelete, "/alice/mute", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodGet, "/feed", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	feed = new(Page[*Post])
+	decodeBody(t, res, feed)
+	if len(feed.Items) != 2 {
+		t.Errorf("Expected alice's post back in carol's feed, got %+v", feed.Items)
+	}
+}
+
+func TestPrivateAccounts(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	_, carolAuth := signUp(t, server, "carol")
+
+	private := true
+	res := doRequest(t, server, http.MethodPatch, "/alice", aliceAuth.Token, CreateUserRequest{IsPrivate: &private})
+	expectStatus(t, res, http.StatusOK)
+	post, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "for friends"})
+	comment, _ := store.CreateComment(post.ID, &CreateCommentRequest{UserID: alice.ID, Text: "just us"})
+	postPath := fmt.Sprintf("/posts/%d", post.ID)
+	commentPath := fmt.Sprintf("/comments/%d", comment.ID)
+
+	// following a private account only requests it
+	res = doRequest(t, server, http.MethodPost, "/bob/follow", bobAuth.Token, FollowRequest{FollowingID: alice.ID})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, "/carol/follow", carolAuth.Token, FollowRequest{FollowingID: alice.ID})
+	expectStatus(t, res, http.StatusOK)
+	if following, _ := store.IsFollowing(bob.ID, alice.ID); following {
+		t.Fatal("Expected bob's follow to wait for approval")
+	}
+
+	for _, path := range []string{"/alice/posts", "/alice/followers", "/alice/following"} {
+		res = doRequest(t, server, http.MethodGet, path, bobAuth.Token, nil)
+		expectStatus(t, res, http.StatusForbidden)
+	}
+	res = doRequest(t, server, http.MethodGet, "/alice/followers", "", nil)
+	expectStatus(t, res, http.StatusForbidden)
+	res = doRequest(t, server, http.MethodGet, "/alice/posts", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, "/me/follow-requests", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	requests := new(Page[string])
+	decodeBody(t, res, requests)
+	if len(requests.Items) != 2 || requests.Items[0] != "carol" || requests.Items[1] != "bob" {
+		t.Errorf("Expected requests from carol and bob, got %v", requests.Items)
+	}
+
+	res = doRequest(t, server, http.MethodPost, "/me/follow-requests/bob/approve", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, "/me/follow-requests/carol/deny", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, "/me/follow-requests/carol/approve", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res = doRequest(t, server, http.MethodGet, "/alice/posts", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	posts := new(Page[*Post])
+	decodeBody(t, res, posts)
+	if len(posts.Items) != 1 {
+		t.Errorf("Expected bob to see alice's post once approved, got %+v", posts.Items)
+	}
+	res = doRequest(t, server, http.MethodGet, "/alice/posts", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusForbidden)
+
+	res = doRequest(t, server, http.MethodGet, "/notifications", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	notifications := new(NotificationsResponse)
+	decodeBody(t, res, notifications)
+	if len(notifications.Items) != 1 || notifications.Items[0].Message != "alice accepted your follow request" {
+		t.Errorf("Expected bob to hear his request was accepted, got %+v", notifications.Items)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/notifications", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	notifications = new(NotificationsResponse)
+	decodeBody(t, res, notifications)
+	if len(notifications.Items) != 0 {
+		t.Errorf("Expected handled requests to leave alice's notifications, got %+v", notifications.Items)
+	}
+
+	// the engagement on alice's posts is as private as the posts
+	for _, req := range []struct {
+		method, path string
+		body         any
+		status       int
+	}{
+		{http.MethodGet, postPath + "/comments", nil, http.StatusOK},
+		{http.MethodPost, postPath + "/comments", CreateCommentRequest{Text: "hey"}, http.StatusCreated},
+		{http.MethodGet, postPath + "/likes", nil, http.StatusOK},
+		{http.MethodPost, postPath + "/like", nil, http.StatusOK},
+		{http.MethodGet, postPath + "/reactions", nil, http.StatusOK},
+		{http.MethodPost, postPath + "/reactions", ReactionRequest{Reaction: "❤️"}, http.StatusOK},
+		{http.MethodGet, commentPath + "/replies", nil, http.StatusOK},
+		{http.MethodPost, commentPath + "/replies", CreateCommentRequest{Text: "hey"}, http.StatusOK},
+		{http.MethodPost, commentPath + "/like", nil, http.StatusOK},
+		{http.MethodGet, commentPath + "/reactions", nil, http.StatusOK},
+	} {
+		res = doRequest(t, server, req.method, req.path, carolAuth.Token, req.body)
+		expectStatus(t, res, http.StatusForbidden)
+		res = doRequest(t, server, req.method, req.path, bobAuth.Token, req.body)
+		expectStatus(t, res, req.status)
+	}
+}
+
+func TestReposts(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	carol, carolAuth := signUp(t, server, "carol")
+	store.CreateFollow(&FollowRequest{UserID: carol.ID, FollowingID: bob.ID})
+	original, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "worth sharing"})
+	path := fmt.Sprintf("/posts/%d", original.ID)
+
+	res := doRequest(t, server, http.MethodPost, path+"/repost", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	repost := new(Post)
+	decodeBody(t, res, repost)
+	if idOrZero(repost.RepostOfID) != original.ID || repost.Original == nil || repost.Original.Content != "worth sharing" {
+		t.Fatalf("Expected a repost of alice's post, got %+v", repost)
+	}
+	res = doRequest(t, server, http.MethodPost, path+"/repost", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+
+	// the repost reaches bob's followers and shows up among bob's posts
+	res = doRequest(t, server, http.MethodGet, "/feed", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	feed := new(Page[*Post])
+	decodeBody(t, res, feed)
+	if len(feed.Items) != 1 || feed.Items[0].ID != repost.ID || feed.Items[0].Original.ID != original.ID {
+		t.Errorf("Expected bob's repost in carol's feed, got %+v", feed.Items)
+	}
+
+	// quoting a repost quotes the original
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/posts/%d/quote", repost.ID), carolAuth.Token, CreatePostRequest{})
+	expectStatus(t, res, http.StatusBadRequest)
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/posts/%d/quote", repost.ID), carolAuth.Token, CreatePostRequest{Content: "so true"})
+	expectStatus(t, res, http.StatusOK)
+	quote := new(Post)
+	decodeBody(t, res, quote)
+	if idOrZero(quote.QuoteOfID) != original.ID || quote.RepostOfID != nil {
+		t.Errorf("Expected a quote of alice's post, got %+v", quote)
+	}
+
+	post, _ := store.GetPost(original.ID)
+	if post.Reposts != 2 {
+		t.Errorf("Expected 2 reposts, got %d", post.Reposts)
+	}
+	res = doRequest(t, server, http.MethodGet, "/notifications", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	notifications := new(NotificationsResponse)
+	decodeBody(t, res, notifications)
+	if len(notifications.Items) != 2 || notifications.Items[0].Message != "carol quoted your post" ||
+		notifications.Items[1].Message != "bob reposted your post" {
+		t.Errorf("Expected alice to hear about the repost and quote, got %+v", notifications.Items)
+	}
+
+	res = doRequest(t, server, http.MethodDelete, path+"/repost", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	if post, _ := store.GetPost(original.ID); post.Reposts != 1 {
+		t.Errorf("Expected 1 repost after undoing bob's, got %d", post.Reposts)
+	}
+	res = doRequest(t, server, http.MethodPost, path+"/repost", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	// deleting the original removes its reposts but keeps quotes
+	res = doRequest(t, server, http.MethodDelete, path, aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	bobPosts, _ := store.GetUserPosts("bob", &PageRequest{Limit: 20})
+	if len(bobPosts.Items) != 0 {
+		t.Errorf("Expected bob's repost to be deleted with the original, got %+v", bobPosts.Items)
+	}
+	quote, _ = store.GetPost(quote.ID)
+	if quote == nil || quote.Original != nil || idOrZero(quote.QuoteOfID) != original.ID {
+		t.Errorf("Expected carol's quote to outlive the original, got %+v", quote)
+	}
+	res = doRequest(t, server, http.MethodPost, path+"/repost", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusNotFound)
+}
+
+func TestCommentReplies(t *testing.T) {
+	t.Setenv("COMMENT_MAX_DEPTH", "2")
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	_, carolAuth := signUp(t, server, "carol")
+	post, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "thoughts?"})
+	comment, _ := store.CreateComment(post.ID, &CreateCommentRequest{UserID: bob.ID, Text: "first"})
+
+	reply := func(commentID int64, auth *LoginResponse, text string) *Comment {
+		res := doRequest(t, server, http.MethodPost, fmt.Sprintf("/comments/%d/replies", commentID), auth.Token, CreateCommentRequest{Text: text})
+		expectStatus(t, res, http.StatusOK)
+		reply := new(Comment)
+		decodeBody(t, res, reply)
+		return reply
+	}
+	first := reply(comment.ID, carolAuth, "agreed")
+	second := reply(first.ID, bobAuth, "thanks")
+	// replies past the max depth are attached to the parent of the comment
+	// they reply to
+	third := reply(second.ID, aliceAuth, "me too")
+	if first.Depth != 1 || second.Depth != 2 || third.Depth != 2 || idOrZero(third.ParentCommentID) != first.ID {
+		t.Fatalf("Expected replies nested up to depth 2, got %+v, %+v and %+v", first, second, third)
+	}
+	for _, text := range []string{"one", "two", "three"} {
+		reply(comment.ID, carolAuth, text)
+	}
+
+	res := doRequest(t, server, http.MethodGet, fmt.Sprintf("/posts/%d/comments", post.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	comments := new(Page[*Comment])
+	decodeBody(t, res, comments)
+	if len(comments.Items) != 1 || comments.Items[0].ReplyCount != 4 || len(comments.Items[0].Replies) != replyPreviewSize ||
+		comments.Items[0].Replies[0].Text != "three" {
+		t.Fatalf("Expected the top-level comment with a preview of its latest replies, got %+v", comments.Items)
+	}
+
+	res = doRequest(t, server, http.MethodGet, fmt.Sprintf("/posts/%d/comments?view=threaded", post.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	comments = new(Page[*Comment])
+	decodeBody(t, res, comments)
+	replies := comments.Items[0].Replies
+	if len(replies) != 4 || replies[3].ID != first.ID || len(replies[3].Replies) != 2 || replies[3].Replies[0].ID != third.ID {
+		t.Fatalf("Expected the reply tree, got %+v", replies)
+	}
+	res = doRequest(t, server, http.MethodGet, fmt.Sprintf("/posts/%d/comments?view=flat", post.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res = doRequest(t, server, http.MethodGet, fmt.Sprintf("/comments/%d/replies", first.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	page := new(Page[*Comment])
+	decodeBody(t, res, page)
+	if len(page.Items) != 2 || page.Items[0].ID != third.ID || page.Items[1].ID != second.ID {
+		t.Errorf("Expected the replies to carol's comment, got %+v", page.Items)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/notifications", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	notifications := new(NotificationsResponse)
+	decodeBody(t, res, notifications)
+	if len(notifications.Items) != 2 || notifications.Items[0].Message != "alice replied to your comment" ||
+		notifications.Items[1].Message != "bob replied to your comment" {
+		t.Errorf("Expected carol to hear about replies to her comment, got %+v", notifications.Items)
+	}
+
+	// deleting a comment deletes its replies
+	res = doRequest(t, server, http.MethodDelete, fmt.Sprintf("/comments/%d", comment.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	if reply, _ := store.GetComment(third.ID); reply != nil {
+		t.Errorf("Expected replies to be deleted with their comment, got %+v", reply)
+	}
+}
+
+func TestReactions(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	_, bobAuth := signUp(t, server, "bob")
+	_, carolAuth := signUp(t, server, "carol")
+	post, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "big news"})
+	comment, _ := store.CreateComment(post.ID, &CreateCommentRequest{UserID: alice.ID, Text: "details soon"})
+	path := fmt.Sprintf("/posts/%d/reactions", post.ID)
+
+	res := doRequest(t, server, http.MethodGet, "/reactions", "", nil)
+	expectStatus(t, res, http.StatusOK)
+	reactions := []string{}
+	decodeBody(t, res, &reactions)
+	if len(reactions) != 6 || reactions[0] != "👍" {
+		t.Fatalf("Expected the default reactions, got %v", reactions)
+	}
+
+	res = doRequest(t, server, http.MethodPost, path, bobAuth.Token, ReactionRequest{Reaction: "❤️"})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, path, carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, path, carolAuth.Token, ReactionRequest{Reaction: "🦄"})
+	expectStatus(t, res, http.StatusBadRequest)
+	// the like routes react with the default reaction
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/posts/%d/like", post.ID), aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	got, _ := store.GetPost(post.ID)
+	if len(got.Reactions) != 2 || got.Reactions["👍"] != 2 || got.Reactions["❤️"] != 1 {
+		t.Errorf("Expected 2 👍 and 1 ❤️, got %v", got.Reactions)
+	}
+
+	res = doRequest(t, server, http.MethodGet, path+"?reaction=%E2%9D%A4%EF%B8%8F", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	reactedBy := new(Page[string])
+	decodeBody(t, res, reactedBy)
+	if len(reactedBy.Items) != 1 || reactedBy.Items[0] != "bob" {
+		t.Errorf("Expected bob to have reacted with ❤️, got %v", reactedBy.Items)
+	}
+	res = doRequest(t, server, http.MethodGet, fmt.Sprintf("/posts/%d/likes", post.ID), aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	reactedBy = new(Page[string])
+	decodeBody(t, res, reactedBy)
+	if len(reactedBy.Items) != 2 || reactedBy.Items[0] != "alice" || reactedBy.Items[1] != "carol" {
+		t.Errorf("Expected alice and carol to have liked the post, got %v", reactedBy.Items)
+	}
+
+	// changing a reaction replaces it, along with its notification
+	res = doRequest(t, server, http.MethodPost, path, carolAuth.Token, ReactionRequest{Reaction: "😂"})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodDelete, path, bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	if got, _ := store.GetPost(post.ID); len(got.Reactions) != 2 || got.Reactions["👍"] != 1 || got.Reactions["😂"] != 1 {
+		t.Errorf("Expected 1 👍 and 1 😂, got %v", got.Reactions)
+	}
+	res = doRequest(t, server, http.MethodGet, "/notifications", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	notifications := new(NotificationsResponse)
+	decodeBody(t, res, notifications)
+	if len(notifications.Items) != 1 || notifications.Items[0].Message != "carol reacted to your post" {
+		t.Errorf("Expected only carol's reaction to be notified, got %+v", notifications.Items)
+	}
+
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/comments/%d/reactions", comment.ID), bobAuth.Token, ReactionRequest{Reaction: "😮"})
+	expectStatus(t, res, http.StatusOK)
+	if got, _ := store.GetComment(comment.ID); got.Reactions["😮"] != 1 {
+		t.Errorf("Expected 1 😮 on the comment, got %v", got.Reactions)
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	_, bobAuth := signUp(t, server, "bob")
+	_, carolAuth := signUp(t, server, "carol")
+	first, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "pasta recipe"})
+	second, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "pizza recipe"})
+
+	res := doRequest(t, server, http.MethodPost, "/me/collections", bobAuth.Token, CollectionRequest{Name: "Recipes"})
+	expectStatus(t, res, http.StatusOK)
+	collection := new(Collection)
+	decodeBody(t, res, collection)
+	res = doRequest(t, server, http.MethodPost, "/me/collections", bobAuth.Token, CollectionRequest{Name: " Recipes "})
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/posts/%d/bookmark", first.ID), bobAuth.Token, BookmarkRequest{CollectionID: &collection.ID})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/posts/%d/bookmark", second.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	// collections are private to their owner
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/posts/%d/bookmark", first.ID), carolAuth.Token, BookmarkRequest{CollectionID: &collection.ID})
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res = doRequest(t, server, http.MethodGet, "/me/bookmarks", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	bookmarks := new(Page[*Bookmark])
+	decodeBody(t, res, bookmarks)
+	if len(bookmarks.Items) != 2 || bookmarks.Items[0].Post.ID != second.ID || bookmarks.Items[1].Post.ID != first.ID {
+		t.Fatalf("Expected bob's 2 bookmarks, newest first, got %+v", bookmarks.Items)
+	}
+	res = doRequest(t, server, http.MethodGet, fmt.Sprintf("/me/bookmarks?collection=%d", collection.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	bookmarks = new(Page[*Bookmark])
+	decodeBody(t, res, bookmarks)
+	if len(bookmarks.Items) != 1 || bookmarks.Items[0].Post.Content != "pasta recipe" {
+		t.Errorf("Expected only the bookmark in Recipes, got %+v", bookmarks.Items)
+	}
+	res = doRequest(t, server, http.MethodGet, "/me/bookmarks", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	bookmarks = new(Page[*Bookmark])
+	decodeBody(t, res, bookmarks)
+	if len(bookmarks.Items) != 0 {
+		t.Errorf("Expected bookmarks to be private, got %+v", bookmarks.Items)
+	}
+
+	res = doRequest(t, server, http.MethodPatch, fmt.Sprintf("/me/collections/%d", collection.ID), bobAuth.Token, CollectionRequest{Name: "Dinner"})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodGet, "/me/collections", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	collections := new(Page[*Collection])
+	decodeBody(t, res, collections)
+	if len(collections.Items) != 1 || collections.Items[0].Name != "Dinner" || collections.Items[0].Bookmarks != 1 {
+		t.Errorf("Expected the renamed collection with 1 bookmark, got %+v", collections.Items)
+	}
+
+	// deleting a post deletes its bookmarks, deleting a collection keeps them
+	res = doRequest(t, server, http.MethodDelete, fmt.Sprintf("/posts/%d", second.ID), aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodDelete, fmt.Sprintf("/me/collections/%d", collection.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	page, _ := store.GetBookmarks(collection.UserID, nil, &PageRequest{Limit: 20})
+	if len(page.Items) != 1 || page.Items[0].Post.ID != first.ID || page.Items[0].CollectionID != nil {
+		t.Errorf("Expected the pasta bookmark outside of any collection, got %+v", page.Items)
+	}
+
+	private := true
+	res = doRequest(t, server, http.MethodPatch, "/alice", aliceAuth.Token, CreateUserRequest{IsPrivate: &private})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodPost, fmt.Sprintf("/posts/%d/bookmark", first.ID), carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusForbidden)
+}
+
+func TestHashtags(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	first, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "learning #Go"})
+	second, _ := store.CreatePost(&CreatePostRequest{UserID: bob.ID, Content: "#go #golang all day"})
+
+	res := doRequest(t, server, http.MethodGet, "/tags/GO", "", nil)
+	expectStatus(t, res, http.StatusOK)
+	posts := new(Page[*Post])
+	decodeBody(t, res, posts)
+	if len(posts.Items) != 2 || posts.Items[0].ID != second.ID || posts.Items[1].ID != first.ID {
+		t.Fatalf("Expected both posts tagged #go, newest first, got %+v", posts.Items)
+	}
+	res = doRequest(t, server, http.MethodGet, "/tags/not-a-tag", "", nil)
+	expectStatus(t, res, http.StatusBadRequest)
+
+	// editing a post re-indexes its hashtags
+	res = doRequest(t, server, http.MethodPatch, fmt.Sprintf("/posts/%d", first.ID), aliceAuth.Token, CreatePostRequest{Content: "learning #rust"})
+	expectStatus(t, res, http.StatusOK)
+	page, _ := store.GetTagPosts("go", 0, &PageRequest{Limit: 20})
+	if len(page.Items) != 1 || page.Items[0].ID != second.ID {
+		t.Errorf("Expected only bob's post tagged #go, got %+v", page.Items)
+	}
+	page, _ = store.GetTagPosts("rust", 0, &PageRequest{Limit: 20})
+	if len(page.Items) != 1 || page.Items[0].ID != first.ID {
+		t.Errorf("Expected alice's edited post tagged #rust, got %+v", page.Items)
+	}
+
+	// mutes don't hide posts from tag pages, blocks do
+	store.MuteUser(alice.ID, bob.ID)
+	page, _ = store.GetTagPosts("golang", alice.ID, &PageRequest{Limit: 20})
+	if len(page.Items) != 1 {
+		t.Errorf("Expected alice to still see bob's post once muted, got %+v", page.Items)
+	}
+	store.BlockUser(alice.ID, bob.ID)
+	page, _ = store.GetTagPosts("golang", alice.ID, &PageRequest{Limit: 20})
+	if len(page.Items) != 0 {
+		t.Errorf("Expected bob's post to be hidden from alice once blocked, got %+v", page.Items)
+	}
+	store.UnblockUser(alice.ID, bob.ID)
+	store.UnmuteUser(alice.ID, bob.ID)
+
+	// posts of private accounts are only listed for their followers
+	private := true
+	res = doRequest(t, server, http.MethodPatch, "/bob", bobAuth.Token, CreateUserRequest{IsPrivate: &private})
+	expectStatus(t, res, http.StatusOK)
+	page, _ = store.GetTagPosts("golang", alice.ID, &PageRequest{Limit: 20})
+	if len(page.Items) != 0 {
+		t.Errorf("Expected bob's private post to be hidden, got %+v", page.Items)
+	}
+	page, _ = store.GetTagPosts("golang", bob.ID, &PageRequest{Limit: 20})
+	if len(page.Items) != 1 {
+		t.Errorf("Expected bob to see his own post, got %+v", page.Items)
+	}
+
+	res = doRequest(t, server, http.MethodDelete, fmt.Sprintf("/posts/%d", second.ID), bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	page, _ = store.GetTagPosts("golang", bob.ID, &PageRequest{Limit: 20})
+	if len(page.Items) != 0 {
+		t.Errorf("Expected deleted posts to be unindexed, got %+v", page.Items)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	carol, carolAuth := signUp(t, server, "carol")
+	post, _ := store.CreatePost(&CreatePostRequest{UserID: bob.ID, Content: "hi @alice and @nobody, bye @alice"})
+	if len(post.Mentions) != 2 || post.Mentions[1].UserID != alice.ID || post.Mentions[1].Offset != 27 || post.Mentions[1].Length != 6 {
+		t.Fatalf("Expected alice to be mentioned twice, got %+v", post.Mentions)
+	}
+
+	res := doRequest(t, server, http.MethodPost, fmt.Sprintf("/posts/%d/comments", post.ID), carolAuth.Token, CreateCommentRequest{Text: "@alice look"})
+	expectStatus(t, res, http.StatusCreated)
+	res = doRequest(t, server, http.MethodGet, "/me/mentions", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	mentions := new(Page[*UserMention])
+	decodeBody(t, res, mentions)
+	if len(mentions.Items) != 2 || mentions.Items[0].Comment == nil || mentions.Items[0].Comment.Mentions[0].UserName != "alice" ||
+		mentions.Items[1].Comment != nil || mentions.Items[1].Post.ID != post.ID {
+		t.Fatalf("Expected carol's comment then bob's post, got %+v", mentions.Items)
+	}
+	if unread, _ := store.CountUnreadNotifications(alice.ID); unread != 2 {
+		t.Errorf("Expected 2 mention notifications, got %d", unread)
+	}
+
+	// editing the mention out removes it and its notification
+	res = doRequest(t, server, http.MethodPatch, fmt.Sprintf("/posts/%d", post.ID), bobAuth.Token, CreatePostRequest{Content: "hi @carol"})
+	expectStatus(t, res, http.StatusOK)
+	page, _ := store.GetMentions(alice.ID, &PageRequest{Limit: 20})
+	if len(page.Items) != 1 || page.Items[0].Comment == nil {
+		t.Errorf("Expected only carol's comment to mention alice, got %+v", page.Items)
+	}
+	if unread, _ := store.CountUnreadNotifications(alice.ID); unread != 1 {
+		t.Errorf("Expected 1 mention notification, got %d", unread)
+	}
+	page, _ = store.GetMentions(carol.ID, &PageRequest{Limit: 20})
+	if len(page.Items) != 1 || page.Items[0].Post.Mentions[0].UserID != carol.ID {
+		t.Errorf("Expected bob's edited post to mention carol, got %+v", page.Items)
+	}
+
+	// mentions are notifications: muting the author of the post a mention is
+	// on doesn't hide it, muting whoever mentioned you does
+	res = doRequest(t, server, http.MethodPost, "/bob/mute", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	page, _ = store.GetMentions(alice.ID, &PageRequest{Limit: 20})
+	if len(page.Items) != 1 {
+		t.Errorf("Expected carol's mention on bob's post to stay, got %+v", page.Items)
+	}
+	res = doRequest(t, server, http.MethodPost, "/carol/mute", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	page, _ = store.GetMentions(alice.ID, &PageRequest{Limit: 20})
+	if len(page.Items) != 0 {
+		t.Errorf("Expected carol's mention to be hidden, got %+v", page.Items)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, _ := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+	carol, carolAuth := signUp(t, server, "carol")
+	best, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "pasta pasta night"})
+	other, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "a new pasta recipe for tonight"})
+	store.CreatePost(&CreatePostRequest{UserID: bob.ID, Content: "secret pasta"})
+	store.CreateComment(other.ID, &CreateCommentRequest{UserID: carol.ID, Text: "I love pasta"})
+	private := true
+	store.UpdateUser("bob", &UpdateUserRequest{IsPrivate: &private})
+
+	res := doRequest(t, server, http.MethodGet, "/search?q=Pasta&limit=1", "", nil)
+	expectStatus(t, res, http.StatusOK)
+	results := new(Page[*SearchResult])
+	decodeBody(t, res, results)
+	if len(results.Items) != 1 || results.Items[0].Post.ID != best.ID || results.Items[0].Snippet != "<mark>pasta</mark> <mark>pasta</mark> night" {
+		t.Fatalf("Expected the best ranked post first, got %+v", results.Items)
+	}
+	res = doRequest(t, server, http.MethodGet, "/search?q=Pasta&limit=1&cursor="+results.NextCursor, "", nil)
+	expectStatus(t, res, http.StatusOK)
+	results = new(Page[*SearchResult])
+	decodeBody(t, res, results)
+	if len(results.Items) != 1 || results.Items[0].Post.ID != other.ID || results.NextCursor != "" {
+		t.Fatalf("Expected the other public post on the last page, got %+v", results.Items)
+	}
+
+	// bob's private post is only found by his followers
+	page, _ := store.SearchPosts(&SearchRequest{Query: "pasta", Limit: 20}, bob.ID)
+	if len(page.Items) != 3 {
+		t.Errorf("Expected bob to find his own post, got %+v", page.Items)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/search?q=love+pasta&type=comments", "", nil)
+	expectStatus(t, res, http.StatusOK)
+	results = new(Page[*SearchResult])
+	decodeBody(t, res, results)
+	if len(results.Items) != 1 || results.Items[0].Comment.Text != "I love pasta" {
+		t.Errorf("Expected carol's comment, got %+v", results.Items)
+	}
+
+	// muting only hides from the feed and notifications, not from search
+	store.MuteUser(bob.ID, alice.ID)
+	store.MuteUser(bob.ID, carol.ID)
+	page, _ = store.SearchPosts(&SearchRequest{Query: "pasta", Limit: 20}, bob.ID)
+	if len(page.Items) != 3 {
+		t.Errorf("Expected bob to still find alice's posts once muted, got %+v", page.Items)
+	}
+	page, _ = store.SearchComments(&SearchRequest{Query: "pasta", Limit: 20}, bob.ID)
+	if len(page.Items) != 1 {
+		t.Errorf("Expected bob to still find carol's comment once muted, got %+v", page.Items)
+	}
+
+	res = doRequest(t, server, http.MethodPost, "/carol/block", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodGet, "/search?q=bob&type=users", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	results = new(Page[*SearchResult])
+	decodeBody(t, res, results)
+	if len(results.Items) != 0 {
+		t.Errorf("Expected bob to be hidden from carol, got %+v", results.Items)
+	}
+	res = doRequest(t, server, http.MethodGet, "/search?q=bob&type=users", "", nil)
+	expectStatus(t, res, http.StatusOK)
+	results = new(Page[*SearchResult])
+	decodeBody(t, res, results)
+	if len(results.Items) != 1 || results.Items[0].User.UserName != "bob" || !results.Items[0].User.IsPrivate {
+		t.Errorf("Expected to find bob's private account, got %+v", results.Items)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/search?q=pasta&type=groups", "", nil)
+	expectStatus(t, res, http.StatusBadRequest)
+	res = doRequest(t, server, http.MethodGet, "/search?q=+", "", nil)
+	expectStatus(t, res, http.StatusBadRequest)
+}
+
+func TestAutocompleteUsers(t *testing.T) {
+	server, store := newTestServer(t)
+	_, aliceAuth := signUp(t, server, "alice")
+	signUp(t, server, "edwina")
+	signUp(t, server, "ed_b")
+	eddicus, _ := signUp(t, server, "eddicus")
+	store.UpdateUser("alice", &UpdateUserRequest{Name: "Edith Alice"})
+	res := doRequest(t, server, http.MethodPost, "/alice/follow", aliceAuth.Token, FollowRequest{FollowingID: eddicus.ID})
+	expectStatus(t, res, http.StatusOK)
+
+	res = doRequest(t, server, http.MethodGet, "/users/autocomplete?prefix=@Ed", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	users := []*UserSummary{}
+	decodeBody(t, res, &users)
+	names := []string{}
+	for _, user := range users {
+		names = append(names, user.UserName)
+	}
+	// followed users first, then shorter usernames, the caller is left out
+	if fmt.Sprint(names) != "[eddicus ed_b edwina]" || users[0].UserID != eddicus.ID {
+		t.Fatalf("Expected eddicus, ed_b then edwina, got %v", names)
+	}
+
+	// LIKE wildcards are matched literally
+	res = doRequest(t, server, http.MethodGet, "/users/autocomplete?prefix=ed_&limit=5", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	users = []*UserSummary{}
+	decodeBody(t, res, &users)
+	if len(users) != 1 || users[0].UserName != "ed_b" {
+		t.Errorf("Expected only ed_b, got %+v", users)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/users/autocomplete?prefix=", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+	res = doRequest(t, server, http.MethodGet, "/users/autocomplete?prefix=ed", "", nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+}
+
+func TestSuggestions(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	bob, _ := signUp(t, server, "bob")
+	carol, _ := signUp(t, server, "carol")
+	dave, _ := signUp(t, server, "dave")
+	erin, _ := signUp(t, server, "erin")
+	frank, _ := signUp(t, server, "frank")
+	follow := func(userID, followingID int64) {
+		if err := store.CreateFollow(&FollowRequest{UserID: userID, FollowingID: followingID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// alice follows bob and carol, who both follow dave and alice
+	follow(alice.ID, bob.ID)
+	follow(alice.ID, carol.ID)
+	follow(bob.ID, dave.ID)
+	follow(carol.ID, dave.ID)
+	follow(bob.ID, erin.ID)
+	follow(carol.ID, frank.ID)
+	follow(bob.ID, alice.ID)
+	follow(carol.ID, alice.ID)
+	follow(bob.ID, carol.ID)
+
+	res := doRequest(t, server, http.MethodGet, "/me/suggestions", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	suggestions := []*Suggestion{}
+	decodeBody(t, res, &suggestions)
+	if len(suggestions) != 3 || suggestions[0].User.UserID != dave.ID || suggestions[0].Mutuals != 2 ||
+		suggestions[1].User.UserID != erin.ID || suggestions[2].User.UserID != frank.ID {
+		t.Fatalf("Expected dave with 2 mutuals then erin and frank, got %+v", suggestions)
+	}
+
+	// private, blocked and muted accounts aren't suggested
+	private := true
+	store.UpdateUser("erin", &UpdateUserRequest{IsPrivate: &private})
+	res = doRequest(t, server, http.MethodPost, "/frank/mute", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	store.BlockUser(dave.ID, alice.ID)
+	res = doRequest(t, server, http.MethodGet, "/me/suggestions?limit=1", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	suggestions = []*Suggestion{}
+	decodeBody(t, res, &suggestions)
+	if len(suggestions) != 0 {
+		t.Errorf("Expected no suggestions, got %+v", suggestions)
+	}
+}
+
+func TestTrending(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, _ := signUp(t, server, "alice")
+	bob, _ := signUp(t, server, "bob")
+	carol, carolAuth := signUp(t, server, "carol")
+	first, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "hello #go"})
+	second, _ := store.CreatePost(&CreatePostRequest{UserID: bob.ID, Content: "hi #go #rust"})
+	store.LikePost(carol.ID, first.ID)
+	store.CreateComment(first.ID, &CreateCommentRequest{UserID: bob.ID, Text: "welcome"})
+	store.LikePost(alice.ID, second.ID)
+	store.CreatePost(&CreatePostRequest{UserID: carol.ID, RepostOfID: &second.ID})
+
+	res := doRequest(t, server, http.MethodGet, "/trending", "", nil)
+	expectStatus(t, res, http.StatusOK)
+	trending := new(Trending)
+	decodeBody(t, res, trending)
+	if trending.Window != "24h" || len(trending.Posts) != 2 ||
+		trending.Posts[0].Post.ID != second.ID || trending.Posts[1].Post.ID != first.ID {
+		t.Fatalf("Expected bob's reposted post then alice's, got %+v", trending.Posts)
+	}
+	if len(trending.Tags) != 2 || trending.Tags[0].Tag != "go" || trending.Tags[0].Authors != 2 {
+		t.Fatalf("Expected #go then #rust, got %+v", trending.Tags)
+	}
+
+	// muting isn't enough to hide a post from trending
+	store.MuteUser(carol.ID, alice.ID)
+	res = doRequest(t, server, http.MethodGet, "/trending?limit=5", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	trending = new(Trending)
+	decodeBody(t, res, trending)
+	if len(trending.Posts) != 2 {
+		t.Errorf("Expected carol to still see alice's post once muted, got %+v", trending.Posts)
+	}
+
+	// cached results are still filtered for the viewer
+	store.BlockUser(carol.ID, alice.ID)
+	res = doRequest(t, server, http.MethodGet, "/trending?limit=5", carolAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	trending = new(Trending)
+	decodeBody(t, res, trending)
+	if len(trending.Posts) != 1 || trending.Posts[0].Post.ID != second.ID {
+		t.Errorf("Expected alice's post to be hidden from carol, got %+v", trending.Posts)
+	}
+
+	res = doRequest(t, server, http.MethodGet, "/trending?window=1y", "", nil)
+	expectStatus(t, res, http.StatusBadRequest)
+}
+
+func TestDecodeOptionalJson(t *testing.T) {
+	// a chunked request has an unknown length, even when its body is empty
+	r := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(bytes.NewReader(nil)))
+	req := &ReactionRequest{Reaction: "🔥"}
+	if err := decodeOptionalJson(r, req); err != nil || req.Reaction != "🔥" {
+		t.Errorf("Expected an empty body to leave the request as is, got %+v, %v", req, err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"reaction":"😂"}`)))
+	if err := decodeOptionalJson(r, req); err != nil || req.Reaction != "😂" {
+		t.Errorf("Expected the body to be decoded, got %+v, %v", req, err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"reaction":`)))
+	if err := decodeOptionalJson(r, req); err == nil {
+		t.Error("Expected a truncated body to fail")
+	}
+}
@@ -1,19 +1,40 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"runtime"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func CreateAccessToken(user *User) (string, error) {
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type contextKey string
+
+const (
+	userIDContextKey    contextKey = "userID"
+	sessionIDContextKey contextKey = "sessionID"
+)
+
+func CreateAccessToken(user *User, sessionID string) (string, error) {
 	claims := jwt.MapClaims{
-		"userID": user.ID,
-		"exp":    time.Now().Add(15 * time.Minute).Unix(), // standard JWT exp (Unix timestamp)
+		"userID":    user.ID,
+		"sessionID": sessionID,
+		"exp":       time.Now().Add(accessTokenTTL).Unix(), // standard JWT exp (Unix timestamp)
 	}
 
 	secret := os.Getenv("JWT_SECRET")
@@ -40,6 +61,23 @@ func generateHash(pw string) (string, error) {
 	return string(passwordHash), nil
 }
 
+// generateRandomToken returns n random bytes encoded as hex, used for
+// session IDs and opaque refresh tokens
+func generateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashRefreshToken returns the SHA-256 of a refresh token encoded as hex.
+// Only hashes are stored, so a leaked sessions table can't be used to refresh.
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
 func authoriseCurrentUser(handlerFunc http.HandlerFunc, s Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("x-jwt-token")
@@ -51,6 +89,7 @@ func authoriseCurrentUser(handlerFunc http.HandlerFunc, s Storage) http.HandlerF
 		}
 
 		claims := token.Claims.(jwt.MapClaims)
+		userID := int64(claims["userID"].(float64))
 
 		// check expiry
 		expUnix := int64(claims["exp"].(float64))
@@ -59,6 +98,12 @@ func authoriseCurrentUser(handlerFunc http.HandlerFunc, s Storage) http.HandlerF
 			return
 		}
 
+		sessionID, ok := validSession(userID, claims, s)
+		if !ok {
+			permissionDenied(w)
+			return
+		}
+
 		username := getUserName(r)
 		user, err := s.GetUserByName(username)
 		if err != nil {
@@ -66,12 +111,12 @@ func authoriseCurrentUser(handlerFunc http.HandlerFunc, s Storage) http.HandlerF
 			return
 		}
 
-		if user.ID != int64(claims["userID"].(float64)) {
+		if user.ID != userID {
 			permissionDenied(w)
 			return
 		}
 
-		handlerFunc(w, r)
+		handlerFunc(w, withAuth(r, userID, sessionID))
 	}
 }
 
@@ -99,25 +144,31 @@ func resourceBasedJWTauth(handlerFunc http.HandlerFunc, s Storage, resourceType
 			return
 		}
 
+		sessionID, ok := validSession(userID, claims, s)
+		if !ok {
+			permissionDenied(w)
+			return
+		}
+
 		resourceID, err := getID(r)
 		if err != nil {
 			permissionDenied(w)
 			return
 		}
 
-		ok, _ := validateOwnership(userID, resourceID, resourceType, s)
+		ok, _ = validateOwnership(userID, resourceID, resourceType, s)
 		if !ok {
 			permissionDenied(w)
 			return
 		}
 
-		handlerFunc(w, r)
+		handlerFunc(w, withAuth(r, userID, sessionID))
 	}
 }
 
 func verifyUser(handlerFunc http.HandlerFunc, s Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("x-jwt-token")
+		tokenString := getTokenString(r)
 
 		token, err := ValidateJWT(tokenString)
 		if err != nil || !token.Valid {
@@ -135,15 +186,109 @@ func verifyUser(handlerFunc http.HandlerFunc, s Storage) http.HandlerFunc {
 			return
 		}
 
+		sessionID, ok := validSession(userID, claims, s)
+		if !ok {
+			permissionDenied(w)
+			return
+		}
+
 		if _, err := s.GetUserByID(userID); err != nil {
 			permissionDenied(w)
 			return
 		}
 
-		handlerFunc(w, r)
+		handlerFunc(w, withAuth(r, userID, sessionID))
+	}
+}
+
+// identifyUser authenticates the request like verifyUser when it carries a
+// token, but lets anonymous requests through for routes anyone can see
+func identifyUser(handlerFunc http.HandlerFunc, s Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := getTokenString(r)
+		if tokenString == "" {
+			handlerFunc(w, r)
+			return
+		}
+		verifyUser(handlerFunc, s)(w, r)
 	}
 }
 
+// getTokenString reads the access token from the x-jwt-token header. Browsers
+// can't set headers on WebSocket handshakes, so upgrade requests may pass it
+// as the ?token= query param instead
+func getTokenString(r *http.Request) string {
+	tokenString := r.Header.Get("x-jwt-token")
+	if tokenString == "" && websocket.IsWebSocketUpgrade(r) {
+		tokenString = r.URL.Query().Get("token")
+	}
+	return tokenString
+}
+
+// newRequestLogger logs requests like middleware.Logger, with the ?token=
+// query param redacted so access tokens passed on WebSocket handshakes don't
+// end up in logs
+func newRequestLogger() func(http.Handler) http.Handler {
+	return middleware.RequestLogger(&redactTokenFormatter{
+		&middleware.DefaultLogFormatter{Logger: log.New(os.Stdout, "", log.LstdFlags), NoColor: runtime.GOOS == "windows"},
+	})
+}
+
+type redactTokenFormatter struct {
+	middleware.LogFormatter
+}
+
+func (f *redactTokenFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	query := r.URL.Query()
+	if !query.Has("token") {
+		return f.LogFormatter.NewLogEntry(r)
+	}
+
+	query.Set("token", "REDACTED")
+	redacted := r.Clone(r.Context())
+	redacted.URL.RawQuery = query.Encode()
+	redacted.RequestURI = redacted.URL.RequestURI()
+	return f.LogFormatter.NewLogEntry(redacted)
+}
+
+// validSession checks that the session a token was issued for still exists
+// and belongs to the token's user, so logged out, revoked and blocked sessions
+// can't keep using an unexpired access token
+func validSession(userID int64, claims jwt.MapClaims, s Storage) (string, bool) {
+	sessionID, ok := claims["sessionID"].(string)
+	if !ok || sessionID == "" {
+		return "", false
+	}
+
+	session, err := s.GetSession(sessionID)
+	if err != nil || session == nil {
+		return "", false
+	}
+
+	if session.UserID != userID || session.IsBlocked || time.Now().After(session.ExpirationTime) {
+		return "", false
+	}
+
+	return sessionID, true
+}
+
+// withAuth stores the authenticated user and session on the request context
+func withAuth(r *http.Request, userID int64, sessionID string) *http.Request {
+	ctx := context.WithValue(r.Context(), userIDContextKey, userID)
+	ctx = context.WithValue(ctx, sessionIDContextKey, sessionID)
+	return r.WithContext(ctx)
+}
+
+func getAuthUserID(r *http.Request) int64 {
+	userID, _ := r.Context().Value(userIDContextKey).(int64)
+	return userID
+}
+
+func getAuthSessionID(r *http.Request) string {
+	sessionID, _ := r.Context().Value(sessionIDContextKey).(string)
+	return sessionID
+}
+
 func validateOwnership(userID, resourceID int64, resourceType string, s Storage) (bool, error) {
 	if resourceType == "post" {
 		post, err := s.GetPost(resourceID)
@@ -173,6 +318,18 @@ func validateOwnership(userID, resourceID int64, resourceType string, s Storage)
 		return true, nil
 	}
 
+	if resourceType == "conversation" {
+		return s.IsConversationMember(resourceID, userID)
+	}
+
+	if resourceType == "groupAdmin" {
+		member, err := s.GetConversationMember(resourceID, userID)
+		if err != nil {
+			return false, err
+		}
+		return member != nil && member.Role == RoleAdmin, nil
+	}
+
 	return false, fmt.Errorf("invalid resource type: %v", resourceType)
 }
 
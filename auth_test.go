@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"log"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-jwt/jwt/v4"
 )
 
@@ -27,7 +33,7 @@ var (
 
 func TestCreateAccessToken(t *testing.T) {
 	// Call CreateAccessToken function
-	tokenString, err := CreateAccessToken(&user)
+	tokenString, err := CreateAccessToken(&user, "test-session")
 	if err != nil {
 		t.Errorf("CreateAccessToken returned an error: %v", err)
 	}
@@ -53,6 +59,11 @@ func TestCreateAccessToken(t *testing.T) {
 		t.Errorf("UserID claim is incorrect. Expected: %d, Got: %d", user.ID, userID)
 	}
 
+	// Check if the sessionID claim is correct
+	if sessionID := claims["sessionID"].(string); sessionID != "test-session" {
+		t.Errorf("SessionID claim is incorrect. Expected: test-session, Got: %s", sessionID)
+	}
+
 	// Check if the exp claim is within ~15 minutes
 	expUnix := int64(claims["exp"].(float64))
 	expiresAt := time.Unix(expUnix, 0)
@@ -67,7 +78,7 @@ func TestCreateAccessToken(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	// Create a token for the mock user
-	tokenString, _ := CreateAccessToken(&user)
+	tokenString, _ := CreateAccessToken(&user, "test-session")
 
 	// Call ValidateJWT function with the generated token
 	token, err := ValidateJWT(tokenString)
@@ -109,8 +120,52 @@ func TestGenerateHash(t *testing.T) {
 	}
 }
 
+func TestNewSession(t *testing.T) {
+	session, refreshToken, err := NewSession(user.ID)
+	if err != nil {
+		t.Fatalf("NewSession returned an error: %v", err)
+	}
+
+	if session.UserID != user.ID {
+		t.Errorf("UserID is incorrect. Expected: %d, Got: %d", user.ID, session.UserID)
+	}
+
+	if session.ID == "" || refreshToken == "" {
+		t.Error("Session ID and refresh token must not be empty")
+	}
+	if session.RefreshToken != hashRefreshToken(refreshToken) {
+		t.Error("Sessions should only hold the hash of their refresh token")
+	}
+
+	if !session.ExpirationTime.After(time.Now().Add(refreshTokenTTL - time.Minute)) {
+		t.Errorf("ExpirationTime is too early: %v", session.ExpirationTime)
+	}
+
+	_, otherRefreshToken, _ := NewSession(user.ID)
+	if otherRefreshToken == refreshToken {
+		t.Error("Refresh tokens should be unique per session")
+	}
+}
+
 // helper to provide a consistent JWT secret for tests
 func getTestSecret() string {
 	secret := "test_secret"
 	return secret
 }
+
+func TestRedactTokenFormatter(t *testing.T) {
+	var logs bytes.Buffer
+	formatter := &redactTokenFormatter{&middleware.DefaultLogFormatter{Logger: log.New(&logs, "", 0), NoColor: true}}
+	var seen string
+	handler := middleware.RequestLogger(formatter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.Query().Get("token")
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ws?token=secret&x=1", nil))
+	if strings.Contains(logs.String(), "secret") || !strings.Contains(logs.String(), "token=REDACTED") {
+		t.Errorf("Expected the token to be redacted from logs, got %q", logs.String())
+	}
+	if seen != "secret" {
+		t.Errorf("Expected the handler to still get the token, got %q", seen)
+	}
+}
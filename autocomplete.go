@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultAutocompleteLimit = 8
+	maxAutocompleteLimit     = 20
+	// autocompleteTimeout bounds how long a lookup may take, the composer
+	// queries on every keystroke so a slow answer is as good as none
+	autocompleteTimeout = 250 * time.Millisecond
+	// autocompleteCacheTTL is how long results are reused for, short enough
+	// that new follows and blocks show up quickly
+	autocompleteCacheTTL        = 15 * time.Second
+	autocompleteCacheSize       = 10000
+	maxAutocompletePrefixLength = 50
+)
+
+// autocompleteCache keeps recent autocomplete results in process, keyed by
+// the user asking, the prefix and the limit
+type autocompleteCache struct {
+	mu      sync.Mutex
+	entries map[string]*autocompleteEntry
+}
+
+type autocompleteEntry struct {
+	users     []*UserSummary
+	expiresAt time.Time
+}
+
+func newAutocompleteCache() *autocompleteCache {
+	return &autocompleteCache{entries: map[string]*autocompleteEntry{}}
+}
+
+func autocompleteKey(viewerID int64, prefix string, limit int) string {
+	return fmt.Sprintf("%d:%d:%s", viewerID, limit, prefix)
+}
+
+func (c *autocompleteCache) get(key string) ([]*UserSummary, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.users, true
+}
+
+func (c *autocompleteCache) set(key string, users []*UserSummary) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= autocompleteCacheSize {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	// still full of fresh entries, drop arbitrary ones to make room
+	for k := range c.entries {
+		if len(c.entries) < autocompleteCacheSize {
+			break
+		}
+		delete(c.entries, k)
+	}
+	c.entries[key] = &autocompleteEntry{users: users, expiresAt: now.Add(autocompleteCacheTTL)}
+}
+
+// getAutocompleteRequest reads the ?prefix= and ?limit= query params. The
+// prefix is lowercased, with a leading @ dropped so clients can pass what was
+// typed as is.
+func getAutocompleteRequest(r *http.Request) (string, int, error) {
+	prefix := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("prefix")), "@"))
+	if prefix == "" {
+		return "", 0, fmt.Errorf("Missing prefix")
+	}
+	if utf8.RuneCountInString(prefix) > maxAutocompletePrefixLength {
+		return "", 0, fmt.Errorf("Prefix is too long, the maximum is %d characters", maxAutocompletePrefixLength)
+	}
+
+	limit := defaultAutocompleteLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return "", 0, fmt.Errorf("Invalid limit: %v", limitStr)
+		}
+		if limit > maxAutocompleteLimit {
+			limit = maxAutocompleteLimit
+		}
+	}
+	return prefix, limit, nil
+}
+
+// escapeLike escapes the LIKE wildcards of s so it's matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// autocompleteMatch reports whether user's username or name starts with
+// prefix, and whether it's their username that does
+func autocompleteMatch(user *User, prefix string) (bool, bool) {
+	byUserName := strings.HasPrefix(strings.ToLower(user.UserName), prefix)
+	return byUserName || strings.HasPrefix(strings.ToLower(user.Name), prefix), byUserName
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutocompleteCache(t *testing.T) {
+	cache := newAutocompleteCache()
+	key := autocompleteKey(1, "ed", 8)
+	if _, ok := cache.get(key); ok {
+		t.Fatal("Expected an empty cache")
+	}
+
+	cache.set(key, []*UserSummary{{UserID: 2, UserName: "eddicus"}})
+	users, ok := cache.get(key)
+	if !ok || len(users) != 1 || users[0].UserName != "eddicus" {
+		t.Fatalf("Expected the cached results, got %+v", users)
+	}
+	if _, ok := cache.get(autocompleteKey(3, "ed", 8)); ok {
+		t.Error("Expected results to be cached per user")
+	}
+
+	cache.entries[key].expiresAt = time.Now().Add(-time.Second)
+	if _, ok := cache.get(key); ok {
+		t.Error("Expected expired results to be dropped")
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`50%_off\`); got != `50\%\_off\\` {
+		t.Errorf("escapeLike = %q", got)
+	}
+}
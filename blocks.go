@@ -0,0 +1,7 @@
+package main
+
+import "fmt"
+
+// errBlocked is returned by the store when an interaction is refused because
+// one of the users involved blocked the other
+var errBlocked = fmt.Errorf("you can't interact with this user")
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxCollectionNameLength = 100
+
+func validateCollectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("Collection name can't be empty")
+	}
+	if utf8.RuneCountInString(name) > maxCollectionNameLength {
+		return "", fmt.Errorf("Collection name can't be longer than %d characters", maxCollectionNameLength)
+	}
+	return name, nil
+}
+
+func bookmarkCursor(bookmark *Bookmark) Cursor {
+	return Cursor{CreatedAt: bookmark.Created_at, ID: bookmark.ID}
+}
+
+func collectionCursor(collection *Collection) Cursor {
+	return Cursor{CreatedAt: collection.Created_at, ID: collection.ID}
+}
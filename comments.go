@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Comments form threads: a reply has a parentCommentID and is one level
+// deeper than its parent, top-level comments being at depth 0. Replies that
+// would go deeper than the max depth are attached to the parent of the
+// comment they reply to instead, so threads stop nesting past it.
+const (
+	defaultMaxCommentDepth = 5
+
+	// replyPreviewSize is how many of its latest replies a top-level comment
+	// is listed with
+	replyPreviewSize = 3
+
+	// threadRepliesSize is how many of its latest replies every comment of a
+	// threaded view is listed with, and threadSize how many replies a page of
+	// them is listed with in all, shallowest first. Replies left out are read
+	// with GET /comments/{id}/replies.
+	threadRepliesSize = 20
+	threadSize        = 200
+)
+
+// Views of the comments of a post, either top-level comments with a preview
+// of their replies or top-level comments with their reply tree
+const (
+	CommentsViewPreview  = "preview"
+	CommentsViewThreaded = "threaded"
+)
+
+// maxCommentDepth reads COMMENT_MAX_DEPTH, the deepest level replies nest to
+func maxCommentDepth() int {
+	depth, err := strconv.Atoi(os.Getenv("COMMENT_MAX_DEPTH"))
+	if err != nil || depth < 0 {
+		return defaultMaxCommentDepth
+	}
+	return depth
+}
+
+// replyParent returns where a reply to parent is attached and at which depth,
+// following the max depth rule above
+func replyParent(parent *Comment, maxDepth int) (*int64, int) {
+	if parent.Depth < maxDepth {
+		return &parent.ID, parent.Depth + 1
+	}
+	return parent.ParentCommentID, parent.Depth
+}
+
+// nestReplies attaches replies, sorted newest first, to their parents among
+// comments and the replies themselves
+func nestReplies(comments []*Comment, replies []*Comment) {
+	byID := map[int64]*Comment{}
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+	for _, reply := range replies {
+		byID[reply.ID] = reply
+	}
+	for _, reply := range replies {
+		if parent, ok := byID[idOrZero(reply.ParentCommentID)]; ok {
+			parent.Replies = append(parent.Replies, reply)
+		}
+	}
+}
+
+// getCommentsView reads the ?view= query param, defaulting to previews
+func getCommentsView(r *http.Request) (string, error) {
+	view := r.URL.Query().Get("view")
+	switch view {
+	case "", CommentsViewPreview:
+		return CommentsViewPreview, nil
+	case CommentsViewThreaded:
+		return CommentsViewThreaded, nil
+	}
+	return "", fmt.Errorf("Invalid view: %v", view)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Event types pushed to connected clients
+const (
+	EventPostCreated      = "post.created"
+	EventCommentCreated   = "comment.created"
+	EventPostLiked        = "post.liked"
+	EventCommentLiked     = "comment.liked"
+	EventUserFollowed     = "user.followed"
+	EventNotification     = "notification.created"
+	EventMessageCreated   = "message.created"
+	EventConversationRead = "conversation.read"
+	// EventResync starts a resumed stream that may have missed events, for
+	// the client to refetch what it shows
+	EventResync = "stream.resync"
+	// typing and presence events are ephemeral, they aren't replayed to
+	// reconnecting clients
+	EventTyping   = "typing.started"
+	EventPresence = "presence.changed"
+)
+
+type Event struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+type LikeEvent struct {
+	UserID    int64  `json:"userID"`
+	PostID    int64  `json:"postID"`
+	CommentID *int64 `json:"commentID,omitempty"`
+	Reaction  string `json:"reaction"`
+}
+
+type NotificationEvent struct {
+	UnreadCount int `json:"unreadCount"`
+}
+
+type FollowEvent struct {
+	FollowerID  int64 `json:"followerID"`
+	FollowingID int64 `json:"followingID"`
+}
+
+type ReadEvent struct {
+	ConversationID int64 `json:"conversationID"`
+	UserID         int64 `json:"userID"`
+	MessageID      int64 `json:"messageID"`
+}
+
+type TypingEvent struct {
+	ConversationID int64  `json:"conversationID"`
+	UserID         int64  `json:"userID"`
+	UserName       string `json:"userName"`
+}
+
+type PresenceEvent struct {
+	UserID     int64      `json:"userID"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+// The publish helpers below push events to the users who care about them.
+// They run after the change has been stored, so failing to look up who to
+// notify is only logged rather than failing the request.
+
+// publishPost sends a new post to its author and everyone whose feed it's in
+func (s *ApiServer) publishPost(post *Post) {
+	followers, err := s.Store.GetFollowerIDs(post.UserID)
+	if err != nil {
+		log.Printf("failed to get followers of user %d: %v", post.UserID, err)
+		return
+	}
+	mutedBy, err := s.Store.GetMutedByIDs(post.UserID)
+	if err != nil {
+		log.Printf("failed to get users who muted user %d: %v", post.UserID, err)
+		return
+	}
+
+	muters := map[int64]bool{}
+	for _, id := range mutedBy {
+		muters[id] = true
+	}
+	recipients := []int64{post.UserID}
+	for _, id := range followers {
+		if !muters[id] {
+			recipients = append(recipients, id)
+		}
+	}
+	s.Hub.Publish(&Event{Type: EventPostCreated, Data: post}, recipients...)
+}
+
+// publishComment sends a new comment to the author of the post and, for
+// replies, to the author of the comment replied to
+func (s *ApiServer) publishComment(comment *Comment) {
+	post, err := s.Store.GetPost(comment.PostID)
+	if err != nil || post == nil {
+		log.Printf("failed to get post %d: %v", comment.PostID, err)
+		return
+	}
+	recipients := []int64{post.UserID}
+	if comment.ParentCommentID != nil {
+		parent, err := s.Store.GetComment(*comment.ParentCommentID)
+		if err != nil || parent == nil {
+			log.Printf("failed to get comment %d: %v", *comment.ParentCommentID, err)
+			return
+		}
+		if parent.UserID != post.UserID {
+			recipients = append(recipients, parent.UserID)
+		}
+	}
+
+	for _, userID := range recipients {
+		if userID != comment.UserID && !s.mutedBy(userID, comment.UserID) {
+			s.Hub.Publish(&Event{Type: EventCommentCreated, Data: comment}, userID)
+			s.publishUnreadCount(userID)
+		}
+	}
+}
+
+// publishShare tells the author of the post a repost or quote shares that they
+// have a new notification
+func (s *ApiServer) publishShare(post *Post) {
+	if post.Original == nil {
+		return
+	}
+	authorID := post.Original.UserID
+	if authorID != post.UserID && !s.mutedBy(authorID, post.UserID) {
+		s.publishUnreadCount(authorID)
+	}
+}
+
+// publishMentions tells the users mentioned by authorID that they have a new
+// notification
+func (s *ApiServer) publishMentions(authorID int64, mentions Mentions) {
+	published := map[int64]bool{authorID: true}
+	for _, mention := range mentions {
+		if !published[mention.UserID] && !s.mutedBy(mention.UserID, authorID) {
+			s.publishUnreadCount(mention.UserID)
+		}
+		published[mention.UserID] = true
+	}
+}
+
+func (s *ApiServer) publishPostLike(userID, postID int64, reaction string) {
+	post, err := s.Store.GetPost(postID)
+	if err != nil || post == nil {
+		log.Printf("failed to get post %d: %v", postID, err)
+		return
+	}
+	if post.UserID != userID && !s.mutedBy(post.UserID, userID) {
+		s.Hub.Publish(&Event{Type: EventPostLiked, Data: &LikeEvent{UserID: userID, PostID: postID, Reaction: reaction}}, post.UserID)
+		s.publishUnreadCount(post.UserID)
+	}
+}
+
+func (s *ApiServer) publishCommentLike(userID, commentID int64, reaction string) {
+	comment, err := s.Store.GetComment(commentID)
+	if err != nil || comment == nil {
+		log.Printf("failed to get comment %d: %v", commentID, err)
+		return
+	}
+	if comment.UserID != userID && !s.mutedBy(comment.UserID, userID) {
+		event := &LikeEvent{UserID: userID, PostID: comment.PostID, CommentID: &commentID, Reaction: reaction}
+		s.Hub.Publish(&Event{Type: EventCommentLiked, Data: event}, comment.UserID)
+		s.publishUnreadCount(comment.UserID)
+	}
+}
+
+func (s *ApiServer) publishFollow(req *FollowRequest) {
+	if s.mutedBy(req.FollowingID, req.UserID) {
+		return
+	}
+	event := &FollowEvent{FollowerID: req.UserID, FollowingID: req.FollowingID}
+	s.Hub.Publish(&Event{Type: EventUserFollowed, Data: event}, req.FollowingID)
+	s.publishUnreadCount(req.FollowingID)
+}
+
+// mutedBy reports whether userID muted actorID, whose actions then aren't
+// pushed to them
+func (s *ApiServer) mutedBy(userID, actorID int64) bool {
+	muted, err := s.Store.IsMuted(userID, actorID)
+	if err != nil {
+		log.Printf("failed to check if user %d muted user %d: %v", userID, actorID, err)
+	}
+	return muted
+}
+
+// blockedWith reports whether userID and otherID blocked each other either
+// way, in which case neither is told what the other is doing
+func (s *ApiServer) blockedWith(userID, otherID int64) bool {
+	blocked, err := s.Store.IsBlocked(userID, otherID)
+	if err != nil {
+		log.Printf("failed to check if users %d and %d blocked each other: %v", userID, otherID, err)
+	}
+	return blocked
+}
+
+// publishUnreadCount tells userID they have a new notification, with their
+// unread count so clients can update a badge without refetching
+func (s *ApiServer) publishUnreadCount(userID int64) {
+	unread, err := s.Store.CountUnreadNotifications(userID)
+	if err != nil {
+		log.Printf("failed to count notifications of user %d: %v", userID, err)
+		return
+	}
+	s.Hub.Publish(&Event{Type: EventNotification, Data: &NotificationEvent{UnreadCount: unread}}, userID)
+}
+
+// publishMessage sends a new message to every member of its conversation and
+// to others, such as members who were just removed
+func (s *ApiServer) publishMessage(conversation *Conversation, message *Message, others ...int64) {
+	for _, member := range conversation.Members {
+		others = append(others, member.UserID)
+	}
+	s.Hub.Publish(&Event{Type: EventMessageCreated, Data: message}, others...)
+}
+
+// publishReadReceipt tells the other members of a conversation how far userID
+// has read. Receipts only go between members who haven't hidden them.
+func (s *ApiServer) publishReadReceipt(conversation *Conversation, userID, messageID int64) {
+	recipients := []int64{}
+	for _, member := range conversation.Members {
+		if member.UserID == userID && member.HideReadReceipts {
+			return
+		}
+		if member.UserID != userID && !member.HideReadReceipts {
+			recipients = append(recipients, member.UserID)
+		}
+	}
+	event := &ReadEvent{ConversationID: conversation.ID, UserID: userID, MessageID: messageID}
+	s.Hub.Publish(&Event{Type: EventConversationRead, Data: event}, recipients...)
+}
+
+// publishTyping tells the other members of a conversation that user is
+// typing, but for those who blocked or were blocked by them
+func (s *ApiServer) publishTyping(conversation *Conversation, user *User) {
+	recipients := []int64{}
+	for _, member := range conversation.Members {
+		if member.UserID != user.ID && !s.blockedWith(user.ID, member.UserID) {
+			recipients = append(recipients, member.UserID)
+		}
+	}
+	event := &TypingEvent{ConversationID: conversation.ID, UserID: user.ID, UserName: user.UserName}
+	s.Hub.PublishEphemeral(&Event{Type: EventTyping, Data: event}, recipients...)
+}
+
+// publishPresence tells everyone sharing a conversation with userID that they
+// came online or went offline, users blocked either way being left out by
+// GetConversationPartnerIDs
+func (s *ApiServer) publishPresence(userID int64, online bool, lastSeenAt *time.Time) {
+	partners, err := s.Store.GetConversationPartnerIDs(userID)
+	if err != nil {
+		log.Printf("failed to get conversation partners of user %d: %v", userID, err)
+		return
+	}
+	event := &PresenceEvent{UserID: userID, Online: online, LastSeenAt: lastSeenAt}
+	s.Hub.PublishEphemeral(&Event{Type: EventPresence, Data: event}, partners...)
+}
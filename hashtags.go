@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxHashtagLength = 100
+
+// hashtagPattern matches a # followed by letters, digits and underscores,
+// unless it's glued to a preceding word or is an HTML entity such as &#39;
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])#([\p{L}\p{N}_]+)`)
+
+// extractHashtags returns the distinct, normalised hashtags of a post's
+// content in the order they first appear
+func extractHashtags(content string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(content, -1) {
+		tag, ok := normalizeHashtag(match[1])
+		if ok && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// normalizeHashtag lowercases a hashtag, with or without its leading #, and
+// reports whether it's valid: made of letters, digits and underscores, with
+// at least one letter so that "#1" isn't a hashtag
+func normalizeHashtag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if tag == "" || utf8.RuneCountInString(tag) > maxHashtagLength {
+		return "", false
+	}
+
+	hasLetter := false
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return "", false
+		}
+		hasLetter = hasLetter || unicode.IsLetter(r)
+	}
+	return tag, hasLetter
+}
+
+func getHashtag(tag string) (string, error) {
+	normalized, ok := normalizeHashtag(tag)
+	if !ok {
+		return "", fmt.Errorf("Invalid hashtag: %v", tag)
+	}
+	return normalized, nil
+}
+
+// containsTag reports whether tags holds tag
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
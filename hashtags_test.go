@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"no tags here", []string{}},
+		{"#Go is #fun, #go!", []string{"go", "fun"}},
+		{"issue#12 and #42 aren't tags, #año_2024 is", []string{"año_2024"}},
+		{"it&#39;s #ok\n#multi\tline", []string{"ok", "multi"}},
+		{"##double #", []string{}},
+	}
+
+	for _, test := range tests {
+		if got := extractHashtags(test.content); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("extractHashtags(%q) = %v, want %v", test.content, got, test.want)
+		}
+	}
+}
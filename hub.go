@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// maxConnectionsPerUser caps how many live connections a single user can
+	// hold, e.g. a few devices and browser tabs
+	maxConnectionsPerUser = 5
+	// subscriberBufferSize is how many events can queue up for a connection
+	// before it's considered too slow and dropped
+	subscriberBufferSize = 64
+	// replayBufferSize is how many recent events are kept per user so that
+	// clients reconnecting with a Last-Event-ID can catch up
+	replayBufferSize = 100
+	// replayRetention is how long the replay buffer of a user is kept after
+	// their last connection ends, for them to reconnect
+	replayRetention = 10 * time.Minute
+)
+
+var (
+	errTooManyConnections = fmt.Errorf("too many connections")
+	errTooSlow            = fmt.Errorf("connection too slow")
+	errServerShutdown     = fmt.Errorf("server shutting down")
+)
+
+// Hub is an in-process pub/sub of events addressed to users. Every live
+// connection subscribes to the events of its user; publishing never blocks,
+// a subscriber whose buffer is full is closed instead so one slow client
+// can't hold up everyone else.
+//
+// Events get increasing ids, and the latest ones of every user who has
+// connected recently are kept in a bounded replay buffer so a client can
+// resume a stream without missing what happened while it was reconnecting.
+// Ids are the publishing time in microseconds, bumped when events are
+// published within the same microsecond, so they keep increasing across
+// restarts. A client resuming from an event the buffer no longer covers, after
+// a restart or a long disconnection, first gets a stream.resync event.
+type Hub struct {
+	mu          sync.Mutex
+	lastEventID int64
+	subscribers map[int64]map[*Subscriber]bool
+	replay      map[int64]*replayBuffer
+	// disconnectedAt holds when users without connections lost their last
+	// one, until their replay buffer is dropped
+	disconnectedAt map[int64]time.Time
+}
+
+// replayBuffer holds the latest events of a user, every event of theirs with
+// an id above since being in events
+type replayBuffer struct {
+	since  int64
+	events []*Event
+}
+
+type Subscriber struct {
+	UserID int64
+	Events chan *Event
+
+	// done is closed when the hub drops the subscriber or its connection ends,
+	// err being why the hub dropped it
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		lastEventID:    time.Now().UnixMicro(),
+		subscribers:    map[int64]map[*Subscriber]bool{},
+		replay:         map[int64]*replayBuffer{},
+		disconnectedAt: map[int64]time.Time{},
+	}
+}
+
+// Subscribe registers a connection of userID, the caller must Unsubscribe it
+// when the connection ends. The buffered events published after lastEventID
+// are returned for the caller to send first, a lastEventID of 0 replays
+// nothing, along with how many connections userID has now.
+func (h *Hub) Subscribe(userID, lastEventID int64) (*Subscriber, []*Event, int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subscribers[userID]) >= maxConnectionsPerUser {
+		return nil, nil, 0, errTooManyConnections
+	}
+
+	sub := &Subscriber{
+		UserID: userID,
+		Events: make(chan *Event, subscriberBufferSize),
+		done:   make(chan struct{}),
+	}
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = map[*Subscriber]bool{}
+	}
+	h.subscribers[userID][sub] = true
+	delete(h.disconnectedAt, userID)
+	h.prune(time.Now())
+
+	buffer, ok := h.replay[userID]
+	if !ok {
+		buffer = &replayBuffer{since: h.lastEventID}
+		h.replay[userID] = buffer
+	}
+
+	missed := []*Event{}
+	if lastEventID > 0 {
+		if lastEventID < buffer.since {
+			// events published between lastEventID and since may be lost
+			missed = append(missed, &Event{ID: buffer.since, Type: EventResync})
+		}
+		for _, event := range buffer.events {
+			if event.ID > lastEventID {
+				missed = append(missed, event)
+			}
+		}
+	}
+	return sub, missed, len(h.subscribers[userID]), nil
+}
+
+// Unsubscribe ends a connection, returning how many connections its user has
+// left
+func (h *Hub) Unsubscribe(sub *Subscriber) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subscribers[sub.UserID], sub)
+	connections := len(h.subscribers[sub.UserID])
+	if connections == 0 {
+		delete(h.subscribers, sub.UserID)
+		h.disconnectedAt[sub.UserID] = time.Now()
+	}
+	h.prune(time.Now())
+	sub.close()
+	return connections
+}
+
+// prune drops the replay buffers of users who have been disconnected for
+// longer than replayRetention
+func (h *Hub) prune(now time.Time) {
+	for userID, disconnectedAt := range h.disconnectedAt {
+		if now.Sub(disconnectedAt) > replayRetention {
+			delete(h.replay, userID)
+			delete(h.disconnectedAt, userID)
+		}
+	}
+}
+
+// Publish assigns event the next id and sends it to every connection of the
+// given users
+func (h *Hub) Publish(event *Event, userIDs ...int64) {
+	h.publish(event, true, userIDs)
+}
+
+// PublishEphemeral is like Publish but leaves event out of the replay
+// buffer, for events such as typing indicators that are stale by the time a
+// client reconnects
+func (h *Hub) PublishEphemeral(event *Event, userIDs ...int64) {
+	h.publish(event, false, userIDs)
+}
+
+// Close drops every subscriber, for the server to end the connections it
+// can't wait for when shutting down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			sub.drop(errServerShutdown)
+		}
+	}
+}
+
+// Connections returns how many live connections userID has
+func (h *Hub) Connections(userID int64) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers[userID])
+}
+
+func (h *Hub) publish(event *Event, replay bool, userIDs []int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastEventID = nextEventID(h.lastEventID, time.Now())
+	event.ID = h.lastEventID
+
+	for _, userID := range userIDs {
+		if buffer, ok := h.replay[userID]; ok && replay {
+			if len(buffer.events) == replayBufferSize {
+				buffer.since = buffer.events[0].ID
+				buffer.events = buffer.events[1:]
+			}
+			buffer.events = append(buffer.events, event)
+		}
+
+		for sub := range h.subscribers[userID] {
+			select {
+			case sub.Events <- event:
+			default:
+				// the client isn't keeping up, drop it rather than block
+				sub.drop(errTooSlow)
+			}
+		}
+	}
+}
+
+// nextEventID returns the id of an event published at now, after an event
+// with the id lastEventID
+func nextEventID(lastEventID int64, now time.Time) int64 {
+	if id := now.UnixMicro(); id > lastEventID {
+		return id
+	}
+	return lastEventID + 1
+}
+
+// Done is closed when the subscriber has been dropped by the hub
+func (sub *Subscriber) Done() <-chan struct{} {
+	return sub.done
+}
+
+// Err returns why the hub dropped the subscriber once Done is closed, nil
+// when its connection ended
+func (sub *Subscriber) Err() error {
+	return sub.err
+}
+
+func (sub *Subscriber) close() {
+	sub.drop(nil)
+}
+
+func (sub *Subscriber) drop(err error) {
+	sub.closeOnce.Do(func() {
+		sub.err = err
+		close(sub.done)
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHubPublish(t *testing.T) {
+	hub := NewHub()
+	alice, _, _, _ := hub.Subscribe(1, 0)
+	bob, _, _, _ := hub.Subscribe(2, 0)
+
+	hub.Publish(&Event{Type: EventPostCreated}, 1)
+
+	if len(alice.Events) != 1 {
+		t.Errorf("Expected alice to receive the event, got %d events", len(alice.Events))
+	}
+	if len(bob.Events) != 0 {
+		t.Errorf("Expected bob not to receive the event, got %d events", len(bob.Events))
+	}
+
+	hub.Unsubscribe(alice)
+	hub.Publish(&Event{Type: EventPostCreated}, 1)
+	if len(alice.Events) != 1 {
+		t.Error("Expected no events after unsubscribing")
+	}
+}
+
+func TestHubConnectionLimit(t *testing.T) {
+	hub := NewHub()
+	subs := []*Subscriber{}
+	for i := 0; i < maxConnectionsPerUser; i++ {
+		sub, _, _, err := hub.Subscribe(1, 0)
+		if err != nil {
+			t.Fatalf("Subscribe returned an error: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	if _, _, _, err := hub.Subscribe(1, 0); err != errTooManyConnections {
+		t.Errorf("Expected errTooManyConnections, got %v", err)
+	}
+
+	hub.Unsubscribe(subs[0])
+	if _, _, _, err := hub.Subscribe(1, 0); err != nil {
+		t.Errorf("Expected a freed slot to be reusable, got %v", err)
+	}
+}
+
+func TestHubConnectionCounts(t *testing.T) {
+	hub := NewHub()
+	phone, _, connections, _ := hub.Subscribe(1, 0)
+	if connections != 1 {
+		t.Errorf("Expected a first connection, got %d", connections)
+	}
+	laptop, _, connections, _ := hub.Subscribe(1, 0)
+	if connections != 2 {
+		t.Errorf("Expected a second connection, got %d", connections)
+	}
+
+	if left := hub.Unsubscribe(phone); left != 1 {
+		t.Errorf("Expected one connection left, got %d", left)
+	}
+	if left := hub.Unsubscribe(laptop); left != 0 {
+		t.Errorf("Expected no connections left, got %d", left)
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub()
+	sub, _, _, _ := hub.Subscribe(1, 0)
+
+	for i := 0; i < subscriberBufferSize; i++ {
+		hub.Publish(&Event{Type: EventPostCreated}, 1)
+	}
+	select {
+	case <-sub.Done():
+		t.Fatal("Expected the subscriber to be kept while its buffer has room")
+	default:
+	}
+
+	hub.Publish(&Event{Type: EventPostCreated}, 1)
+	select {
+	case <-sub.Done():
+		if sub.Err() != errTooSlow {
+			t.Errorf("Expected the subscriber to be dropped for being too slow, got %v", sub.Err())
+		}
+	default:
+		t.Error("Expected the subscriber to be dropped once its buffer is full")
+	}
+
+	// a subscriber whose connection ended wasn't dropped by the hub
+	other, _, _, _ := hub.Subscribe(2, 0)
+	hub.Unsubscribe(other)
+	if other.Err() != nil {
+		t.Errorf("Expected no error for an ended connection, got %v", other.Err())
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub()
+	alice, _, _, _ := hub.Subscribe(1, 0)
+	bob, _, _, _ := hub.Subscribe(2, 0)
+
+	hub.Close()
+	for _, sub := range []*Subscriber{alice, bob} {
+		select {
+		case <-sub.Done():
+			if sub.Err() != errServerShutdown {
+				t.Errorf("Expected the subscriber to be dropped for the shutdown, got %v", sub.Err())
+			}
+		default:
+			t.Error("Expected every subscriber to be dropped")
+		}
+	}
+}
+
+func TestHubReplay(t *testing.T) {
+	hub := NewHub()
+	sub, _, _, _ := hub.Subscribe(1, 0)
+	ids := []int64{}
+	for i := 0; i < replayBufferSize+10; i++ {
+		event := &Event{Type: EventPostCreated}
+		hub.Publish(event, 1)
+		<-sub.Events
+		ids = append(ids, event.ID)
+	}
+	hub.Unsubscribe(sub)
+
+	_, missed, _, _ := hub.Subscribe(1, ids[104])
+	if len(missed) != 5 || missed[0].ID != ids[105] {
+		t.Errorf("Expected the last 5 events to be replayed, got %d events", len(missed))
+	}
+
+	// events 0 to 9 were dropped from the buffer
+	_, missed, _, _ = hub.Subscribe(1, ids[0])
+	if len(missed) != replayBufferSize+1 || missed[0].Type != EventResync || missed[1].ID != ids[10] {
+		t.Errorf("Expected a resync then the latest %d events, got %d events", replayBufferSize, len(missed))
+	}
+
+	if _, missed, _, _ := hub.Subscribe(2, ids[0]); len(missed) != 1 || missed[0].Type != EventResync {
+		t.Errorf("Expected a user who wasn't connected to be told to resync, got %+v", missed)
+	}
+}
+
+func TestHubEventIDs(t *testing.T) {
+	now := time.Now()
+	if id := nextEventID(0, now); id != now.UnixMicro() {
+		t.Errorf("Expected ids to be the publishing time, got %d", id)
+	}
+	if id := nextEventID(now.UnixMicro(), now); id != now.UnixMicro()+1 {
+		t.Errorf("Expected ids to keep increasing within a microsecond, got %d", id)
+	}
+
+	// a restarted hub keeps going from where the previous one stopped, a
+	// restart taking longer than a microsecond
+	first := &Event{Type: EventPostCreated}
+	NewHub().Publish(first)
+	time.Sleep(time.Millisecond)
+	second := &Event{Type: EventPostCreated}
+	NewHub().Publish(second)
+	if second.ID <= first.ID {
+		t.Errorf("Expected ids to increase across hubs, got %d then %d", first.ID, second.ID)
+	}
+}
+
+func TestHubPrunesReplayBuffers(t *testing.T) {
+	hub := NewHub()
+	sub, _, _, _ := hub.Subscribe(1, 0)
+	hub.Unsubscribe(sub)
+	if _, ok := hub.replay[1]; !ok {
+		t.Fatal("Expected the buffer to be kept for a while after disconnecting")
+	}
+
+	hub.disconnectedAt[1] = time.Now().Add(-replayRetention - time.Second)
+	sub, _, _, _ = hub.Subscribe(2, 0)
+	if _, ok := hub.replay[1]; ok {
+		t.Error("Expected the buffer of a user gone for long to be dropped")
+	}
+	hub.Publish(&Event{Type: EventPostCreated}, 1)
+	if _, ok := hub.replay[1]; ok {
+		t.Error("Expected no buffer to be created by publishing")
+	}
+	hub.Unsubscribe(sub)
+}
+
+func TestHubPublishEphemeral(t *testing.T) {
+	hub := NewHub()
+	sub, _, _, _ := hub.Subscribe(1, 0)
+	if hub.Connections(1) != 1 || hub.Connections(2) != 0 {
+		t.Errorf("Expected one connection for user 1 and none for user 2")
+	}
+
+	types := []string{EventMessageCreated, EventTyping, EventMessageCreated}
+	first, last := &Event{Type: types[0]}, &Event{Type: types[2]}
+	hub.Publish(first, 1)
+	hub.PublishEphemeral(&Event{Type: types[1]}, 1)
+	hub.Publish(last, 1)
+	for _, eventType := range types {
+		if event := <-sub.Events; event.Type != eventType {
+			t.Errorf("Expected %s, got %s", eventType, event.Type)
+		}
+	}
+	hub.Unsubscribe(sub)
+
+	_, missed, _, _ := hub.Subscribe(1, first.ID)
+	if len(missed) != 1 || missed[0].ID != last.ID {
+		t.Errorf("Expected only the last event to be replayed, got %d events", len(missed))
+	}
+}
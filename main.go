@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,22 +20,118 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// setup database
-	store, err := NewPostgresStore()
+	store, err := newStorage()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// setup server
+	portNumber := fmt.Sprintf(":%s", os.Getenv("PORT"))
+	server := NewApiServer(portNumber, store)
+
+	// stop the background jobs and the server on Ctrl+C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// setup background jobs
+	go runJob(ctx, "suggestions", suggestionsRefreshInterval, store.RefreshSuggestions)
+	go runJob(ctx, "trending", trendingRefreshInterval, server.refreshTrending)
+
+	server.Run(ctx)
+}
+
+// newStorage picks the Storage implementation from the STORAGE env variable,
+// "memory" keeps everything in process for local development
+func newStorage() (Storage, error) {
+	if os.Getenv("STORAGE") == "memory" {
+		log.Println("using in-memory storage, data will be lost on restart")
+		return NewMemoryStore(), nil
+	}
+
+	store, err := NewPostgresStore()
+	if err != nil {
+		return nil, err
+	}
+
 	if err := store.db.Ping(); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	if err := store.Init(); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return store, nil
+}
 
-	// setup server
-	portNumber := fmt.Sprintf(":%s", os.Getenv("PORT"))
-	server := NewApiServer(portNumber, store)
-	server.Run()
+// runMigrate implements the migrate subcommand:
+//
+//	gosoc migrate [up]
+//	gosoc migrate down [steps]
+//	gosoc migrate status
+func runMigrate(args []string) error {
+	store, err := NewPostgresStore()
+	if err != nil {
+		return err
+	}
+	defer store.db.Close()
+
+	migrator, err := NewMigrator(store.db)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
 }
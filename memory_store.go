@@ -0,0 +1,2390 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory implementation of Storage used for tests and
+// local development. It mirrors the constraints of the postgres schema:
+// unique usernames, one like per user per post/comment and cascading deletes.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	lastID   int64
+	users    map[int64]*User
+	posts    map[int64]*Post
+	comments map[int64]*Comment
+	follows  map[int64]*Follow
+	// followRequests holds pending follows of private accounts
+	followRequests map[int64]*Follow
+	postLikes      map[int64]*memoryLike
+	commentLikes   map[int64]*memoryLike
+	sessions       map[string]*Session
+	notifications  map[int64]*Notification
+	conversations  map[int64]*memoryConversation
+	messages       map[int64]*Message
+	fanoutLimit    int
+	maxDepth       int
+	reactions      []string
+	// timelines maps a user to the ids of the posts fanned out to them,
+	// pulledPosts holds the posts that are merged into feeds on read instead
+	timelines   map[int64]map[int64]bool
+	pulledPosts map[int64]bool
+	// lastSeen holds users.lastSeenAt
+	lastSeen map[int64]time.Time
+	// blocks and mutes map a user to the users they blocked or muted
+	blocks map[int64]map[int64]bool
+	mutes  map[int64]map[int64]bool
+	// bookmarks holds bookmarks, collections bookmark_collections
+	bookmarks   map[int64]*memoryBookmark
+	collections map[int64]*Collection
+	// postTags maps a post to its hashtags, holding post_hashtags
+	postTags map[int64][]string
+	mentions map[int64]*memoryMention
+}
+
+// memoryLike is a row of post_likes or comment_likes, TargetID being the
+// post or comment reacted to
+type memoryLike struct {
+	ID         int64
+	UserID     int64
+	TargetID   int64
+	Reaction   string
+	Created_at time.Time
+}
+
+// memoryBookmark is a row of bookmarks
+type memoryBookmark struct {
+	ID           int64
+	UserID       int64
+	PostID       int64
+	CollectionID *int64
+	Created_at   time.Time
+}
+
+// memoryMention is a row of mentions
+type memoryMention struct {
+	ID         int64
+	UserID     int64
+	AuthorID   int64
+	PostID     int64
+	CommentID  *int64
+	Position   int
+	Length     int
+	Created_at time.Time
+}
+
+// memoryConversation is a row of conversations with its members, keyed by
+// user id
+type memoryConversation struct {
+	ID            int64
+	DirectKey     string
+	Kind          string
+	Title         string
+	Created_at    time.Time
+	LastMessageAt time.Time
+	Members       map[int64]*memoryMember
+}
+
+// memoryMember is a row of conversation_members, LastReadMessageID is 0
+// until the member has read something
+type memoryMember struct {
+	Role              string
+	Joined_at         time.Time
+	LastReadMessageID int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:          map[int64]*User{},
+		posts:          map[int64]*Post{},
+		comments:       map[int64]*Comment{},
+		follows:        map[int64]*Follow{},
+		followRequests: map[int64]*Follow{},
+		postLikes:      map[int64]*memoryLike{},
+		commentLikes:   map[int64]*memoryLike{},
+		sessions:       map[string]*Session{},
+		notifications:  map[int64]*Notification{},
+		conversations:  map[int64]*memoryConversation{},
+		messages:       map[int64]*Message{},
+		fanoutLimit:    timelineFanoutLimit(),
+		maxDepth:       maxCommentDepth(),
+		reactions:      loadReactions(),
+		timelines:      map[int64]map[int64]bool{},
+		pulledPosts:    map[int64]bool{},
+		lastSeen:       map[int64]time.Time{},
+		blocks:         map[int64]map[int64]bool{},
+		mutes:          map[int64]map[int64]bool{},
+		bookmarks:      map[int64]*memoryBookmark{},
+		collections:    map[int64]*Collection{},
+		postTags:       map[int64][]string{},
+		mentions:       map[int64]*memoryMention{},
+	}
+}
+
+// CRUD OPERATIONS FOR USERS
+func (s *MemoryStore) GetUserByName(name string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.userByName(name)
+	if user == nil {
+		return nil, fmt.Errorf("user %s not found", name)
+	}
+	clone := *user
+	return &clone, nil
+}
+
+func (s *MemoryStore) GetUserByID(id int64) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, nil
+	}
+	clone := *user
+	return &clone, nil
+}
+
+func (s *MemoryStore) GetUserProfile(username string, viewerID int64) (*UserProfile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.userByName(username)
+	if user == nil || s.blocked(viewerID, user.ID) {
+		return nil, fmt.Errorf("user %s not found", username)
+	}
+
+	profile := &UserProfile{
+		UserID:    user.ID,
+		UserName:  user.UserName,
+		Name:      user.Name,
+		Bio:       user.Bio,
+		IsPrivate: user.IsPrivate,
+	}
+	for _, post := range s.posts {
+		if post.UserID == user.ID {
+			profile.Posts++
+		}
+	}
+	for _, follow := range s.follows {
+		if follow.UserID == user.ID {
+			profile.Followers++
+		}
+		if follow.FollowerID == user.ID {
+			profile.Following++
+		}
+	}
+
+	return profile, nil
+}
+
+func (s *MemoryStore) CreateUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userByName(user.UserName) != nil {
+		return fmt.Errorf("username %s is already taken", user.UserName)
+	}
+
+	if user.AllowMessagesFrom == "" {
+		user.AllowMessagesFrom = MessagesFromEveryone
+	}
+	user.ID = s.nextID()
+	clone := *user
+	s.users[user.ID] = &clone
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userByName(username)
+	if user == nil {
+		return fmt.Errorf("user %s not found", username)
+	}
+
+	s.deleteUser(user.ID)
+	return nil
+}
+
+func (s *MemoryStore) UpdateUser(username string, req *UpdateUserRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userByName(username)
+	if user == nil {
+		return nil
+	}
+
+	if req.UserName != "" && req.UserName != user.UserName {
+		if s.userByName(req.UserName) != nil {
+			return fmt.Errorf("username %s is already taken", req.UserName)
+		}
+		user.UserName = req.UserName
+	}
+	if req.Name != "" {
+		user.Name = req.Name
+	}
+	if req.Email != "" {
+		user.Email = req.Email
+	}
+	if req.Bio != "" {
+		user.Bio = req.Bio
+	}
+	if req.PasswordHash != "" {
+		user.PasswordHash = req.PasswordHash
+	}
+	if req.AllowMessagesFrom != "" {
+		user.AllowMessagesFrom = req.AllowMessagesFrom
+	}
+	if req.HideReadReceipts != nil {
+		user.HideReadReceipts = *req.HideReadReceipts
+	}
+	if req.IsPrivate != nil {
+		user.IsPrivate = *req.IsPrivate
+	}
+
+	return nil
+}
+
+// CRUD OPERATIONS FOR POSTS
+func (s *MemoryStore) GetUserPosts(username string, page *PageRequest) (*Page[*Post], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	posts := []*Post{}
+	user := s.userByName(username)
+	if user == nil {
+		return paginate(posts, page, postCursor), nil
+	}
+
+	for _, post := range s.posts {
+		if post.UserID == user.ID {
+			posts = append(posts, s.post(post))
+		}
+	}
+	return paginate(posts, page, postCursor), nil
+}
+
+func (s *MemoryStore) GetPost(id int64) (*Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[id]
+	if !ok {
+		return nil, nil
+	}
+	return s.post(post), nil
+}
+
+func (s *MemoryStore) CreatePost(req *CreatePostRequest) (*Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[req.UserID]; !ok {
+		return nil, fmt.Errorf("user %d not found", req.UserID)
+	}
+	if err := s.checkShareable(req); err != nil {
+		return nil, err
+	}
+
+	id := s.nextID()
+	post := &Post{
+		ID:         id,
+		UserID:     req.UserID,
+		Content:    req.Content,
+		MediaUrl:   req.MediaUrl,
+		Created_at: time.Now().UTC(),
+		RepostOfID: req.RepostOfID,
+		QuoteOfID:  req.QuoteOfID,
+	}
+	s.posts[id] = post
+	s.postTags[id] = extractHashtags(req.Content)
+	s.indexMentions(req.UserID, id, nil, req.Content, post.Created_at)
+	if originalID, notificationType := sharedPost(req); originalID != nil {
+		s.notify(s.posts[*originalID].UserID, req.UserID, notificationType, originalID, nil)
+	}
+
+	followers := s.followerIDs(req.UserID)
+	if len(followers) > s.fanoutLimit {
+		s.pulledPosts[id] = true
+		return s.post(post), nil
+	}
+
+	s.pushToTimeline(req.UserID, id)
+	for _, followerID := range followers {
+		s.pushToTimeline(followerID, id)
+	}
+	return s.post(post), nil
+}
+
+func (s *MemoryStore) DeletePost(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deletePost(id)
+	return nil
+}
+
+func (s *MemoryStore) DeleteRepost(userID, postID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, post := range s.posts {
+		if post.UserID == userID && idOrZero(post.RepostOfID) == postID {
+			s.deletePost(id)
+		}
+	}
+	s.deleteNotifications(func(notification *Notification) bool {
+		return notification.ActorID == userID && notification.Type == NotificationRepost &&
+			idOrZero(notification.PostID) == postID
+	})
+	return nil
+}
+
+func (s *MemoryStore) UpdatePost(id int64, req *CreatePostRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[id]
+	if !ok {
+		return nil
+	}
+
+	if req.Content != "" {
+		post.Content = req.Content
+		s.postTags[id] = extractHashtags(req.Content)
+		s.indexMentions(post.UserID, id, nil, req.Content, time.Now().UTC())
+	}
+	if req.MediaUrl != "" {
+		post.MediaUrl = req.MediaUrl
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetTagPosts(tag string, viewerID int64, page *PageRequest) (*Page[*Post], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	posts := []*Post{}
+	for postID, tags := range s.postTags {
+		post := s.posts[postID]
+		if !containsTag(tags, tag) || s.blockedPost(viewerID, post) || s.privateAuthor(viewerID, post.UserID) {
+			continue
+		}
+		posts = append(posts, s.post(post))
+	}
+	return paginate(posts, page, postCursor), nil
+}
+
+func (s *MemoryStore) GetFeed(userID int64, page *PageRequest) (*Page[*Post], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	authors := map[int64]bool{userID: true}
+	for _, follow := range s.follows {
+		if follow.FollowerID == userID {
+			authors[follow.UserID] = true
+		}
+	}
+
+	posts := []*Post{}
+	for postID := range s.timelines[userID] {
+		if post := s.posts[postID]; !s.hiddenPost(userID, post) {
+			posts = append(posts, s.post(post))
+		}
+	}
+	for postID := range s.pulledPosts {
+		if post := s.posts[postID]; authors[post.UserID] && !s.hiddenPost(userID, post) {
+			posts = append(posts, s.post(post))
+		}
+	}
+	return paginate(posts, page, postCursor), nil
+}
+
+func (s *MemoryStore) GetPostLikes(postID, viewerID int64, page *PageRequest) (*Page[string], error) {
+	return s.GetPostReactions(postID, s.reactions[0], viewerID, page)
+}
+
+func (s *MemoryStore) GetPostReactions(postID int64, reaction string, viewerID int64, page *PageRequest) (*Page[string], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return paginateNames(s.reactedBy(s.postLikes, postID, reaction, viewerID), page), nil
+}
+
+// CRUD OPERATIONS FOR COMMENTS
+func (s *MemoryStore) GetCommentsFromPost(postID int64, view string, viewerID int64, page *PageRequest) (*Page[*Comment], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	comments := []*Comment{}
+	for _, comment := range s.comments {
+		if comment.PostID == postID && comment.ParentCommentID == nil && !s.blocked(viewerID, comment.UserID) {
+			comments = append(comments, s.comment(comment))
+		}
+	}
+	res := paginate(comments, page, commentCursor)
+
+	replies := []*Comment{}
+	if view == CommentsViewThreaded {
+		replies = s.thread(res.Items, viewerID)
+	} else {
+		for _, comment := range res.Items {
+			preview := s.replies(comment.ID, viewerID)
+			if len(preview) > replyPreviewSize {
+				preview = preview[:replyPreviewSize]
+			}
+			replies = append(replies, preview...)
+		}
+	}
+	sortNewestFirst(replies, commentCursor)
+	nestReplies(res.Items, replies)
+	return res, nil
+}
+
+func (s *MemoryStore) GetCommentReplies(commentID, viewerID int64, page *PageRequest) (*Page[*Comment], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return paginate(s.replies(commentID, viewerID), page, commentCursor), nil
+}
+
+func (s *MemoryStore) GetComment(id int64) (*Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	comment, ok := s.comments[id]
+	if !ok {
+		return nil, nil
+	}
+	return s.comment(comment), nil
+}
+
+func (s *MemoryStore) CreateComment(postID int64, req *CreateCommentRequest) (*Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[req.UserID]; !ok {
+		return nil, fmt.Errorf("user %d not found", req.UserID)
+	}
+	if _, ok := s.posts[postID]; !ok {
+		return nil, fmt.Errorf("post %d not found", postID)
+	}
+	if s.blocked(req.UserID, s.posts[postID].UserID) {
+		return nil, errBlocked
+	}
+
+	var parentID *int64
+	depth := 0
+	if req.ParentCommentID != nil {
+		parent, ok := s.comments[*req.ParentCommentID]
+		if !ok || parent.PostID != postID {
+			return nil, fmt.Errorf("comment %d not found on post %d", *req.ParentCommentID, postID)
+		}
+		if s.blocked(req.UserID, parent.UserID) {
+			return nil, errBlocked
+		}
+		parentID, depth = replyParent(parent, s.maxDepth)
+	}
+
+	id := s.nextID()
+	comment := &Comment{
+		ID:              id,
+		Text:            req.Text,
+		UserID:          req.UserID,
+		PostID:          postID,
+		Created_at:      time.Now().UTC(),
+		ParentCommentID: parentID,
+		Depth:           depth,
+	}
+	s.comments[id] = comment
+	s.indexMentions(req.UserID, postID, &id, req.Text, comment.Created_at)
+
+	// notify the author of the comment replied to, and the post's author
+	// unless that's the same person
+	var parentAuthorID int64
+	if parentID != nil {
+		parentAuthorID = s.comments[*parentID].UserID
+		s.notify(parentAuthorID, req.UserID, NotificationReply, &postID, &id)
+	}
+	if postAuthorID := s.posts[postID].UserID; postAuthorID != parentAuthorID {
+		s.notify(postAuthorID, req.UserID, NotificationComment, &postID, &id)
+	}
+
+	return s.comment(comment), nil
+}
+
+func (s *MemoryStore) DeleteComment(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteComment(id)
+	return nil
+}
+
+func (s *MemoryStore) UpdateComment(id int64, req *CreateCommentRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if comment, ok := s.comments[id]; ok {
+		comment.Text = req.Text
+		s.indexMentions(comment.UserID, comment.PostID, &id, req.Text, time.Now().UTC())
+	}
+	return nil
+}
+
+// CRUD OPERATIONS FOR SEARCH
+func (s *MemoryStore) SearchPosts(req *SearchRequest, viewerID int64) (*Page[*SearchResult], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := parseSearchQuery(req.Query)
+	results := []*SearchResult{}
+	for _, post := range s.posts {
+		if s.blockedPost(viewerID, post) || s.privateAuthor(viewerID, post.UserID) {
+			continue
+		}
+		if rank, snippet, ok := terms.match(post.Content); ok {
+			results = append(results, &SearchResult{Rank: rank, Snippet: snippet, Post: s.post(post)})
+		}
+	}
+	return pageSearchResults(results, req), nil
+}
+
+func (s *MemoryStore) SearchComments(req *SearchRequest, viewerID int64) (*Page[*SearchResult], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := parseSearchQuery(req.Query)
+	results := []*SearchResult{}
+	for _, comment := range s.comments {
+		authorID := s.posts[comment.PostID].UserID
+		if s.blocked(viewerID, comment.UserID) || s.blocked(viewerID, authorID) || s.privateAuthor(viewerID, authorID) {
+			continue
+		}
+		if rank, snippet, ok := terms.match(comment.Text); ok {
+			results = append(results, &SearchResult{Rank: rank, Snippet: snippet, Comment: s.comment(comment)})
+		}
+	}
+	return pageSearchResults(results, req), nil
+}
+
+func (s *MemoryStore) SearchUsers(req *SearchRequest, viewerID int64) (*Page[*SearchResult], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := parseSearchQuery(req.Query)
+	results := []*SearchResult{}
+	for _, user := range s.users {
+		if s.blocked(viewerID, user.ID) {
+			continue
+		}
+		if rank, snippet, ok := terms.match(user.UserName + " " + user.Name + " " + user.Bio); ok {
+			results = append(results, &SearchResult{Rank: rank, Snippet: snippet, User: userSummary(user)})
+		}
+	}
+	return pageSearchResults(results, req), nil
+}
+
+func (s *MemoryStore) AutocompleteUsers(prefix string, viewerID int64, limit int) ([]*UserSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type candidate struct {
+		user                 *User
+		followed, byUserName bool
+	}
+	candidates := []*candidate{}
+	for _, user := range s.users {
+		if user.ID == viewerID || s.blocked(viewerID, user.ID) {
+			continue
+		}
+		if ok, byUserName := autocompleteMatch(user, prefix); ok {
+			candidates = append(candidates, &candidate{user, s.following(viewerID, user.ID), byUserName})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.followed != b.followed {
+			return a.followed
+		}
+		if a.byUserName != b.byUserName {
+			return a.byUserName
+		}
+		if len(a.user.UserName) != len(b.user.UserName) {
+			return len(a.user.UserName) < len(b.user.UserName)
+		}
+		return a.user.UserName < b.user.UserName
+	})
+
+	users := []*UserSummary{}
+	for _, candidate := range candidates {
+		if len(users) == limit {
+			break
+		}
+		users = append(users, userSummary(candidate.user))
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) GetSuggestions(userID int64, limit int) ([]*Suggestion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	followed := map[int64]bool{}
+	for _, follow := range s.follows {
+		if follow.FollowerID == userID {
+			followed[follow.UserID] = true
+		}
+	}
+
+	mutuals := map[int64]int{}
+	for _, follow := range s.follows {
+		if followed[follow.FollowerID] {
+			mutuals[follow.UserID]++
+		}
+	}
+
+	suggestions := []*Suggestion{}
+	for suggestedID, count := range mutuals {
+		user := s.users[suggestedID]
+		if suggestedID == userID || followed[suggestedID] || user.IsPrivate || s.hiddenAuthor(userID, suggestedID) {
+			continue
+		}
+		suggestions = append(suggestions, &Suggestion{User: userSummary(user), Mutuals: count})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Mutuals != suggestions[j].Mutuals {
+			return suggestions[i].Mutuals > suggestions[j].Mutuals
+		}
+		return suggestions[i].User.UserID < suggestions[j].User.UserID
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// RefreshSuggestions does nothing, the MemoryStore always computes suggestions
+// on read
+func (s *MemoryStore) RefreshSuggestions() error {
+	return nil
+}
+
+// CRUD OPERATIONS FOR MENTIONS
+func (s *MemoryStore) GetMentions(userID int64, page *PageRequest) (*Page[*UserMention], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// list content mentioning the user several times once, by its first mention
+	first := map[string]*memoryMention{}
+	for _, mention := range s.mentions {
+		if mention.UserID != userID {
+			continue
+		}
+		key := fmt.Sprintf("%d/%d", mention.PostID, idOrZero(mention.CommentID))
+		if other, ok := first[key]; !ok || mention.Position < other.Position {
+			first[key] = mention
+		}
+	}
+
+	mentions := []*UserMention{}
+	for _, mention := range first {
+		post := s.posts[mention.PostID]
+		if s.hiddenAuthor(userID, mention.AuthorID) || s.blocked(userID, post.UserID) || s.privateAuthor(userID, post.UserID) {
+			continue
+		}
+		userMention := &UserMention{ID: mention.ID, Created_at: mention.Created_at, Post: s.post(post)}
+		if mention.CommentID != nil {
+			userMention.Comment = s.comment(s.comments[*mention.CommentID])
+		}
+		mentions = append(mentions, userMention)
+	}
+	return paginate(mentions, page, userMentionCursor), nil
+}
+
+// CRUD OPERATIONS FOR FOLLOWS
+func (s *MemoryStore) GetFollowers(username string, page *PageRequest) (*Page[string], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	followers := []*nameRow{}
+	if user := s.userByName(username); user != nil {
+		for _, follow := range s.follows {
+			if follow.UserID == user.ID {
+				followers = append(followers, s.nameRow(follow.FollowerID, follow.Created_at, follow.ID))
+			}
+		}
+	}
+	return paginateNames(followers, page), nil
+}
+
+func (s *MemoryStore) GetFollowing(username string, page *PageRequest) (*Page[string], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	following := []*nameRow{}
+	if user := s.userByName(username); user != nil {
+		for _, follow := range s.follows {
+			if follow.FollowerID == user.ID {
+				following = append(following, s.nameRow(follow.UserID, follow.Created_at, follow.ID))
+			}
+		}
+	}
+	return paginateNames(following, page), nil
+}
+
+func (s *MemoryStore) GetFollowerIDs(userID int64) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.followerIDs(userID), nil
+}
+
+func (s *MemoryStore) IsFollowing(followerID, userID int64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.following(followerID, userID), nil
+}
+
+func (s *MemoryStore) CreateFollow(req *FollowRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[req.UserID]; !ok {
+		return fmt.Errorf("user %d not found", req.UserID)
+	}
+	if _, ok := s.users[req.FollowingID]; !ok {
+		return fmt.Errorf("user %d not found", req.FollowingID)
+	}
+	if s.blocked(req.UserID, req.FollowingID) {
+		return errBlocked
+	}
+	for _, follow := range s.follows {
+		if follow.UserID == req.FollowingID && follow.FollowerID == req.UserID {
+			return fmt.Errorf("user %d already follows user %d", req.UserID, req.FollowingID)
+		}
+	}
+
+	s.follow(req)
+	s.notify(req.FollowingID, req.UserID, NotificationFollow, nil, nil)
+	return nil
+}
+
+func (s *MemoryStore) DeleteFollow(req *FollowRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, follow := range s.follows {
+		if follow.UserID == req.FollowingID && follow.FollowerID == req.UserID {
+			delete(s.follows, id)
+		}
+	}
+
+	// prune the unfollowed account's posts from the follower's timeline
+	for postID := range s.timelines[req.UserID] {
+		if s.posts[postID].UserID == req.FollowingID {
+			delete(s.timelines[req.UserID], postID)
+		}
+	}
+
+	s.deleteNotifications(func(notification *Notification) bool {
+		return notification.UserID == req.FollowingID && notification.ActorID == req.UserID &&
+			notification.Type == NotificationFollow
+	})
+	return nil
+}
+
+func (s *MemoryStore) CreateFollowRequest(req *FollowRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[req.UserID]; !ok {
+		return fmt.Errorf("user %d not found", req.UserID)
+	}
+	if _, ok := s.users[req.FollowingID]; !ok {
+		return fmt.Errorf("user %d not found", req.FollowingID)
+	}
+	if s.blocked(req.UserID, req.FollowingID) {
+		return errBlocked
+	}
+	for _, follow := range s.follows {
+		if follow.UserID == req.FollowingID && follow.FollowerID == req.UserID {
+			return fmt.Errorf("user %d already follows user %d", req.UserID, req.FollowingID)
+		}
+	}
+	if s.followRequest(req.FollowingID, req.UserID) != 0 {
+		return fmt.Errorf("user %d already requested to follow user %d", req.UserID, req.FollowingID)
+	}
+
+	id := s.nextID()
+	s.followRequests[id] = &Follow{
+		ID:         id,
+		UserID:     req.FollowingID,
+		FollowerID: req.UserID,
+		Created_at: time.Now().UTC(),
+	}
+	s.notify(req.FollowingID, req.UserID, NotificationFollowRequest, nil, nil)
+	return nil
+}
+
+func (s *MemoryStore) GetFollowRequests(userID int64, page *PageRequest) (*Page[string], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	requesters := []*nameRow{}
+	for _, request := range s.followRequests {
+		if request.UserID == userID {
+			requesters = append(requesters, s.nameRow(request.FollowerID, request.Created_at, request.ID))
+		}
+	}
+	return paginateNames(requesters, page), nil
+}
+
+func (s *MemoryStore) ApproveFollowRequest(userID, requesterID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.deleteFollowRequest(userID, requesterID); err != nil {
+		return err
+	}
+	s.follow(&FollowRequest{UserID: requesterID, FollowingID: userID})
+	s.notify(requesterID, userID, NotificationFollowAccepted, nil, nil)
+	return nil
+}
+
+func (s *MemoryStore) DeleteFollowRequest(userID, requesterID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteFollowRequest(userID, requesterID)
+}
+
+// CRUD OPERATIONS FOR LIKES
+func (s *MemoryStore) LikePost(userID, postID int64) error {
+	return s.ReactToPost(userID, postID, s.reactions[0])
+}
+
+func (s *MemoryStore) ReactToPost(userID, postID int64, reaction string) error {
+	if err := checkReaction(s.reactions, reaction); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[postID]
+	if !ok {
+		return fmt.Errorf("post %d not found", postID)
+	}
+	if s.blocked(userID, post.UserID) {
+		return errBlocked
+	}
+	if err := s.react(s.postLikes, userID, postID, reaction); err != nil {
+		return err
+	}
+
+	s.deletePostReactionNotifications(userID, postID)
+	notificationType := reactionNotification(s.reactions, reaction, NotificationLikePost, NotificationReactPost)
+	s.notify(post.UserID, userID, notificationType, &postID, nil)
+	return nil
+}
+
+func (s *MemoryStore) UnlikePost(userID, postID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unlike(s.postLikes, userID, postID)
+	s.deletePostReactionNotifications(userID, postID)
+	return nil
+}
+
+func (s *MemoryStore) LikeComment(userID, commentID int64) error {
+	return s.ReactToComment(userID, commentID, s.reactions[0])
+}
+
+func (s *MemoryStore) ReactToComment(userID, commentID int64, reaction string) error {
+	if err := checkReaction(s.reactions, reaction); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[commentID]
+	if !ok {
+		return fmt.Errorf("comment %d not found", commentID)
+	}
+	if s.blocked(userID, comment.UserID) {
+		return errBlocked
+	}
+	if err := s.react(s.commentLikes, userID, commentID, reaction); err != nil {
+		return err
+	}
+
+	s.deleteCommentReactionNotifications(userID, commentID)
+	postID := comment.PostID
+	notificationType := reactionNotification(s.reactions, reaction, NotificationLikeComment, NotificationReactComment)
+	s.notify(comment.UserID, userID, notificationType, &postID, &commentID)
+	return nil
+}
+
+func (s *MemoryStore) UnlikeComment(userID, commentID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unlike(s.commentLikes, userID, commentID)
+	s.deleteCommentReactionNotifications(userID, commentID)
+	return nil
+}
+
+func (s *MemoryStore) GetCommentReactions(commentID int64, reaction string, viewerID int64, page *PageRequest) (*Page[string], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return paginateNames(s.reactedBy(s.commentLikes, commentID, reaction, viewerID), page), nil
+}
+
+// CRUD OPERATIONS FOR TRENDING
+
+func (s *MemoryStore) ScoreTrendingPosts(now time.Time, window time.Duration, limit int) ([]*PostScore, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	since := now.Add(-window)
+	totals := map[int64]float64{}
+	score := func(postID int64, weight float64, createdAt time.Time) {
+		if createdAt.After(since) {
+			totals[postID] += trendingWeight(weight, now.Sub(createdAt))
+		}
+	}
+	for _, like := range s.postLikes {
+		score(like.TargetID, trendingReactionScore, like.Created_at)
+	}
+	for _, comment := range s.comments {
+		score(comment.PostID, trendingCommentScore, comment.Created_at)
+	}
+	for _, share := range s.posts {
+		if id := originalID(share); id != nil {
+			score(*id, trendingRepostScore, share.Created_at)
+		}
+	}
+
+	scores := []*PostScore{}
+	for postID, total := range totals {
+		post, ok := s.posts[postID]
+		if !ok || post.RepostOfID != nil || s.users[post.UserID].IsPrivate {
+			continue
+		}
+		scores = append(scores, &PostScore{PostID: postID, Score: total})
+	}
+	return sortPostScores(scores, limit), nil
+}
+
+func (s *MemoryStore) ScoreTrendingTags(now time.Time, window time.Duration, limit int) ([]*TrendingTag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	since, previousSince := now.Add(-window), now.Add(-2*window)
+	posts := map[string]int{}
+	authors := map[string]map[int64]bool{}
+	previousAuthors := map[string]map[int64]bool{}
+	for postID, tags := range s.postTags {
+		post := s.posts[postID]
+		if s.users[post.UserID].IsPrivate || !post.Created_at.After(previousSince) || post.Created_at.After(now) {
+			continue
+		}
+		for _, tag := range tags {
+			users := previousAuthors
+			if post.Created_at.After(since) {
+				users = authors
+				posts[tag]++
+			}
+			if users[tag] == nil {
+				users[tag] = map[int64]bool{}
+			}
+			users[tag][post.UserID] = true
+		}
+	}
+
+	trending := []*TrendingTag{}
+	for tag, users := range authors {
+		trending = append(trending, &TrendingTag{
+			Tag:             tag,
+			Score:           trendingTagScore(len(users), len(previousAuthors[tag])),
+			Posts:           posts[tag],
+			Authors:         len(users),
+			PreviousAuthors: len(previousAuthors[tag]),
+		})
+	}
+	return sortTrendingTags(trending, limit), nil
+}
+
+func (s *MemoryStore) GetPostsByIDs(ids []int64, viewerID int64) ([]*Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	posts := []*Post{}
+	for _, id := range ids {
+		post, ok := s.posts[id]
+		if !ok || s.blockedPost(viewerID, post) || s.privateAuthor(viewerID, post.UserID) {
+			continue
+		}
+		posts = append(posts, s.post(post))
+	}
+	return posts, nil
+}
+
+// CRUD OPERATIONS FOR BOOKMARKS
+func (s *MemoryStore) BookmarkPost(userID, postID int64, collectionID *int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[postID]
+	if !ok {
+		return fmt.Errorf("post %d not found", postID)
+	}
+	if s.blocked(userID, post.UserID) {
+		return errBlocked
+	}
+	if collectionID != nil {
+		if collection, ok := s.collections[*collectionID]; !ok || collection.UserID != userID {
+			return fmt.Errorf("collection %d not found", *collectionID)
+		}
+	}
+
+	for _, bookmark := range s.bookmarks {
+		if bookmark.UserID == userID && bookmark.PostID == postID {
+			bookmark.CollectionID = collectionID
+			return nil
+		}
+	}
+	id := s.nextID()
+	s.bookmarks[id] = &memoryBookmark{
+		ID:           id,
+		UserID:       userID,
+		PostID:       postID,
+		CollectionID: collectionID,
+		Created_at:   time.Now().UTC(),
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteBookmark(userID, postID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, bookmark := range s.bookmarks {
+		if bookmark.UserID == userID && bookmark.PostID == postID {
+			delete(s.bookmarks, id)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetBookmarks(userID int64, collectionID *int64, page *PageRequest) (*Page[*Bookmark], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bookmarks := []*Bookmark{}
+	for _, bookmark := range s.bookmarks {
+		if bookmark.UserID != userID || (collectionID != nil && idOrZero(bookmark.CollectionID) != *collectionID) {
+			continue
+		}
+		bookmarks = append(bookmarks, &Bookmark{
+			ID:           bookmark.ID,
+			CollectionID: bookmark.CollectionID,
+			Created_at:   bookmark.Created_at,
+			Post:         s.post(s.posts[bookmark.PostID]),
+		})
+	}
+	return paginate(bookmarks, page, bookmarkCursor), nil
+}
+
+func (s *MemoryStore) CreateCollection(userID int64, name string) (*Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.collectionNamed(userID, name, 0) {
+		return nil, fmt.Errorf("collection %q already exists", name)
+	}
+
+	id := s.nextID()
+	collection := &Collection{ID: id, UserID: userID, Name: name, Created_at: time.Now().UTC()}
+	s.collections[id] = collection
+	clone := *collection
+	return &clone, nil
+}
+
+func (s *MemoryStore) GetCollections(userID int64, page *PageRequest) (*Page[*Collection], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	collections := []*Collection{}
+	for _, collection := range s.collections {
+		if collection.UserID != userID {
+			continue
+		}
+		clone := *collection
+		for _, bookmark := range s.bookmarks {
+			if idOrZero(bookmark.CollectionID) == collection.ID {
+				clone.Bookmarks++
+			}
+		}
+		collections = append(collections, &clone)
+	}
+	return paginate(collections, page, collectionCursor), nil
+}
+
+func (s *MemoryStore) RenameCollection(userID, id int64, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, ok := s.collections[id]
+	if !ok || collection.UserID != userID {
+		return fmt.Errorf("collection %d not found", id)
+	}
+	if s.collectionNamed(userID, name, id) {
+		return fmt.Errorf("collection %q already exists", name)
+	}
+	collection.Name = name
+	return nil
+}
+
+func (s *MemoryStore) DeleteCollection(userID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, ok := s.collections[id]
+	if !ok || collection.UserID != userID {
+		return fmt.Errorf("collection %d not found", id)
+	}
+	s.deleteCollection(id)
+	return nil
+}
+
+// CRUD OPERATIONS FOR BLOCKS AND MUTES
+func (s *MemoryStore) BlockUser(userID, blockedID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[blockedID]; !ok {
+		return fmt.Errorf("user %d not found", blockedID)
+	}
+	if s.blocks[userID] == nil {
+		s.blocks[userID] = map[int64]bool{}
+	}
+	s.blocks[userID][blockedID] = true
+
+	for id, follow := range s.follows {
+		if (follow.UserID == userID && follow.FollowerID == blockedID) ||
+			(follow.UserID == blockedID && follow.FollowerID == userID) {
+			delete(s.follows, id)
+		}
+	}
+	for id, request := range s.followRequests {
+		if (request.UserID == userID && request.FollowerID == blockedID) ||
+			(request.UserID == blockedID && request.FollowerID == userID) {
+			delete(s.followRequests, id)
+		}
+	}
+	for postID := range s.timelines[userID] {
+		if s.posts[postID].UserID == blockedID {
+			delete(s.timelines[userID], postID)
+		}
+	}
+	for postID := range s.timelines[blockedID] {
+		if s.posts[postID].UserID == userID {
+			delete(s.timelines[blockedID], postID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) UnblockUser(userID, blockedID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blocks[userID], blockedID)
+	return nil
+}
+
+func (s *MemoryStore) IsBlocked(userID, otherID int64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.blocked(userID, otherID), nil
+}
+
+func (s *MemoryStore) MuteUser(userID, mutedID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[mutedID]; !ok {
+		return fmt.Errorf("user %d not found", mutedID)
+	}
+	if s.mutes[userID] == nil {
+		s.mutes[userID] = map[int64]bool{}
+	}
+	s.mutes[userID][mutedID] = true
+	return nil
+}
+
+func (s *MemoryStore) UnmuteUser(userID, mutedID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.mutes[userID], mutedID)
+	return nil
+}
+
+func (s *MemoryStore) IsMuted(userID, mutedID int64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.mutes[userID][mutedID], nil
+}
+
+func (s *MemoryStore) GetMutedByIDs(userID int64) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []int64{}
+	for muterID, muted := range s.mutes {
+		if muted[userID] {
+			ids = append(ids, muterID)
+		}
+	}
+	return ids, nil
+}
+
+// CRUD OPERATIONS FOR SESSIONS
+func (s *MemoryStore) CreateSession(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[session.UserID]; !ok {
+		return fmt.Errorf("user %d not found", session.UserID)
+	}
+	if _, ok := s.sessions[session.ID]; ok {
+		return fmt.Errorf("session %s already exists", session.ID)
+	}
+
+	clone := *session
+	s.sessions[session.ID] = &clone
+	return nil
+}
+
+func (s *MemoryStore) GetSession(id string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	clone := *session
+	return &clone, nil
+}
+
+func (s *MemoryStore) GetSessionByRefreshToken(refreshToken string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, session := range s.sessions {
+		if session.RefreshToken == refreshToken || session.PreviousRefreshToken == refreshToken {
+			clone := *session
+			return &clone, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) GetUserSessions(userID int64) ([]*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []*Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			clone := *session
+			sessions = append(sessions, &clone)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+func (s *MemoryStore) RotateSession(id, oldRefreshToken, refreshToken string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.IsBlocked || session.RefreshToken != oldRefreshToken {
+		return false, nil
+	}
+
+	session.PreviousRefreshToken = oldRefreshToken
+	session.RefreshToken = refreshToken
+	session.ExpirationTime = expiresAt
+	session.LastUsedAt = time.Now().UTC()
+	return true, nil
+}
+
+func (s *MemoryStore) DeleteSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+// CRUD OPERATIONS FOR NOTIFICATIONS
+func (s *MemoryStore) GetNotifications(userID int64, page *PageRequest) (*Page[*NotificationGroup], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notifications := []*Notification{}
+	for _, notification := range s.notifications {
+		if notification.UserID == userID && !s.hiddenActor(userID, notification.ActorID) {
+			clone := *notification
+			clone.ActorName = s.users[notification.ActorID].UserName
+			notifications = append(notifications, &clone)
+		}
+	}
+	sortNewestFirst(notifications, notificationCursor)
+	return newGroupPage(pageNotificationGroups(notifications, page), page), nil
+}
+
+func (s *MemoryStore) CountUnreadNotifications(userID int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, notification := range s.notifications {
+		if notification.UserID == userID && !notification.IsRead && !s.hiddenActor(userID, notification.ActorID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) MarkNotificationsRead(userID int64, ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(ids) == 0 {
+		for _, notification := range s.notifications {
+			if notification.UserID == userID {
+				notification.IsRead = true
+			}
+		}
+		return nil
+	}
+
+	for _, id := range ids {
+		if notification, ok := s.notifications[id]; ok && notification.UserID == userID {
+			notification.IsRead = true
+		}
+	}
+	return nil
+}
+
+// CRUD OPERATIONS FOR CONVERSATIONS
+func (s *MemoryStore) GetOrCreateDirectConversation(userID, otherID int64) (*Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range []int64{userID, otherID} {
+		if _, ok := s.users[id]; !ok {
+			return nil, fmt.Errorf("user %d not found", id)
+		}
+	}
+
+	key := directConversationKey(userID, otherID)
+	for _, conversation := range s.conversations {
+		if conversation.DirectKey == key {
+			return s.conversation(conversation), nil
+		}
+	}
+
+	now := time.Now().UTC()
+	conversation := &memoryConversation{
+		ID:            s.nextID(),
+		DirectKey:     key,
+		Kind:          ConversationDirect,
+		Created_at:    now,
+		LastMessageAt: now,
+		Members: map[int64]*memoryMember{
+			userID:  {Role: RoleMember, Joined_at: now},
+			otherID: {Role: RoleMember, Joined_at: now},
+		},
+	}
+	s.conversations[conversation.ID] = conversation
+	return s.conversation(conversation), nil
+}
+
+func (s *MemoryStore) GetConversation(id int64) (*Conversation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conversation, ok := s.conversations[id]
+	if !ok {
+		return nil, nil
+	}
+	return s.conversation(conversation), nil
+}
+
+func (s *MemoryStore) GetUserConversations(userID int64, page *PageRequest) (*Page[*Conversation], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conversations := []*Conversation{}
+	for _, conversation := range s.conversations {
+		if _, ok := conversation.Members[userID]; ok {
+			conversations = append(conversations, s.conversation(conversation))
+		}
+	}
+	return paginate(conversations, page, conversationCursor), nil
+}
+
+func (s *MemoryStore) IsConversationMember(conversationID, userID int64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conversation, ok := s.conversations[conversationID]
+	if !ok {
+		return false, nil
+	}
+	_, ok = conversation.Members[userID]
+	return ok, nil
+}
+
+func (s *MemoryStore) GetMessages(conversationID int64, page *PageRequest) (*Page[*Message], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	messages := []*Message{}
+	for _, message := range s.messages {
+		if message.ConversationID == conversationID {
+			clone := *message
+			messages = append(messages, &clone)
+		}
+	}
+	return paginate(messages, page, messageCursor), nil
+}
+
+func (s *MemoryStore) CreateMessage(conversationID int64, req *CreateMessageRequest) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversation, ok := s.conversations[conversationID]
+	if !ok {
+		return nil, fmt.Errorf("conversation %d not found", conversationID)
+	}
+	if _, ok := s.users[req.UserID]; !ok {
+		return nil, fmt.Errorf("user %d not found", req.UserID)
+	}
+	return s.addMessage(conversation, req), nil
+}
+
+func (s *MemoryStore) CreateGroupConversation(creatorID int64, title string, memberIDs []int64, notice *CreateMessageRequest) (*Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[creatorID]; !ok {
+		return nil, fmt.Errorf("user %d not found", creatorID)
+	}
+
+	now := time.Now().UTC()
+	conversation := &memoryConversation{
+		ID:            s.nextID(),
+		Kind:          ConversationGroup,
+		Title:         title,
+		Created_at:    now,
+		LastMessageAt: now,
+		Members:       map[int64]*memoryMember{creatorID: {Role: RoleAdmin, Joined_at: now}},
+	}
+	if err := s.addMembers(conversation, memberIDs); err != nil {
+		return nil, err
+	}
+
+	s.conversations[conversation.ID] = conversation
+	s.addMessage(conversation, notice)
+	return s.conversation(conversation), nil
+}
+
+func (s *MemoryStore) GetConversationMember(conversationID, userID int64) (*ConversationMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conversation, ok := s.conversations[conversationID]
+	if !ok {
+		return nil, nil
+	}
+	member, ok := conversation.Members[userID]
+	if !ok {
+		return nil, nil
+	}
+	return s.conversationMember(userID, member), nil
+}
+
+func (s *MemoryStore) AddConversationMembers(conversationID int64, userIDs []int64, notice *CreateMessageRequest) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversation, ok := s.conversations[conversationID]
+	if !ok {
+		return nil, fmt.Errorf("conversation %d not found", conversationID)
+	}
+	if err := s.addMembers(conversation, userIDs); err != nil {
+		return nil, err
+	}
+	return s.addMessage(conversation, notice), nil
+}
+
+func (s *MemoryStore) RemoveConversationMember(conversationID, userID int64, notice *CreateMessageRequest) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversation, ok := s.conversations[conversationID]
+	if !ok {
+		return nil, fmt.Errorf("conversation %d not found", conversationID)
+	}
+
+	delete(conversation.Members, userID)
+	if len(conversation.Members) == 0 {
+		s.deleteConversation(conversationID)
+		return nil, nil
+	}
+
+	// promote the longest standing member when the last admin leaves
+	var oldestID int64
+	var oldest *memoryMember
+	for memberID, member := range conversation.Members {
+		if member.Role == RoleAdmin {
+			oldest = nil
+			break
+		}
+		if oldest == nil || member.Joined_at.Before(oldest.Joined_at) ||
+			(member.Joined_at.Equal(oldest.Joined_at) && memberID < oldestID) {
+			oldestID, oldest = memberID, member
+		}
+	}
+	if oldest != nil {
+		oldest.Role = RoleAdmin
+	}
+
+	return s.addMessage(conversation, notice), nil
+}
+
+func (s *MemoryStore) UpdateConversationTitle(id int64, title string, notice *CreateMessageRequest) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversation, ok := s.conversations[id]
+	if !ok {
+		return nil, fmt.Errorf("conversation %d not found", id)
+	}
+	conversation.Title = title
+	return s.addMessage(conversation, notice), nil
+}
+
+func (s *MemoryStore) SetConversationMemberRole(conversationID, userID int64, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conversation, ok := s.conversations[conversationID]; ok {
+		if member, ok := conversation.Members[userID]; ok {
+			member.Role = role
+		}
+	}
+	return nil
+}
+
+// MarkConversationRead moves userID's read marker forward to messageID, or to
+// the latest message when messageID is 0, and returns where the marker is
+func (s *MemoryStore) MarkConversationRead(conversationID, userID, messageID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversation, ok := s.conversations[conversationID]
+	if !ok {
+		return 0, fmt.Errorf("conversation %d not found", conversationID)
+	}
+	member, ok := conversation.Members[userID]
+	if !ok {
+		return 0, fmt.Errorf("user %d is not a member of conversation %d", userID, conversationID)
+	}
+
+	var latest int64
+	for _, message := range s.messages {
+		if message.ConversationID == conversationID && (messageID == 0 || message.ID == messageID) && message.ID > latest {
+			latest = message.ID
+		}
+	}
+	if latest > member.LastReadMessageID {
+		member.LastReadMessageID = latest
+	}
+	return member.LastReadMessageID, nil
+}
+
+func (s *MemoryStore) GetConversationPartnerIDs(userID int64) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[int64]bool{}
+	ids := []int64{}
+	for _, conversation := range s.conversations {
+		if _, ok := conversation.Members[userID]; !ok {
+			continue
+		}
+		for memberID := range conversation.Members {
+			if memberID != userID && !seen[memberID] && !s.blocked(userID, memberID) {
+				seen[memberID] = true
+				ids = append(ids, memberID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) SetLastSeen(userID int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; ok {
+		s.lastSeen[userID] = at
+	}
+	return nil
+}
+
+// HELPER FUNCTIONS
+// the helpers below expect the caller to hold s.mu
+
+func (s *MemoryStore) nextID() int64 {
+	s.lastID++
+	return s.lastID
+}
+
+func (s *MemoryStore) userByName(username string) *User {
+	for _, user := range s.users {
+		if user.UserName == username {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) followerIDs(userID int64) []int64 {
+	followers := []int64{}
+	for _, follow := range s.follows {
+		if follow.UserID == userID {
+			followers = append(followers, follow.FollowerID)
+		}
+	}
+	return followers
+}
+
+// blocked reports whether either user has blocked the other
+func (s *MemoryStore) blocked(userID, otherID int64) bool {
+	return s.blocks[userID][otherID] || s.blocks[otherID][userID]
+}
+
+// hiddenAuthor reports whether posts by authorID are left out of userID's feed
+func (s *MemoryStore) hiddenAuthor(userID, authorID int64) bool {
+	return s.blocked(userID, authorID) || s.mutes[userID][authorID]
+}
+
+// hiddenPost reports whether post is left out of userID's feed, because of
+// its author or the author of the post it shares
+func (s *MemoryStore) hiddenPost(userID int64, post *Post) bool {
+	return s.mutes[userID][post.UserID] || s.blockedPost(userID, post)
+}
+
+// blockedPost reports whether post is left out of userID's reads outside the
+// feed, because they blocked or were blocked by its author or the author of
+// the post it shares
+func (s *MemoryStore) blockedPost(userID int64, post *Post) bool {
+	if s.blocked(userID, post.UserID) {
+		return true
+	}
+	if id := originalID(post); id != nil {
+		original, ok := s.posts[*id]
+		return ok && s.blocked(userID, original.UserID)
+	}
+	return false
+}
+
+func userSummary(user *User) *UserSummary {
+	return &UserSummary{
+		UserID:    user.ID,
+		UserName:  user.UserName,
+		Name:      user.Name,
+		Bio:       user.Bio,
+		IsPrivate: user.IsPrivate,
+	}
+}
+
+// privateAuthor reports whether posts by authorID are private to userID, who
+// is neither their author nor one of their followers
+func (s *MemoryStore) privateAuthor(userID, authorID int64) bool {
+	author, ok := s.users[authorID]
+	return ok && author.IsPrivate && userID != authorID && !s.following(userID, authorID)
+}
+
+// following reports whether followerID follows userID
+func (s *MemoryStore) following(followerID, userID int64) bool {
+	for _, follow := range s.follows {
+		if follow.UserID == userID && follow.FollowerID == followerID {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenActor reports whether notifications about actorID are left out of
+// userID's notifications
+func (s *MemoryStore) hiddenActor(userID, actorID int64) bool {
+	return s.blocks[userID][actorID] || s.mutes[userID][actorID]
+}
+
+// follow makes req.UserID follow req.FollowingID and backfills the
+// follower's timeline with the account's latest posts
+func (s *MemoryStore) follow(req *FollowRequest) {
+	id := s.nextID()
+	s.follows[id] = &Follow{
+		ID:         id,
+		UserID:     req.FollowingID,
+		FollowerID: req.UserID,
+		Created_at: time.Now().UTC(),
+	}
+
+	posts := []*Post{}
+	for _, post := range s.posts {
+		if post.UserID == req.FollowingID && !s.pulledPosts[post.ID] {
+			posts = append(posts, post)
+		}
+	}
+	sortNewestFirst(posts, postCursor)
+	for i, post := range posts {
+		if i == timelineBackfillSize {
+			break
+		}
+		s.pushToTimeline(req.UserID, post.ID)
+	}
+}
+
+// followRequest returns the id of requesterID's pending request to follow
+// userID, or 0 if there is none
+func (s *MemoryStore) followRequest(userID, requesterID int64) int64 {
+	for id, request := range s.followRequests {
+		if request.UserID == userID && request.FollowerID == requesterID {
+			return id
+		}
+	}
+	return 0
+}
+
+// deleteFollowRequest removes a pending follow request along with the
+// notification about it, failing when there is none
+func (s *MemoryStore) deleteFollowRequest(userID, requesterID int64) error {
+	id := s.followRequest(userID, requesterID)
+	if id == 0 {
+		return fmt.Errorf("no follow request from user %d", requesterID)
+	}
+	delete(s.followRequests, id)
+	s.deleteNotifications(func(notification *Notification) bool {
+		return notification.UserID == userID && notification.ActorID == requesterID &&
+			notification.Type == NotificationFollowRequest
+	})
+	return nil
+}
+
+func (s *MemoryStore) pushToTimeline(userID, postID int64) {
+	if s.timelines[userID] == nil {
+		s.timelines[userID] = map[int64]bool{}
+	}
+	s.timelines[userID][postID] = true
+}
+
+// notify records a notification for userID, nobody is notified of their own
+// actions
+func (s *MemoryStore) notify(userID, actorID int64, notificationType string, postID, commentID *int64) {
+	if userID == actorID {
+		return
+	}
+
+	id := s.nextID()
+	s.notifications[id] = &Notification{
+		ID:         id,
+		UserID:     userID,
+		ActorID:    actorID,
+		Type:       notificationType,
+		PostID:     postID,
+		CommentID:  commentID,
+		Created_at: time.Now().UTC(),
+	}
+}
+
+func (s *MemoryStore) deleteNotifications(match func(notification *Notification) bool) {
+	for id, notification := range s.notifications {
+		if match(notification) {
+			delete(s.notifications, id)
+		}
+	}
+}
+
+// comment builds the Comment returned for a stored comment, with its reply
+// count
+func (s *MemoryStore) comment(comment *Comment) *Comment {
+	clone := *comment
+	clone.Replies = nil
+	clone.Reactions = reactionCounts(s.commentLikes, comment.ID)
+	clone.Mentions = s.mentionsOf(comment.PostID, &comment.ID)
+	for _, reply := range s.comments {
+		if idOrZero(reply.ParentCommentID) == comment.ID {
+			clone.ReplyCount++
+		}
+	}
+	return &clone
+}
+
+// replies returns the replies to a comment that viewerID can see, newest
+// first
+func (s *MemoryStore) replies(commentID, viewerID int64) []*Comment {
+	replies := []*Comment{}
+	for _, reply := range s.comments {
+		if idOrZero(reply.ParentCommentID) == commentID && !s.blocked(viewerID, reply.UserID) {
+			replies = append(replies, s.comment(reply))
+		}
+	}
+	sortNewestFirst(replies, commentCursor)
+	return replies
+}
+
+// thread returns the replies below comments that viewerID can see, level by
+// level: the threadRepliesSize latest replies of every comment, down to the
+// max depth and up to threadSize replies in all
+func (s *MemoryStore) thread(comments []*Comment, viewerID int64) []*Comment {
+	thread := []*Comment{}
+	for level := comments; len(level) > 0; {
+		next := []*Comment{}
+		for _, parent := range level {
+			if parent.Depth >= s.maxDepth {
+				continue
+			}
+			replies := s.replies(parent.ID, viewerID)
+			if len(replies) > threadRepliesSize {
+				replies = replies[:threadRepliesSize]
+			}
+			next = append(next, replies...)
+		}
+		if len(thread)+len(next) > threadSize {
+			return append(thread, next[:threadSize-len(thread)]...)
+		}
+		thread = append(thread, next...)
+		level = next
+	}
+	return thread
+}
+
+// post builds the Post returned for a stored post, with its repost count and
+// the post it shares
+func (s *MemoryStore) post(post *Post) *Post {
+	clone := *post
+	clone.Reactions = reactionCounts(s.postLikes, post.ID)
+	clone.Mentions = s.mentionsOf(post.ID, nil)
+	for _, share := range s.posts {
+		if id := originalID(share); id != nil && *id == post.ID {
+			clone.Reposts++
+		}
+	}
+	if id := originalID(post); id != nil {
+		if original, ok := s.posts[*id]; ok {
+			clone.Original = s.post(original)
+			clone.Original.Original = nil
+		}
+	}
+	return &clone
+}
+
+// checkShareable fails when req reposts or quotes a post that doesn't exist,
+// whose author blocked or was blocked by the sharer, or that the sharer
+// already reposted
+func (s *MemoryStore) checkShareable(req *CreatePostRequest) error {
+	originalID, _ := sharedPost(req)
+	if originalID == nil {
+		return nil
+	}
+	original, ok := s.posts[*originalID]
+	if !ok {
+		return fmt.Errorf("post %d not found", *originalID)
+	}
+	if s.blocked(req.UserID, original.UserID) {
+		return errBlocked
+	}
+	if req.RepostOfID == nil {
+		return nil
+	}
+	for _, post := range s.posts {
+		if post.UserID == req.UserID && idOrZero(post.RepostOfID) == *req.RepostOfID {
+			return errAlreadyReposted
+		}
+	}
+	return nil
+}
+
+// conversation builds the Conversation returned for a stored conversation,
+// with its members and latest message
+func (s *MemoryStore) conversation(stored *memoryConversation) *Conversation {
+	conversation := &Conversation{
+		ID:            stored.ID,
+		Kind:          stored.Kind,
+		Title:         stored.Title,
+		Members:       []*ConversationMember{},
+		Created_at:    stored.Created_at,
+		LastMessageAt: stored.LastMessageAt,
+	}
+	for userID, member := range stored.Members {
+		conversation.Members = append(conversation.Members, s.conversationMember(userID, member))
+	}
+	sort.Slice(conversation.Members, func(i, j int) bool {
+		a, b := conversation.Members[i], conversation.Members[j]
+		if a.Joined_at.Equal(b.Joined_at) {
+			return a.UserID < b.UserID
+		}
+		return a.Joined_at.Before(b.Joined_at)
+	})
+
+	for _, message := range s.messages {
+		if message.ConversationID != stored.ID {
+			continue
+		}
+		if conversation.LastMessage == nil || newerThan(messageCursor(message), messageCursor(conversation.LastMessage)) {
+			clone := *message
+			conversation.LastMessage = &clone
+		}
+	}
+	return conversation
+}
+
+func (s *MemoryStore) conversationMember(userID int64, member *memoryMember) *ConversationMember {
+	user := s.users[userID]
+	conversationMember := &ConversationMember{
+		UserID:           userID,
+		UserName:         user.UserName,
+		Role:             member.Role,
+		Joined_at:        member.Joined_at,
+		HideReadReceipts: user.HideReadReceipts,
+	}
+	if member.LastReadMessageID != 0 {
+		lastRead := member.LastReadMessageID
+		conversationMember.LastReadMessageID = &lastRead
+	}
+	if lastSeen, ok := s.lastSeen[userID]; ok {
+		conversationMember.LastSeenAt = &lastSeen
+	}
+	return conversationMember
+}
+
+// addMessage adds a message to a conversation and bumps its activity
+func (s *MemoryStore) addMessage(conversation *memoryConversation, req *CreateMessageRequest) *Message {
+	message := &Message{
+		ID:             s.nextID(),
+		ConversationID: conversation.ID,
+		UserID:         req.UserID,
+		Kind:           req.Kind,
+		Content:        req.Content,
+		Created_at:     time.Now().UTC(),
+	}
+	if message.Kind == "" {
+		message.Kind = MessageText
+	}
+	s.messages[message.ID] = message
+	conversation.LastMessageAt = message.Created_at
+
+	// senders have read their own message
+	if member, ok := conversation.Members[message.UserID]; ok {
+		member.LastReadMessageID = message.ID
+	}
+
+	clone := *message
+	return &clone
+}
+
+// addMembers adds userIDs to a group, skipping existing members, and fails
+// with errGroupFull when that would exceed maxGroupMembers
+func (s *MemoryStore) addMembers(conversation *memoryConversation, userIDs []int64) error {
+	added := map[int64]bool{}
+	for _, userID := range userIDs {
+		if _, ok := s.users[userID]; !ok {
+			return fmt.Errorf("user %d not found", userID)
+		}
+		if _, ok := conversation.Members[userID]; !ok {
+			added[userID] = true
+		}
+	}
+	if len(conversation.Members)+len(added) > maxGroupMembers {
+		return errGroupFull
+	}
+
+	now := time.Now().UTC()
+	for userID := range added {
+		conversation.Members[userID] = &memoryMember{Role: RoleMember, Joined_at: now}
+	}
+	return nil
+}
+
+func (s *MemoryStore) nameRow(userID int64, createdAt time.Time, id int64) *nameRow {
+	return &nameRow{
+		Name:   s.users[userID].UserName,
+		Cursor: Cursor{CreatedAt: createdAt, ID: id},
+	}
+}
+
+// paginate orders items newest first and returns the page after page.After,
+// the same way the postgres queries do
+func paginate[T any](items []T, page *PageRequest, cursorOf func(T) Cursor) *Page[T] {
+	return newPage(pageRows(items, page, cursorOf), page, cursorOf)
+}
+
+func paginateNames(rows []*nameRow, page *PageRequest) *Page[string] {
+	return newNamePage(pageRows(rows, page, func(row *nameRow) Cursor { return row.Cursor }), page)
+}
+
+// pageRows returns up to page.Limit+1 items following page.After, newest first
+func pageRows[T any](items []T, page *PageRequest, cursorOf func(T) Cursor) []T {
+	sortNewestFirst(items, cursorOf)
+
+	rows := []T{}
+	for _, item := range items {
+		if len(rows) > page.Limit {
+			break
+		}
+		cursor := cursorOf(item)
+		if page.After.after(cursor.CreatedAt, cursor.ID) {
+			rows = append(rows, item)
+		}
+	}
+	return rows
+}
+
+// react sets userID's reaction to a target, replacing any earlier one
+func (s *MemoryStore) react(likes map[int64]*memoryLike, userID, targetID int64, reaction string) error {
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("user %d not found", userID)
+	}
+	for _, like := range likes {
+		if like.UserID == userID && like.TargetID == targetID {
+			if like.Reaction == reaction {
+				return fmt.Errorf("user %d already reacted to %d with %s", userID, targetID, reaction)
+			}
+			like.Reaction = reaction
+			like.Created_at = time.Now().UTC()
+			return nil
+		}
+	}
+
+	id := s.nextID()
+	likes[id] = &memoryLike{
+		ID:         id,
+		UserID:     userID,
+		TargetID:   targetID,
+		Reaction:   reaction,
+		Created_at: time.Now().UTC(),
+	}
+	return nil
+}
+
+// reactedBy lists who reacted to a target with reaction, or with any reaction
+// when it's empty, leaving out users blocked either way by viewerID
+func (s *MemoryStore) reactedBy(likes map[int64]*memoryLike, targetID int64, reaction string, viewerID int64) []*nameRow {
+	rows := []*nameRow{}
+	for _, like := range likes {
+		if like.TargetID == targetID && (reaction == "" || like.Reaction == reaction) && !s.blocked(viewerID, like.UserID) {
+			rows = append(rows, s.nameRow(like.UserID, like.Created_at, like.ID))
+		}
+	}
+	return rows
+}
+
+// reactionCounts counts the reactions to a target by emoji
+func reactionCounts(likes map[int64]*memoryLike, targetID int64) Reactions {
+	counts := Reactions{}
+	for _, like := range likes {
+		if like.TargetID == targetID {
+			counts[like.Reaction]++
+		}
+	}
+	return counts
+}
+
+func (s *MemoryStore) deletePostReactionNotifications(userID, postID int64) {
+	s.deleteNotifications(func(notification *Notification) bool {
+		return notification.ActorID == userID && notification.CommentID == nil &&
+			(notification.Type == NotificationLikePost || notification.Type == NotificationReactPost) &&
+			idOrZero(notification.PostID) == postID
+	})
+}
+
+func (s *MemoryStore) deleteCommentReactionNotifications(userID, commentID int64) {
+	s.deleteNotifications(func(notification *Notification) bool {
+		return notification.ActorID == userID &&
+			(notification.Type == NotificationLikeComment || notification.Type == NotificationReactComment) &&
+			idOrZero(notification.CommentID) == commentID
+	})
+}
+
+func (s *MemoryStore) unlike(likes map[int64]*memoryLike, userID, targetID int64) {
+	for id, like := range likes {
+		if like.UserID == userID && like.TargetID == targetID {
+			delete(likes, id)
+		}
+	}
+}
+
+// indexMentions stores the mentions of a post's content, or of a comment's
+// when commentID is set, in place of the ones it had. Users mentioned for the
+// first time are notified, and users no longer mentioned lose their
+// notification, like the postgres indexMentions.
+func (s *MemoryStore) indexMentions(authorID, postID int64, commentID *int64, content string, createdAt time.Time) {
+	previous := map[int64]bool{}
+	for id, mention := range s.mentions {
+		if mention.PostID == postID && idOrZero(mention.CommentID) == idOrZero(commentID) {
+			previous[mention.UserID] = true
+			delete(s.mentions, id)
+		}
+	}
+
+	matches := extractMentions(content)
+	userIDs := map[string]int64{}
+	for _, name := range mentionedNames(matches) {
+		if user := s.userByName(name); user != nil {
+			userIDs[name] = user.ID
+		}
+	}
+
+	mentioned := map[int64]bool{}
+	for _, mention := range resolveMentions(matches, userIDs) {
+		id := s.nextID()
+		s.mentions[id] = &memoryMention{
+			ID:         id,
+			UserID:     mention.UserID,
+			AuthorID:   authorID,
+			PostID:     postID,
+			CommentID:  commentID,
+			Position:   mention.Offset,
+			Length:     mention.Length,
+			Created_at: createdAt,
+		}
+		if !previous[mention.UserID] && !mentioned[mention.UserID] {
+			s.notify(mention.UserID, authorID, NotificationMention, &postID, commentID)
+		}
+		mentioned[mention.UserID] = true
+	}
+
+	s.deleteNotifications(func(notification *Notification) bool {
+		return notification.Type == NotificationMention && notification.ActorID == authorID &&
+			previous[notification.UserID] && !mentioned[notification.UserID] &&
+			idOrZero(notification.PostID) == postID && idOrZero(notification.CommentID) == idOrZero(commentID)
+	})
+}
+
+// mentionsOf returns the mentions of a post, or of one of its comments when
+// commentID is set, ordered by offset
+func (s *MemoryStore) mentionsOf(postID int64, commentID *int64) Mentions {
+	mentions := Mentions{}
+	for _, mention := range s.mentions {
+		if mention.PostID == postID && idOrZero(mention.CommentID) == idOrZero(commentID) {
+			mentions = append(mentions, &Mention{
+				UserID:   mention.UserID,
+				UserName: s.users[mention.UserID].UserName,
+				Offset:   mention.Position,
+				Length:   mention.Length,
+			})
+		}
+	}
+	sort.Slice(mentions, func(i, j int) bool {
+		return mentions[i].Offset < mentions[j].Offset
+	})
+	return mentions
+}
+
+// deleteUser removes a user and everything that references it, matching the
+// ON DELETE CASCADE foreign keys of the postgres schema
+func (s *MemoryStore) deleteUser(id int64) {
+	for postID, post := range s.posts {
+		if post.UserID == id {
+			s.deletePost(postID)
+		}
+	}
+	for commentID, comment := range s.comments {
+		if comment.UserID == id {
+			s.deleteComment(commentID)
+		}
+	}
+	for followID, follow := range s.follows {
+		if follow.UserID == id || follow.FollowerID == id {
+			delete(s.follows, followID)
+		}
+	}
+	for requestID, request := range s.followRequests {
+		if request.UserID == id || request.FollowerID == id {
+			delete(s.followRequests, requestID)
+		}
+	}
+	for likeID, like := range s.postLikes {
+		if like.UserID == id {
+			delete(s.postLikes, likeID)
+		}
+	}
+	for likeID, like := range s.commentLikes {
+		if like.UserID == id {
+			delete(s.commentLikes, likeID)
+		}
+	}
+	for sessionID, session := range s.sessions {
+		if session.UserID == id {
+			delete(s.sessions, sessionID)
+		}
+	}
+	for messageID, message := range s.messages {
+		if message.UserID == id {
+			delete(s.messages, messageID)
+		}
+	}
+	for _, conversation := range s.conversations {
+		delete(conversation.Members, id)
+	}
+	s.deleteNotifications(func(notification *Notification) bool {
+		return notification.UserID == id || notification.ActorID == id
+	})
+	delete(s.timelines, id)
+	delete(s.lastSeen, id)
+	delete(s.blocks, id)
+	delete(s.mutes, id)
+	for _, blocked := range s.blocks {
+		delete(blocked, id)
+	}
+	for _, muted := range s.mutes {
+		delete(muted, id)
+	}
+	for bookmarkID, bookmark := range s.bookmarks {
+		if bookmark.UserID == id {
+			delete(s.bookmarks, bookmarkID)
+		}
+	}
+	for collectionID, collection := range s.collections {
+		if collection.UserID == id {
+			s.deleteCollection(collectionID)
+		}
+	}
+	for mentionID, mention := range s.mentions {
+		if mention.UserID == id || mention.AuthorID == id {
+			delete(s.mentions, mentionID)
+		}
+	}
+	delete(s.users, id)
+}
+
+// deletePost deletes a post along with its reposts. Quotes of it are kept,
+// without their original.
+func (s *MemoryStore) deletePost(id int64) {
+	for repostID, repost := range s.posts {
+		if idOrZero(repost.RepostOfID) == id {
+			s.deletePost(repostID)
+		}
+	}
+	for commentID, comment := range s.comments {
+		if comment.PostID == id {
+			s.deleteComment(commentID)
+		}
+	}
+	for likeID, like := range s.postLikes {
+		if like.TargetID == id {
+			delete(s.postLikes, likeID)
+		}
+	}
+	for _, timeline := range s.timelines {
+		delete(timeline, id)
+	}
+	s.deleteNotifications(func(notification *Notification) bool {
+		return idOrZero(notification.PostID) == id
+	})
+	for bookmarkID, bookmark := range s.bookmarks {
+		if bookmark.PostID == id {
+			delete(s.bookmarks, bookmarkID)
+		}
+	}
+	delete(s.pulledPosts, id)
+	for mentionID, mention := range s.mentions {
+		if mention.PostID == id {
+			delete(s.mentions, mentionID)
+		}
+	}
+	delete(s.postTags, id)
+	delete(s.posts, id)
+}
+
+// deleteCollection deletes a collection, keeping its bookmarks outside of any
+// collection
+func (s *MemoryStore) deleteCollection(id int64) {
+	for _, bookmark := range s.bookmarks {
+		if idOrZero(bookmark.CollectionID) == id {
+			bookmark.CollectionID = nil
+		}
+	}
+	delete(s.collections, id)
+}
+
+// collectionNamed reports whether userID has a collection called name, other
+// than the collection exceptID
+func (s *MemoryStore) collectionNamed(userID int64, name string, exceptID int64) bool {
+	for _, collection := range s.collections {
+		if collection.UserID == userID && collection.Name == name && collection.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) deleteConversation(id int64) {
+	for messageID, message := range s.messages {
+		if message.ConversationID == id {
+			delete(s.messages, messageID)
+		}
+	}
+	delete(s.conversations, id)
+}
+
+// deleteComment deletes a comment along with its replies
+func (s *MemoryStore) deleteComment(id int64) {
+	for replyID, reply := range s.comments {
+		if idOrZero(reply.ParentCommentID) == id {
+			s.deleteComment(replyID)
+		}
+	}
+	for likeID, like := range s.commentLikes {
+		if like.TargetID == id {
+			delete(s.commentLikes, likeID)
+		}
+	}
+	s.deleteNotifications(func(notification *Notification) bool {
+		return idOrZero(notification.CommentID) == id
+	})
+	for mentionID, mention := range s.mentions {
+		if idOrZero(mention.CommentID) == id {
+			delete(s.mentions, mentionID)
+		}
+	}
+	delete(s.comments, id)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var firstPage = &PageRequest{Limit: maxPageSize}
+
+func createTestUser(t *testing.T, s Storage, username string) *User {
+	t.Helper()
+	user := &User{UserName: username, Email: username + "@example.com", Created_at: time.Now().UTC()}
+	if err := s.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser returned an error: %v", err)
+	}
+	return user
+}
+
+func TestMemoryStoreDeleteUserCascades(t *testing.T) {
+	s := NewMemoryStore()
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+
+	if _, err := s.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	posts, _ := s.GetUserPosts("alice", firstPage)
+	postID := posts.Items[0].ID
+
+	s.CreateComment(postID, &CreateCommentRequest{UserID: bob.ID, Text: "hi"})
+	s.LikePost(bob.ID, postID)
+	s.CreateFollow(&FollowRequest{UserID: bob.ID, FollowingID: alice.ID})
+
+	if err := s.DeleteUser("alice"); err != nil {
+		t.Fatalf("DeleteUser returned an error: %v", err)
+	}
+
+	if post, _ := s.GetPost(postID); post != nil {
+		t.Error("Expected alice's post to be deleted")
+	}
+	if comments, _ := s.GetCommentsFromPost(postID, CommentsViewPreview, 0, firstPage); len(comments.Items) != 0 {
+		t.Error("Expected comments on alice's post to be deleted")
+	}
+	if following, _ := s.GetFollowing("bob", firstPage); len(following.Items) != 0 {
+		t.Errorf("Expected bob's follow of alice to be deleted, got %v", following.Items)
+	}
+	if len(s.postLikes) != 0 {
+		t.Error("Expected likes on alice's post to be deleted")
+	}
+	if len(s.notifications) != 0 {
+		t.Error("Expected alice's notifications to be deleted")
+	}
+}
+
+func TestMemoryStoreUniqueness(t *testing.T) {
+	s := NewMemoryStore()
+	alice := createTestUser(t, s, "alice")
+	createTestUser(t, s, "bob")
+
+	if err := s.CreateUser(&User{UserName: "alice"}); err == nil {
+		t.Error("Expected duplicate username to be rejected")
+	}
+	if err := s.UpdateUser("bob", &UpdateUserRequest{UserName: "alice"}); err == nil {
+		t.Error("Expected rename to a taken username to be rejected")
+	}
+
+	s.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "hello"})
+	posts, _ := s.GetUserPosts("alice", firstPage)
+	if err := s.LikePost(alice.ID, posts.Items[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LikePost(alice.ID, posts.Items[0].ID); err == nil {
+		t.Error("Expected duplicate like to be rejected")
+	}
+}
+
+func TestMemoryStoreConcurrentAccess(t *testing.T) {
+	s := NewMemoryStore()
+	alice := createTestUser(t, s, "alice")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "post"})
+		}()
+		go func() {
+			defer wg.Done()
+			s.GetUserProfile("alice", 0)
+		}()
+	}
+	wg.Wait()
+
+	if posts, _ := s.GetUserPosts("alice", firstPage); len(posts.Items) != 50 {
+		t.Errorf("Expected 50 posts, got %d", len(posts.Items))
+	}
+}
+
+func feedContents(t *testing.T, s Storage, userID int64) []string {
+	t.Helper()
+	feed, err := s.GetFeed(userID, firstPage)
+	if err != nil {
+		t.Fatalf("GetFeed returned an error: %v", err)
+	}
+
+	contents := []string{}
+	for _, post := range feed.Items {
+		contents = append(contents, post.Content)
+	}
+	return contents
+}
+
+func TestMemoryStoreTimelineFanout(t *testing.T) {
+	s := NewMemoryStore()
+	s.fanoutLimit = 1
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	celebrity := createTestUser(t, s, "celebrity")
+
+	s.CreateFollow(&FollowRequest{UserID: alice.ID, FollowingID: celebrity.ID})
+	s.CreateFollow(&FollowRequest{UserID: bob.ID, FollowingID: celebrity.ID})
+	s.CreatePost(&CreatePostRequest{UserID: celebrity.ID, Content: "pulled"})
+	s.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "pushed"})
+
+	if len(s.pulledPosts) != 1 {
+		t.Errorf("Expected the celebrity's post to be merged on read, got %d pulled posts", len(s.pulledPosts))
+	}
+	if len(s.timelines[alice.ID]) != 1 {
+		t.Errorf("Expected alice's own post in her timeline, got %v", s.timelines[alice.ID])
+	}
+
+	if feed := feedContents(t, s, alice.ID); len(feed) != 2 || feed[0] != "pushed" || feed[1] != "pulled" {
+		t.Errorf("Expected alice's feed to merge pushed and pulled posts, got %v", feed)
+	}
+	if feed := feedContents(t, s, bob.ID); len(feed) != 1 || feed[0] != "pulled" {
+		t.Errorf("Expected bob's feed to have the celebrity's post, got %v", feed)
+	}
+
+	// following backfills the timeline and unfollowing prunes it
+	s.CreateFollow(&FollowRequest{UserID: bob.ID, FollowingID: alice.ID})
+	if feed := feedContents(t, s, bob.ID); len(feed) != 2 {
+		t.Errorf("Expected alice's post to be backfilled into bob's feed, got %v", feed)
+	}
+
+	s.DeleteFollow(&FollowRequest{UserID: bob.ID, FollowingID: alice.ID})
+	if len(s.timelines[bob.ID]) != 0 {
+		t.Errorf("Expected alice's posts to be pruned from bob's timeline, got %v", s.timelines[bob.ID])
+	}
+
+	// deleting a post removes it from every timeline
+	s.CreateFollow(&FollowRequest{UserID: bob.ID, FollowingID: alice.ID})
+	posts, _ := s.GetUserPosts("alice", firstPage)
+	s.DeletePost(posts.Items[0].ID)
+	if feed := feedContents(t, s, bob.ID); len(feed) != 1 || feed[0] != "pulled" {
+		t.Errorf("Expected the deleted post to be gone from bob's feed, got %v", feed)
+	}
+	if len(s.timelines[alice.ID]) != 0 {
+		t.Errorf("Expected the deleted post to be gone from alice's timeline, got %v", s.timelines[alice.ID])
+	}
+}
+
+func TestMemoryStoreThreadedCommentsBounded(t *testing.T) {
+	s := NewMemoryStore()
+	alice := createTestUser(t, s, "alice")
+	post, _ := s.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "thoughts?"})
+
+	// 11 comments with one more reply each than a thread lists
+	for i := 0; i < 11; i++ {
+		comment, _ := s.CreateComment(post.ID, &CreateCommentRequest{UserID: alice.ID, Text: "comment"})
+		for j := 0; j <= threadRepliesSize; j++ {
+			s.CreateComment(post.ID, &CreateCommentRequest{UserID: alice.ID, Text: "reply", ParentCommentID: &comment.ID})
+		}
+	}
+
+	comments, err := s.GetCommentsFromPost(post.ID, CommentsViewThreaded, alice.ID, firstPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, comment := range comments.Items {
+		if len(comment.Replies) > threadRepliesSize {
+			t.Errorf("Expected at most %d replies per comment, got %d", threadRepliesSize, len(comment.Replies))
+		}
+		total += len(comment.Replies)
+	}
+	if total != threadSize {
+		t.Errorf("Expected %d replies in all, got %d", threadSize, total)
+	}
+}
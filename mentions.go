@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// mentionPattern matches an @ followed by a username, unless it's glued to a
+// preceding word like in an email address
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_]+)`)
+
+// Mention links an @username in a post's or comment's content to the user
+// mentioned. Offset and Length count characters (Unicode code points) and
+// span the @ too.
+type Mention struct {
+	UserID   int64  `json:"userID"`
+	UserName string `json:"userName"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+}
+
+// Mentions are the mentions of a post or comment ordered by offset
+type Mentions []*Mention
+
+// Scan reads the JSON array of mentions selected by postColumns and
+// commentColumns
+func (m *Mentions) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("unexpected mentions type %T", src)
+	}
+	return json.Unmarshal(b, m)
+}
+
+// UserMention is a post, or a comment on it, mentioning a user
+type UserMention struct {
+	ID         int64     `json:"id"`
+	Created_at time.Time `json:"createdAt"`
+	Post       *Post     `json:"post"`
+	Comment    *Comment  `json:"comment,omitempty"`
+}
+
+// mentionMatch is an @username found in some content, before it's resolved
+// to a user
+type mentionMatch struct {
+	UserName string
+	Offset   int
+	Length   int
+}
+
+// extractMentions returns the @usernames of a post's or comment's content in
+// the order they appear
+func extractMentions(content string) []mentionMatch {
+	matches := []mentionMatch{}
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		// the @ is right before the username captured by the group
+		start, end := loc[2]-1, loc[3]
+		matches = append(matches, mentionMatch{
+			UserName: content[loc[2]:end],
+			Offset:   utf8.RuneCountInString(content[:start]),
+			Length:   utf8.RuneCountInString(content[start:end]),
+		})
+	}
+	return matches
+}
+
+// mentionedNames returns the distinct usernames of matches
+func mentionedNames(matches []mentionMatch) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, match := range matches {
+		if !seen[match.UserName] {
+			seen[match.UserName] = true
+			names = append(names, match.UserName)
+		}
+	}
+	return names
+}
+
+// resolveMentions links matches to the users in userIDs, keyed by username.
+// Matches of usernames nobody has aren't mentions.
+func resolveMentions(matches []mentionMatch, userIDs map[string]int64) Mentions {
+	mentions := Mentions{}
+	for _, match := range matches {
+		if userID, ok := userIDs[match.UserName]; ok {
+			mentions = append(mentions, &Mention{
+				UserID:   userID,
+				UserName: match.UserName,
+				Offset:   match.Offset,
+				Length:   match.Length,
+			})
+		}
+	}
+	return mentions
+}
+
+func userMentionCursor(mention *UserMention) Cursor {
+	return Cursor{CreatedAt: mention.Created_at, ID: mention.ID}
+}
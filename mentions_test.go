@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []mentionMatch
+	}{
+		{"no mentions", []mentionMatch{}},
+		{"@alice and @bob_2!", []mentionMatch{{"alice", 0, 6}, {"bob_2", 11, 6}}},
+		{"mail bob@example.com, not @@alice", []mentionMatch{}},
+		{"héllo 👋 @zoë", []mentionMatch{{"zoë", 8, 4}}},
+	}
+
+	for _, test := range tests {
+		if got := extractMentions(test.content); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("extractMentions(%q) = %v, want %v", test.content, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Values of a user's allowMessagesFrom setting
+const (
+	MessagesFromEveryone  = "everyone"
+	MessagesFromFollowing = "following"
+)
+
+// Kinds of conversations
+const (
+	ConversationDirect = "direct"
+	ConversationGroup  = "group"
+)
+
+// Roles of group members, admins can rename the group and manage members
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Kinds of messages, system messages record changes to a group
+const (
+	MessageText   = "text"
+	MessageSystem = "system"
+)
+
+const (
+	maxMessageLength    = 2000
+	maxGroupTitleLength = 100
+	maxGroupMembers     = 500
+)
+
+var errGroupFull = fmt.Errorf("group can't have more than %d members", maxGroupMembers)
+
+func validAllowMessagesFrom(setting string) bool {
+	return setting == MessagesFromEveryone || setting == MessagesFromFollowing
+}
+
+// directConversationKey identifies the 1:1 conversation between two users
+// regardless of who started it
+func directConversationKey(userID, otherID int64) string {
+	if userID > otherID {
+		userID, otherID = otherID, userID
+	}
+	return fmt.Sprintf("%d:%d", userID, otherID)
+}
+
+func validRole(role string) bool {
+	return role == RoleAdmin || role == RoleMember
+}
+
+func validateGroupTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", fmt.Errorf("Group title can't be empty")
+	}
+	if utf8.RuneCountInString(title) > maxGroupTitleLength {
+		return "", fmt.Errorf("Group title can't be longer than %d characters", maxGroupTitleLength)
+	}
+	return title, nil
+}
+
+func validateMessage(req *CreateMessageRequest) error {
+	req.Content = strings.TrimSpace(req.Content)
+	if req.Content == "" {
+		return fmt.Errorf("Message can't be empty")
+	}
+	if utf8.RuneCountInString(req.Content) > maxMessageLength {
+		return fmt.Errorf("Message can't be longer than %d characters", maxMessageLength)
+	}
+	return nil
+}
+
+// canMessage reports whether senderID may message recipient. Users who
+// blocked each other can't, and users who only accept messages from people
+// they follow have to follow the sender.
+func (s *ApiServer) canMessage(senderID int64, recipient *User) (bool, error) {
+	blocked, err := s.Store.IsBlocked(senderID, recipient.ID)
+	if err != nil || blocked {
+		return false, err
+	}
+	if recipient.AllowMessagesFrom != MessagesFromFollowing {
+		return true, nil
+	}
+	return s.Store.IsFollowing(recipient.ID, senderID)
+}
+
+// systemMessage builds the system message recording a change made by actorID
+func systemMessage(actorID int64, format string, args ...any) *CreateMessageRequest {
+	return &CreateMessageRequest{
+		UserID:  actorID,
+		Kind:    MessageSystem,
+		Content: fmt.Sprintf(format, args...),
+	}
+}
+
+// joinNames lists names as "alice", "alice and bob" or "alice, bob and carol"
+func joinNames(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
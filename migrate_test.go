@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := NewMigrator(nil)
+	if err != nil {
+		t.Fatalf("NewMigrator returned an error: %v", err)
+	}
+
+	for i, migration := range migrator.migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("Expected migration versions to be sequential, got %d at position %d", migration.Version, i)
+		}
+	}
+}
+
+func TestParseMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_bio.up.sql":        {Data: []byte("ALTER TABLE users ADD COLUMN bio TEXT;")},
+		"0002_add_bio.down.sql":      {Data: []byte("ALTER TABLE users DROP COLUMN bio;")},
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id SERIAL);")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"README.md":                  {Data: []byte("not a migration")},
+		"0010_create_posts.up.sql":   {Data: []byte("CREATE TABLE posts (id SERIAL);")},
+		"0010_create_posts.down.sql": {Data: []byte("DROP TABLE posts;")},
+	}
+
+	migrations, err := parseMigrations(fsys)
+	if err != nil {
+		t.Fatalf("parseMigrations returned an error: %v", err)
+	}
+
+	expected := []string{"create_users", "add_bio", "create_posts"}
+	if len(migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(migrations))
+	}
+	for i, name := range expected {
+		if migrations[i].Name != name {
+			t.Errorf("Expected migration %d to be %s, got %s", i, name, migrations[i].Name)
+		}
+	}
+	if migrations[0].Down != "DROP TABLE users;" {
+		t.Errorf("Unexpected down migration: %q", migrations[0].Down)
+	}
+}
+
+func TestParseMigrationsErrors(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_create_users.up.sql": {Data: []byte("CREATE TABLE users (id SERIAL);")},
+		},
+		"duplicate version": {
+			"0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_a.down.sql": {Data: []byte("SELECT 1;")},
+			"0001_b.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_b.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"no direction": {
+			"0001_a.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad version": {
+			"first_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"first_a.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+
+	for name, fsys := range tests {
+		if _, err := parseMigrations(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS comment_likes;
+DROP TABLE IF EXISTS post_likes;
+DROP TABLE IF EXISTS follows;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS users;
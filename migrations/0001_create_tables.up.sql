@@ -0,0 +1,57 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	userName VARCHAR(25) NOT NULL UNIQUE,
+	name VARCHAR(225),
+	email VARCHAR(255) NOT NULL,
+	bio VARCHAR(255),
+	passwordHash VARCHAR(1000) NOT NULL,
+	created_at timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS posts (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	content VARCHAR(255) NOT NULL,
+	mediaUrl VARCHAR(10000),
+	created_at timestamptz NOT NULL,
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	postID BIGINT NOT NULL,
+	content VARCHAR(255) NOT NULL,
+	created_at timestamptz NOT NULL,
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (postID) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS follows (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	followerID BIGINT NOT NULL,
+	created_at timestamptz NOT NULL,
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (followerID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS post_likes (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	postID BIGINT NOT NULL,
+	created_at timestamptz NOT NULL,
+	UNIQUE (userID, postID),
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (postID) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS comment_likes (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	commentID BIGINT NOT NULL,
+	created_at timestamptz NOT NULL,
+	UNIQUE (userID, commentID),
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (commentID) REFERENCES comments (id) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id VARCHAR(64) PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	refreshToken VARCHAR(128) NOT NULL UNIQUE,
+	expirationTime timestamptz NOT NULL,
+	isBlocked BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at timestamptz NOT NULL,
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- sessions created before device tracking was added don't have these columns
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS device VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS userAgent VARCHAR(1000) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS lastUsedAt timestamptz NOT NULL DEFAULT now();
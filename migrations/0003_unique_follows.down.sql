@@ -0,0 +1 @@
+ALTER TABLE follows DROP CONSTRAINT IF EXISTS follows_userid_followerid_key;
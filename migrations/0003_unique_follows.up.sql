@@ -0,0 +1,6 @@
+-- keep the oldest of any duplicated follows before enforcing uniqueness
+DELETE FROM follows a
+	USING follows b
+	WHERE a.userID = b.userID AND a.followerID = b.followerID AND a.id > b.id;
+
+ALTER TABLE follows ADD CONSTRAINT follows_userid_followerid_key UNIQUE (userID, followerID);
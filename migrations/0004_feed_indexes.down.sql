@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS follows_followerid_idx;
+DROP INDEX IF EXISTS posts_userid_created_at_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS posts_userid_created_at_idx ON posts (userID, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS follows_followerid_idx ON follows (followerID);
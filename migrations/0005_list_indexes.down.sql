@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS follows_followerid_idx ON follows (followerID);
+DROP INDEX IF EXISTS follows_followerid_created_at_idx;
+DROP INDEX IF EXISTS follows_userid_created_at_idx;
+DROP INDEX IF EXISTS post_likes_postid_created_at_idx;
+DROP INDEX IF EXISTS comments_postid_created_at_idx;
@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS comments_postid_created_at_idx ON comments (postID, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS post_likes_postid_created_at_idx ON post_likes (postID, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS follows_userid_created_at_idx ON follows (userID, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS follows_followerid_created_at_idx ON follows (followerID, created_at DESC, id DESC);
+DROP INDEX IF EXISTS follows_followerid_idx;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS posts_pulled_userid_created_at_idx;
+DROP TABLE IF EXISTS timelines;
+ALTER TABLE posts DROP COLUMN IF EXISTS fannedOut;
@@ -0,0 +1,17 @@
+-- posts created before timelines existed are merged into feeds on read
+ALTER TABLE posts ADD COLUMN fannedOut BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS timelines (
+	userID BIGINT NOT NULL,
+	postID BIGINT NOT NULL,
+	authorID BIGINT NOT NULL,
+	created_at timestamptz NOT NULL,
+	PRIMARY KEY (userID, postID),
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (postID) REFERENCES posts (id) ON DELETE CASCADE,
+	FOREIGN KEY (authorID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS timelines_userid_created_at_idx ON timelines (userID, created_at DESC, postID DESC);
+CREATE INDEX IF NOT EXISTS timelines_userid_authorid_idx ON timelines (userID, authorID);
+CREATE INDEX IF NOT EXISTS posts_pulled_userid_created_at_idx ON posts (userID, created_at DESC, id DESC) WHERE fannedOut = FALSE;
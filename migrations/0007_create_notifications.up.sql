@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS notifications (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	actorID BIGINT NOT NULL,
+	type VARCHAR(32) NOT NULL,
+	postID BIGINT,
+	commentID BIGINT,
+	isRead BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at timestamptz NOT NULL,
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (actorID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (postID) REFERENCES posts (id) ON DELETE CASCADE,
+	FOREIGN KEY (commentID) REFERENCES comments (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS notifications_userid_created_at_idx ON notifications (userID, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (userID) WHERE isRead = FALSE;
@@ -0,0 +1,33 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS allowMessagesFrom VARCHAR(16) NOT NULL DEFAULT 'everyone';
+
+-- directKey identifies the 1:1 conversation between two users, so there is
+-- at most one per pair
+CREATE TABLE IF NOT EXISTS conversations (
+	id SERIAL PRIMARY KEY,
+	directKey VARCHAR(64) UNIQUE,
+	created_at timestamptz NOT NULL,
+	lastMessageAt timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS conversation_members (
+	conversationID BIGINT NOT NULL,
+	userID BIGINT NOT NULL,
+	joined_at timestamptz NOT NULL,
+	PRIMARY KEY (conversationID, userID),
+	FOREIGN KEY (conversationID) REFERENCES conversations (id) ON DELETE CASCADE,
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id SERIAL PRIMARY KEY,
+	conversationID BIGINT NOT NULL,
+	userID BIGINT NOT NULL,
+	content VARCHAR(2000) NOT NULL,
+	created_at timestamptz NOT NULL,
+	FOREIGN KEY (conversationID) REFERENCES conversations (id) ON DELETE CASCADE,
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS conversation_members_userid_idx ON conversation_members (userID);
+CREATE INDEX IF NOT EXISTS conversations_last_message_at_idx ON conversations (lastMessageAt DESC, id DESC);
+CREATE INDEX IF NOT EXISTS messages_conversationid_created_at_idx ON messages (conversationID, created_at DESC, id DESC);
@@ -0,0 +1,6 @@
+DELETE FROM conversations WHERE kind = 'group';
+
+ALTER TABLE messages DROP COLUMN IF EXISTS kind;
+ALTER TABLE conversation_members DROP COLUMN IF EXISTS role;
+ALTER TABLE conversations DROP COLUMN IF EXISTS title;
+ALTER TABLE conversations DROP COLUMN IF EXISTS kind;
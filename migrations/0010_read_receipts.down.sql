@@ -0,0 +1,3 @@
+ALTER TABLE conversation_members DROP COLUMN IF EXISTS lastReadMessageID;
+ALTER TABLE users DROP COLUMN IF EXISTS lastSeenAt;
+ALTER TABLE users DROP COLUMN IF EXISTS hideReadReceipts;
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hideReadReceipts BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS lastSeenAt timestamptz;
+
+-- lastReadMessageID is the newest message a member has seen, message ids
+-- only grow so everything up to it counts as read
+ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS lastReadMessageID BIGINT;
@@ -0,0 +1,21 @@
+-- blocks.userID blocked blockedID, mutes.userID muted mutedID
+CREATE TABLE IF NOT EXISTS blocks (
+	userID BIGINT NOT NULL,
+	blockedID BIGINT NOT NULL,
+	created_at timestamptz NOT NULL,
+	PRIMARY KEY (userID, blockedID),
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (blockedID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS mutes (
+	userID BIGINT NOT NULL,
+	mutedID BIGINT NOT NULL,
+	created_at timestamptz NOT NULL,
+	PRIMARY KEY (userID, mutedID),
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (mutedID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS blocks_blockedid_idx ON blocks (blockedID);
+CREATE INDEX IF NOT EXISTS mutes_mutedid_idx ON mutes (mutedID);
@@ -0,0 +1,4 @@
+DELETE FROM notifications WHERE type IN ('follow_request', 'follow_accepted');
+
+DROP TABLE IF EXISTS follow_requests;
+ALTER TABLE users DROP COLUMN IF EXISTS isPrivate;
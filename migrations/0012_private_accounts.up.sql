@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS isPrivate BOOLEAN NOT NULL DEFAULT false;
+
+-- follow_requests.userID is the private account, requesterID the account
+-- asking to follow it
+CREATE TABLE IF NOT EXISTS follow_requests (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	requesterID BIGINT NOT NULL,
+	created_at timestamptz NOT NULL,
+	UNIQUE (userID, requesterID),
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (requesterID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS follow_requests_userid_created_at_idx ON follow_requests (userID, created_at DESC, id DESC);
@@ -0,0 +1,8 @@
+DELETE FROM notifications WHERE type IN ('repost', 'quote');
+DELETE FROM posts WHERE repostOfID IS NOT NULL;
+
+DROP INDEX IF EXISTS posts_quoteofid_idx;
+DROP INDEX IF EXISTS posts_repostofid_idx;
+DROP INDEX IF EXISTS posts_userid_repostofid_idx;
+ALTER TABLE posts DROP COLUMN IF EXISTS quoteOfID;
+ALTER TABLE posts DROP COLUMN IF EXISTS repostOfID;
@@ -0,0 +1,9 @@
+-- a repost shares repostOfID as is and is removed along with it. A quote
+-- shares quoteOfID with commentary and outlives it, so quoteOfID has no
+-- foreign key and may point at a deleted post.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS repostOfID BIGINT REFERENCES posts (id) ON DELETE CASCADE;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS quoteOfID BIGINT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS posts_userid_repostofid_idx ON posts (userID, repostOfID) WHERE repostOfID IS NOT NULL;
+CREATE INDEX IF NOT EXISTS posts_repostofid_idx ON posts (repostOfID) WHERE repostOfID IS NOT NULL;
+CREATE INDEX IF NOT EXISTS posts_quoteofid_idx ON posts (quoteOfID) WHERE quoteOfID IS NOT NULL;
@@ -0,0 +1,7 @@
+DELETE FROM notifications WHERE type = 'reply';
+DELETE FROM comments WHERE parentCommentID IS NOT NULL;
+
+DROP INDEX IF EXISTS comments_top_level_postid_created_at_idx;
+DROP INDEX IF EXISTS comments_parentcommentid_created_at_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS depth;
+ALTER TABLE comments DROP COLUMN IF EXISTS parentCommentID;
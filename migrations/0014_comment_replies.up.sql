@@ -0,0 +1,7 @@
+-- replies point at the comment they reply to and are deleted along with it.
+-- depth is 0 for top-level comments.
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parentCommentID BIGINT REFERENCES comments (id) ON DELETE CASCADE;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS depth INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS comments_parentcommentid_created_at_idx ON comments (parentCommentID, created_at DESC, id DESC) WHERE parentCommentID IS NOT NULL;
+CREATE INDEX IF NOT EXISTS comments_top_level_postid_created_at_idx ON comments (postID, created_at DESC, id DESC) WHERE parentCommentID IS NULL;
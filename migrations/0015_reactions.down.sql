@@ -0,0 +1,6 @@
+DELETE FROM notifications WHERE type IN ('react_post', 'react_comment');
+
+DROP INDEX IF EXISTS comment_likes_commentid_reaction_created_at_idx;
+DROP INDEX IF EXISTS post_likes_postid_reaction_created_at_idx;
+ALTER TABLE comment_likes DROP COLUMN IF EXISTS reaction;
+ALTER TABLE post_likes DROP COLUMN IF EXISTS reaction;
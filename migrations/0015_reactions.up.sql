@@ -0,0 +1,6 @@
+-- likes become reactions, existing likes being the default 👍 reaction
+ALTER TABLE post_likes ADD COLUMN IF NOT EXISTS reaction TEXT NOT NULL DEFAULT '👍';
+ALTER TABLE comment_likes ADD COLUMN IF NOT EXISTS reaction TEXT NOT NULL DEFAULT '👍';
+
+CREATE INDEX IF NOT EXISTS post_likes_postid_reaction_created_at_idx ON post_likes (postID, reaction, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS comment_likes_commentid_reaction_created_at_idx ON comment_likes (commentID, reaction, created_at DESC, id DESC);
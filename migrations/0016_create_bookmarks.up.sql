@@ -0,0 +1,25 @@
+-- collections group a user's bookmarks, deleting one keeps its bookmarks
+CREATE TABLE IF NOT EXISTS bookmark_collections (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	created_at timestamptz NOT NULL,
+	UNIQUE (userID, name),
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	postID BIGINT NOT NULL,
+	collectionID BIGINT,
+	created_at timestamptz NOT NULL,
+	UNIQUE (userID, postID),
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (postID) REFERENCES posts (id) ON DELETE CASCADE,
+	FOREIGN KEY (collectionID) REFERENCES bookmark_collections (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS bookmarks_userid_created_at_idx ON bookmarks (userID, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS bookmarks_collectionid_created_at_idx ON bookmarks (collectionID, created_at DESC, id DESC) WHERE collectionID IS NOT NULL;
+CREATE INDEX IF NOT EXISTS bookmark_collections_userid_created_at_idx ON bookmark_collections (userID, created_at DESC, id DESC);
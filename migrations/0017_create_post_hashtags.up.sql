@@ -0,0 +1,18 @@
+-- post_hashtags indexes the normalised hashtags of each post, created_at
+-- being the post's so tag pages list posts newest first
+CREATE TABLE IF NOT EXISTS post_hashtags (
+	postID BIGINT NOT NULL,
+	tag VARCHAR(100) NOT NULL,
+	created_at timestamptz NOT NULL,
+	PRIMARY KEY (postID, tag),
+	FOREIGN KEY (postID) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS post_hashtags_tag_created_at_idx ON post_hashtags (tag, created_at DESC, postID DESC);
+
+-- index the hashtags of existing posts, following extractHashtags
+INSERT INTO post_hashtags (postID, tag, created_at)
+SELECT DISTINCT posts.id, lower(match[1]), posts.created_at
+	FROM posts, regexp_matches(posts.content, '(?<![[:alnum:]_&#])#([[:alnum:]_]+)', 'g') AS match
+	WHERE match[1] ~ '[[:alpha:]]' AND char_length(match[1]) <= 100
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,21 @@
+-- mentions links each @username of a post or comment to the user mentioned,
+-- commentID being set for mentions in comments. position and length locate
+-- the @username in the content, in characters.
+CREATE TABLE IF NOT EXISTS mentions (
+	id SERIAL PRIMARY KEY,
+	userID BIGINT NOT NULL,
+	authorID BIGINT NOT NULL,
+	postID BIGINT NOT NULL,
+	commentID BIGINT,
+	position INTEGER NOT NULL,
+	length INTEGER NOT NULL,
+	created_at timestamptz NOT NULL,
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (authorID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (postID) REFERENCES posts (id) ON DELETE CASCADE,
+	FOREIGN KEY (commentID) REFERENCES comments (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS mentions_userid_created_at_idx ON mentions (userID, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS mentions_postid_idx ON mentions (postID) WHERE commentID IS NULL;
+CREATE INDEX IF NOT EXISTS mentions_commentid_idx ON mentions (commentID) WHERE commentID IS NOT NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_search_idx;
+DROP INDEX IF EXISTS comments_search_idx;
+DROP INDEX IF EXISTS posts_search_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS search;
+ALTER TABLE comments DROP COLUMN IF EXISTS search;
+ALTER TABLE posts DROP COLUMN IF EXISTS search;
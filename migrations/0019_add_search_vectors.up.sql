@@ -0,0 +1,16 @@
+-- search vectors for full-text search. Posts and comments are searched in
+-- english, with stemming, while users are matched on their exact words.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search tsvector
+	GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS search tsvector
+	GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', userName), 'A') ||
+		setweight(to_tsvector('simple', COALESCE(name, '')), 'A') ||
+		setweight(to_tsvector('simple', COALESCE(bio, '')), 'B')
+	) STORED;
+
+CREATE INDEX IF NOT EXISTS posts_search_idx ON posts USING GIN (search);
+CREATE INDEX IF NOT EXISTS comments_search_idx ON comments USING GIN (search);
+CREATE INDEX IF NOT EXISTS users_search_idx ON users USING GIN (search);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_name_prefix_idx;
+DROP INDEX IF EXISTS users_username_prefix_idx;
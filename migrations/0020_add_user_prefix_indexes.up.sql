@@ -0,0 +1,4 @@
+-- prefix indexes for username autocomplete, text_pattern_ops lets LIKE 'ab%'
+-- use them whatever the database's collation
+CREATE INDEX IF NOT EXISTS users_username_prefix_idx ON users (lower(userName) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS users_name_prefix_idx ON users (lower(name) text_pattern_ops);
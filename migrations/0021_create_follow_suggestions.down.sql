@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS follows_followerid_userid_idx;
+DROP TABLE IF EXISTS follow_suggestions;
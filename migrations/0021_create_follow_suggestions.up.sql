@@ -0,0 +1,14 @@
+-- follow_suggestions holds the precomputed suggestions of users who follow
+-- many accounts, refreshed by a background job
+CREATE TABLE IF NOT EXISTS follow_suggestions (
+	userID BIGINT NOT NULL,
+	suggestedID BIGINT NOT NULL,
+	mutuals INTEGER NOT NULL,
+	computed_at timestamptz NOT NULL,
+	PRIMARY KEY (userID, suggestedID),
+	FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (suggestedID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS follow_suggestions_userid_mutuals_idx ON follow_suggestions (userID, mutuals DESC, suggestedID);
+CREATE INDEX IF NOT EXISTS follows_followerid_userid_idx ON follows (followerID, userID);
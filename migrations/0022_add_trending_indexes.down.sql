@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS post_hashtags_created_at_idx;
+DROP INDEX IF EXISTS posts_shares_created_at_idx;
+DROP INDEX IF EXISTS comments_created_at_idx;
+DROP INDEX IF EXISTS post_likes_created_at_idx;
@@ -0,0 +1,5 @@
+-- trending scans the interactions of the last window across all posts
+CREATE INDEX IF NOT EXISTS post_likes_created_at_idx ON post_likes (created_at);
+CREATE INDEX IF NOT EXISTS comments_created_at_idx ON comments (created_at);
+CREATE INDEX IF NOT EXISTS posts_shares_created_at_idx ON posts (created_at) WHERE repostOfID IS NOT NULL OR quoteOfID IS NOT NULL;
+CREATE INDEX IF NOT EXISTS post_hashtags_created_at_idx ON post_hashtags (created_at);
@@ -0,0 +1,2 @@
+-- hashed refresh tokens can't be recovered, everyone has to log in again
+DELETE FROM sessions;
@@ -0,0 +1,3 @@
+-- sessions store the SHA-256 of their refresh token, encoded as hex, rather
+-- than the token itself
+UPDATE sessions SET refreshToken = encode(sha256(convert_to(refreshToken, 'UTF8')), 'hex');
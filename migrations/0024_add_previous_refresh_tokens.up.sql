@@ -0,0 +1,4 @@
+-- sessions remember the hash of the refresh token they were last rotated
+-- from, so replaying it can be told apart from a token that never existed
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS previousRefreshToken VARCHAR(128) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS sessions_previous_refresh_token_idx ON sessions (previousRefreshToken) WHERE previousRefreshToken <> '';
@@ -0,0 +1,4 @@
+UPDATE post_likes SET reaction = '👍'
+WHERE reaction = current_setting('app.default_reaction') AND created_at < (SELECT applied_at FROM schema_migrations WHERE version = 15);
+UPDATE comment_likes SET reaction = '👍'
+WHERE reaction = current_setting('app.default_reaction') AND created_at < (SELECT applied_at FROM schema_migrations WHERE version = 15);
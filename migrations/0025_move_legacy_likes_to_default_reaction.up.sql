@@ -0,0 +1,7 @@
+-- likes made before reactions existed get the configured default reaction
+-- rather than 👍. Reacting again resets a like's created_at, so the likes
+-- older than migration 0015 are the ones it made 👍.
+UPDATE post_likes SET reaction = current_setting('app.default_reaction')
+WHERE reaction = '👍' AND created_at < (SELECT applied_at FROM schema_migrations WHERE version = 15);
+UPDATE comment_likes SET reaction = current_setting('app.default_reaction')
+WHERE reaction = '👍' AND created_at < (SELECT applied_at FROM schema_migrations WHERE version = 15);
@@ -0,0 +1,7 @@
+ALTER TABLE follows DROP CONSTRAINT follows_userid_followerid_key;
+UPDATE follows SET userID = followerID, followerID = userID
+	WHERE created_at < (SELECT applied_at FROM schema_migrations WHERE version = 1);
+DELETE FROM follows a
+	USING follows b
+	WHERE a.userID = b.userID AND a.followerID = b.followerID AND a.id > b.id;
+ALTER TABLE follows ADD CONSTRAINT follows_userid_followerid_key UNIQUE (userID, followerID);
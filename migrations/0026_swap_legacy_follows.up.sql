@@ -0,0 +1,23 @@
+-- follows made before migrations existed have the follower in userID and
+-- the followed account in followerID, the other way around from how they're
+-- read
+CREATE TEMPORARY TABLE legacy_follows ON COMMIT DROP AS
+	SELECT id, userID, followerID FROM follows
+	WHERE created_at < (SELECT applied_at FROM schema_migrations WHERE version = 1);
+
+-- a swapped follow can collide with the same follow made since, or with the
+-- mutual follow not swapped yet, keep the oldest once they're all swapped
+ALTER TABLE follows DROP CONSTRAINT follows_userid_followerid_key;
+UPDATE follows SET userID = followerID, followerID = userID
+	WHERE id IN (SELECT id FROM legacy_follows);
+DELETE FROM follows a
+	USING follows b
+	WHERE a.userID = b.userID AND a.followerID = b.followerID AND a.id > b.id;
+ALTER TABLE follows ADD CONSTRAINT follows_userid_followerid_key UNIQUE (userID, followerID);
+
+-- the posts of users on either side were fanned out along the swapped
+-- follows, they're merged into feeds on read instead
+UPDATE posts SET fannedOut = FALSE
+	WHERE userID IN (SELECT userID FROM legacy_follows UNION SELECT followerID FROM legacy_follows);
+DELETE FROM timelines
+	WHERE authorID IN (SELECT userID FROM legacy_follows UNION SELECT followerID FROM legacy_follows);
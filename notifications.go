@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Notification types, the event a notification was generated from
+const (
+	NotificationLikePost       = "like_post"
+	NotificationLikeComment    = "like_comment"
+	NotificationReactPost      = "react_post"
+	NotificationReactComment   = "react_comment"
+	NotificationComment        = "comment"
+	NotificationFollow         = "follow"
+	NotificationFollowRequest  = "follow_request"
+	NotificationFollowAccepted = "follow_accepted"
+	NotificationMention        = "mention"
+	NotificationRepost         = "repost"
+	NotificationQuote          = "quote"
+	NotificationReply          = "reply"
+)
+
+// maxGroupActors is how many actor names a notification group lists, the
+// rest only show up in its actor count
+const maxGroupActors = 3
+
+// groupNotifications aggregates notifications, sorted newest first, about the
+// same thing into a single entry such as "alice and 12 others liked your
+// post". Groups are ordered by their newest notification. Mentions are never
+// aggregated since each one refers to a different post.
+func groupNotifications(notifications []*Notification) []*NotificationGroup {
+	groups := []*NotificationGroup{}
+	byKey := map[string]*NotificationGroup{}
+	seenActors := map[*NotificationGroup]map[int64]bool{}
+
+	for _, notification := range notifications {
+		key := groupKey(notification)
+		group, ok := byKey[key]
+		if !ok {
+			group = &NotificationGroup{
+				Type:            notification.Type,
+				PostID:          notification.PostID,
+				CommentID:       notification.CommentID,
+				Actors:          []string{},
+				NotificationIDs: []int64{},
+				IsRead:          true,
+				LatestAt:        notification.Created_at,
+			}
+			byKey[key] = group
+			seenActors[group] = map[int64]bool{}
+			groups = append(groups, group)
+		}
+
+		group.NotificationIDs = append(group.NotificationIDs, notification.ID)
+		group.IsRead = group.IsRead && notification.IsRead
+		if !seenActors[group][notification.ActorID] {
+			seenActors[group][notification.ActorID] = true
+			group.ActorCount++
+			if len(group.Actors) < maxGroupActors {
+				group.Actors = append(group.Actors, notification.ActorName)
+			}
+		}
+	}
+
+	for _, group := range groups {
+		group.Message = notificationMessage(group)
+	}
+	return groups
+}
+
+// groupCursor points at the newest notification of a group, groups being
+// ordered by it
+func groupCursor(group *NotificationGroup) Cursor {
+	return Cursor{CreatedAt: group.LatestAt, ID: group.NotificationIDs[0]}
+}
+
+// newGroupPage builds a page of groups from the notifications, sorted newest
+// first, of up to page.Limit+1 groups
+func newGroupPage(notifications []*Notification, page *PageRequest) *Page[*NotificationGroup] {
+	return newPage(groupNotifications(notifications), page, groupCursor)
+}
+
+// pageNotificationGroups returns the notifications, sorted newest first, of
+// the up to page.Limit+1 groups whose newest notification comes after the
+// page's cursor, keeping every notification of those groups
+func pageNotificationGroups(notifications []*Notification, page *PageRequest) []*Notification {
+	inPage := map[string]bool{}
+	groups := 0
+	for _, notification := range notifications {
+		key := groupKey(notification)
+		if _, seen := inPage[key]; seen {
+			continue
+		}
+		// the first notification of a group is its newest
+		inPage[key] = groups <= page.Limit && page.After.after(notification.Created_at, notification.ID)
+		if inPage[key] {
+			groups++
+		}
+	}
+
+	paged := []*Notification{}
+	for _, notification := range notifications {
+		if inPage[groupKey(notification)] {
+			paged = append(paged, notification)
+		}
+	}
+	return paged
+}
+
+// groupKey identifies the group of a notification, notificationGroupKey
+// computing the same key in SQL
+func groupKey(notification *Notification) string {
+	if notification.Type == NotificationMention {
+		return notification.Type + ":" + strconv.FormatInt(notification.ID, 10)
+	}
+	return fmt.Sprintf("%s:%d:%d", notification.Type, idOrZero(notification.PostID), idOrZero(notification.CommentID))
+}
+
+func notificationMessage(group *NotificationGroup) string {
+	var actors string
+	switch group.ActorCount {
+	case 1:
+		actors = group.Actors[0]
+	case 2:
+		actors = group.Actors[0] + " and " + group.Actors[1]
+	default:
+		actors = fmt.Sprintf("%s and %d others", group.Actors[0], group.ActorCount-1)
+	}
+
+	switch group.Type {
+	case NotificationLikePost:
+		return actors + " liked your post"
+	case NotificationLikeComment:
+		return actors + " liked your comment"
+	case NotificationReactPost:
+		return actors + " reacted to your post"
+	case NotificationReactComment:
+		return actors + " reacted to your comment"
+	case NotificationComment:
+		return actors + " commented on your post"
+	case NotificationReply:
+		return actors + " replied to your comment"
+	case NotificationFollow:
+		return actors + " started following you"
+	case NotificationFollowRequest:
+		return actors + " requested to follow you"
+	case NotificationFollowAccepted:
+		return actors + " accepted your follow request"
+	case NotificationMention:
+		return actors + " mentioned you"
+	case NotificationRepost:
+		return actors + " reposted your post"
+	case NotificationQuote:
+		return actors + " quoted your post"
+	}
+	return actors
+}
+
+func idOrZero(id *int64) int64 {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGroupNotifications(t *testing.T) {
+	postID, otherPostID := int64(1), int64(2)
+	now := time.Now().UTC()
+
+	notifications := []*Notification{}
+	for i := 0; i < 13; i++ {
+		notifications = append(notifications, &Notification{
+			ID:         int64(100 - i),
+			ActorID:    int64(i + 10),
+			ActorName:  fmt.Sprintf("user%d", i),
+			Type:       NotificationLikePost,
+			PostID:     &postID,
+			IsRead:     i > 0,
+			Created_at: now.Add(-time.Duration(i) * time.Minute),
+		})
+	}
+	notifications = append(notifications,
+		&Notification{ID: 50, ActorID: 10, ActorName: "user0", Type: NotificationLikePost, PostID: &otherPostID, Created_at: now.Add(-time.Hour)},
+		&Notification{ID: 49, ActorID: 10, ActorName: "user0", Type: NotificationMention, PostID: &otherPostID, Created_at: now.Add(-2 * time.Hour)},
+		&Notification{ID: 48, ActorID: 11, ActorName: "user1", Type: NotificationMention, PostID: &otherPostID, Created_at: now.Add(-3 * time.Hour)},
+	)
+
+	groups := groupNotifications(notifications)
+	if len(groups) != 4 {
+		t.Fatalf("Expected 4 groups, got %d", len(groups))
+	}
+
+	likes := groups[0]
+	if likes.Message != "user0 and 12 others liked your post" {
+		t.Errorf("Unexpected message: %s", likes.Message)
+	}
+	if likes.ActorCount != 13 || len(likes.Actors) != maxGroupActors || len(likes.NotificationIDs) != 13 {
+		t.Errorf("Unexpected group: %+v", likes)
+	}
+	if likes.IsRead {
+		t.Error("Expected a group with an unread notification to be unread")
+	}
+	if !likes.LatestAt.Equal(now) {
+		t.Errorf("Expected the group to be dated by its newest notification, got %v", likes.LatestAt)
+	}
+
+	if groups[1].Message != "user0 liked your post" {
+		t.Errorf("Expected likes on another post to be grouped separately, got %s", groups[1].Message)
+	}
+	if groups[2].Message != "user0 mentioned you" || groups[3].Message != "user1 mentioned you" {
+		t.Errorf("Expected mentions not to be aggregated, got %s and %s", groups[2].Message, groups[3].Message)
+	}
+}
+
+func TestNotificationMessage(t *testing.T) {
+	tests := []struct {
+		group    *NotificationGroup
+		expected string
+	}{
+		{&NotificationGroup{Type: NotificationFollow, Actors: []string{"alice"}, ActorCount: 1}, "alice started following you"},
+		{&NotificationGroup{Type: NotificationComment, Actors: []string{"alice", "bob"}, ActorCount: 2}, "alice and bob commented on your post"},
+		{&NotificationGroup{Type: NotificationLikeComment, Actors: []string{"alice", "bob", "carol"}, ActorCount: 3}, "alice and 2 others liked your comment"},
+	}
+
+	for _, test := range tests {
+		if message := notificationMessage(test.group); message != test.expected {
+			t.Errorf("Message mismatch. Expected: %s, Got: %s", test.expected, message)
+		}
+	}
+}
+
+func TestPageNotificationGroups(t *testing.T) {
+	postID, otherPostID := int64(1), int64(2)
+	now := time.Now().UTC()
+	// newest first: a like on post 1, a like on post 2, then an older like on
+	// post 1 that belongs to the first group
+	notifications := []*Notification{
+		{ID: 3, ActorID: 10, ActorName: "alice", Type: NotificationLikePost, PostID: &postID, Created_at: now},
+		{ID: 2, ActorID: 11, ActorName: "bob", Type: NotificationLikePost, PostID: &otherPostID, Created_at: now.Add(-time.Minute)},
+		{ID: 1, ActorID: 12, ActorName: "carol", Type: NotificationLikePost, PostID: &postID, Created_at: now.Add(-time.Hour)},
+	}
+
+	page := &PageRequest{Limit: 1}
+	first := newGroupPage(pageNotificationGroups(notifications, page), page)
+	if len(first.Items) != 1 || first.Items[0].ActorCount != 2 || first.NextCursor == "" {
+		t.Fatalf("Expected the whole group of post 1 on the first page, got %+v", first)
+	}
+
+	page.After, _ = decodeCursor(first.NextCursor)
+	second := newGroupPage(pageNotificationGroups(notifications, page), page)
+	if len(second.Items) != 1 || *second.Items[0].PostID != otherPostID || second.NextCursor != "" {
+		t.Fatalf("Expected only the group of post 2 on the last page, got %+v", second)
+	}
+}
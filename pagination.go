@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Cursor points at the last item of a page, lists are ordered by
+// (created_at, id) so the pair is unique and stable across inserts
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+type PageRequest struct {
+	After *Cursor
+	Limit int
+}
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor"`
+}
+
+// newPage builds a page from up to page.Limit+1 items, the extra item only
+// being used to tell whether there is a next page
+func newPage[T any](items []T, page *PageRequest, cursorOf func(T) Cursor) *Page[T] {
+	res := &Page[T]{Items: items}
+	if len(items) > page.Limit {
+		res.Items = items[:page.Limit]
+		res.NextCursor = encodeCursor(cursorOf(res.Items[page.Limit-1]))
+	}
+	return res
+}
+
+// nameRow is an entry of a list of usernames, such as followers or likes,
+// with the created_at and id of the row it was listed from
+type nameRow struct {
+	Name   string
+	Cursor Cursor
+}
+
+// newNamePage builds a page of usernames from up to page.Limit+1 rows
+func newNamePage(rows []*nameRow, page *PageRequest) *Page[string] {
+	rowPage := newPage(rows, page, func(row *nameRow) Cursor { return row.Cursor })
+
+	names := []string{}
+	for _, row := range rowPage.Items {
+		names = append(names, row.Name)
+	}
+	return &Page[string]{Items: names, NextCursor: rowPage.NextCursor}
+}
+
+// after reports whether an item sorted newest first comes after the cursor,
+// every item does when there is no cursor
+func (c *Cursor) after(createdAt time.Time, id int64) bool {
+	if c == nil {
+		return true
+	}
+	return newerThan(*c, Cursor{CreatedAt: createdAt, ID: id})
+}
+
+func newerThan(a, b Cursor) bool {
+	if a.CreatedAt.Equal(b.CreatedAt) {
+		return a.ID > b.ID
+	}
+	return a.CreatedAt.After(b.CreatedAt)
+}
+
+func sortNewestFirst[T any](items []T, cursorOf func(T) Cursor) {
+	sort.Slice(items, func(i, j int) bool {
+		return newerThan(cursorOf(items[i]), cursorOf(items[j]))
+	})
+}
+
+func encodeCursor(c Cursor) string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+
+	nanosStr, idStr, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(nanosStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+
+	return &Cursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+// getPageRequest reads the ?cursor= and ?limit= query params, limits above
+// maxPageSize are capped rather than rejected
+func getPageRequest(r *http.Request) (*PageRequest, error) {
+	limit, err := getPageLimit(r)
+	if err != nil {
+		return nil, err
+	}
+	page := &PageRequest{Limit: limit}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		page.After = after
+	}
+
+	return page, nil
+}
+
+// getPageLimit reads the ?limit= query param, defaulting to defaultPageSize
+// and capped to maxPageSize
+func getPageLimit(r *http.Request) (int, error) {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return defaultPageSize, nil
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("Invalid limit: %v", limitStr)
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return limit, nil
+}
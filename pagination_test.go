@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Now().UTC(), ID: 42}
+
+	decoded, err := decodeCursor(encodeCursor(cursor))
+	if err != nil {
+		t.Fatalf("decodeCursor returned an error: %v", err)
+	}
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("Cursor mismatch. Expected: %+v, Got: %+v", cursor, decoded)
+	}
+
+	if _, err := decodeCursor("not a cursor"); err == nil {
+		t.Error("Expected an invalid cursor to be rejected")
+	}
+}
+
+func TestGetPageRequest(t *testing.T) {
+	page, err := getPageRequest(httptest.NewRequest("GET", "/feed", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Limit != defaultPageSize || page.After != nil {
+		t.Errorf("Expected the default first page, got %+v", page)
+	}
+
+	page, err = getPageRequest(httptest.NewRequest("GET", "/feed?limit=100000", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Limit != maxPageSize {
+		t.Errorf("Expected limit to be capped at %d, got %d", maxPageSize, page.Limit)
+	}
+
+	if _, err := getPageRequest(httptest.NewRequest("GET", "/feed?limit=-1", nil)); err == nil {
+		t.Error("Expected a negative limit to be rejected")
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	now := time.Now()
+	items := []Cursor{{now, 3}, {now, 2}, {now, 1}}
+	identity := func(c Cursor) Cursor { return c }
+
+	page := newPage(items, &PageRequest{Limit: 2}, identity)
+	if len(page.Items) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected 2 items and a next cursor, got %+v", page)
+	}
+
+	next, _ := decodeCursor(page.NextCursor)
+	if next.ID != 2 {
+		t.Errorf("Expected the cursor to point at the last item, got %d", next.ID)
+	}
+
+	page = newPage(items, &PageRequest{Limit: 3}, identity)
+	if len(page.Items) != 3 || page.NextCursor != "" {
+		t.Errorf("Expected the last page to have no next cursor, got %+v", page)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// subscribe registers a live connection of userID with the hub, announcing
+// that they came online when it's their first one. The hub counts connections
+// as it registers them, so of concurrent connections only one is the first.
+func (s *ApiServer) subscribe(userID, lastEventID int64) (*Subscriber, []*Event, error) {
+	sub, missed, connections, err := s.Hub.Subscribe(userID, lastEventID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if connections == 1 {
+		s.publishPresence(userID, true, nil)
+	}
+	return sub, missed, nil
+}
+
+// unsubscribe ends a connection, recording when the user was last seen and
+// announcing that they went offline once their last connection is gone
+func (s *ApiServer) unsubscribe(sub *Subscriber) {
+	if s.Hub.Unsubscribe(sub) > 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	if err := s.Store.SetLastSeen(sub.UserID, now); err != nil {
+		log.Printf("failed to set last seen of user %d: %v", sub.UserID, err)
+	}
+	s.publishPresence(sub.UserID, false, &now)
+}
+
+// prepareConversations fills in who is online and hides read receipts from
+// viewerID where members asked for it. Hiding your own receipts also hides
+// everyone else's from you.
+func (s *ApiServer) prepareConversations(viewerID int64, conversations ...*Conversation) {
+	for _, conversation := range conversations {
+		hideAll := false
+		for _, member := range conversation.Members {
+			if member.UserID == viewerID && member.HideReadReceipts {
+				hideAll = true
+			}
+		}
+
+		for _, member := range conversation.Members {
+			member.Online = s.Hub.Connections(member.UserID) > 0
+			if member.UserID != viewerID && (hideAll || member.HideReadReceipts) {
+				member.LastReadMessageID = nil
+			}
+		}
+	}
+}
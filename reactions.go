@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Users react to posts and comments with one of a fixed set of emoji, at most
+// one reaction each. Likes are the first, default reaction: the /like routes
+// react with it and /likes lists who did.
+const defaultReactions = "👍,❤️,😂,😮,😢,😡"
+
+// Reactions counts the reactions to a post or comment by emoji
+type Reactions map[string]int
+
+// Scan reads the JSON object of reaction counts selected by postColumns and
+// commentColumns
+func (r *Reactions) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("unexpected reactions type %T", src)
+	}
+	return json.Unmarshal(b, r)
+}
+
+// loadReactions reads REACTIONS, the comma separated emoji users can react with
+func loadReactions() []string {
+	reactions := []string{}
+	for _, reaction := range strings.Split(os.Getenv("REACTIONS"), ",") {
+		if reaction = strings.TrimSpace(reaction); reaction != "" {
+			reactions = append(reactions, reaction)
+		}
+	}
+	if len(reactions) == 0 {
+		return strings.Split(defaultReactions, ",")
+	}
+	return reactions
+}
+
+func checkReaction(reactions []string, reaction string) error {
+	for _, r := range reactions {
+		if r == reaction {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown reaction %q", reaction)
+}
+
+// reactionNotification returns likeType for the default reaction and
+// reactType for the others
+func reactionNotification(reactions []string, reaction, likeType, reactType string) string {
+	if reaction == reactions[0] {
+		return likeType
+	}
+	return reactType
+}
@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+// errAlreadyReposted is returned by the store when a user reposts a post
+// twice. Quoting a post more than once is allowed.
+var errAlreadyReposted = fmt.Errorf("you already reposted this post")
+
+// sharedPost returns the post that req reposts or quotes, if any, and the
+// type of the notification its author gets
+func sharedPost(req *CreatePostRequest) (*int64, string) {
+	if req.RepostOfID != nil {
+		return req.RepostOfID, NotificationRepost
+	}
+	if req.QuoteOfID != nil {
+		return req.QuoteOfID, NotificationQuote
+	}
+	return nil, ""
+}
+
+// originalID returns the post that post reposts or quotes, if any
+func originalID(post *Post) *int64 {
+	if post.RepostOfID != nil {
+		return post.RepostOfID
+	}
+	return post.QuoteOfID
+}
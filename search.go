@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Search types, the kind of results GET /search returns
+const (
+	SearchPosts    = "posts"
+	SearchComments = "comments"
+	SearchUsers    = "users"
+)
+
+const (
+	maxSearchQueryLength = 200
+	// snippetWords is how many words of the matched text a snippet shows
+	snippetWords = 30
+	// searchHeadlineOptions tells ts_headline how to build snippets, matching
+	// the snippets of highlightWords
+	searchHeadlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", MaxWords=30, MinWords=10"
+	highlightStart        = "<mark>"
+	highlightStop         = "</mark>"
+
+	// headlineStart and headlineStop are the private use characters ts_headline
+	// wraps matches in, turned into <mark> tags by highlightHeadline once the
+	// rest is HTML-escaped. They're removed from the text beforehand, so it
+	// can't fake a match.
+	headlineStart = "\uE000"
+	headlineStop  = "\uE001"
+)
+
+var headlineReplacer = strings.NewReplacer(headlineStart, highlightStart, headlineStop, highlightStop)
+
+// highlightHeadline HTML-escapes a snippet built by ts_headline and wraps its
+// matches in <mark> tags
+func highlightHeadline(headline string) string {
+	return headlineReplacer.Replace(html.EscapeString(headline))
+}
+
+// SearchRequest is a search for posts, comments or users, Query being in the
+// web search syntax of websearch_to_tsquery: words are all required, "quoted
+// phrases" are matched as such and -words are excluded
+type SearchRequest struct {
+	Query string
+	Type  string
+	After *SearchCursor
+	Limit int
+}
+
+// SearchCursor points at the last result of a page of search results, which
+// are ordered by (rank, id) rather than by creation time
+type SearchCursor struct {
+	Rank float64
+	ID   int64
+}
+
+// SearchResult is a post, comment or user matching a search, with an
+// HTML-escaped snippet of the matched text where matches are wrapped in <mark>
+// tags
+type SearchResult struct {
+	Rank    float64      `json:"rank"`
+	Snippet string       `json:"snippet"`
+	Post    *Post        `json:"post,omitempty"`
+	Comment *Comment     `json:"comment,omitempty"`
+	User    *UserSummary `json:"user,omitempty"`
+}
+
+func (result *SearchResult) cursor() SearchCursor {
+	switch {
+	case result.Post != nil:
+		return SearchCursor{Rank: result.Rank, ID: result.Post.ID}
+	case result.Comment != nil:
+		return SearchCursor{Rank: result.Rank, ID: result.Comment.ID}
+	default:
+		return SearchCursor{Rank: result.Rank, ID: result.User.UserID}
+	}
+}
+
+// before reports whether a result comes after the cursor, results being
+// ordered by descending rank then id
+func (c *SearchCursor) before(other SearchCursor) bool {
+	if c == nil {
+		return true
+	}
+	if c.Rank == other.Rank {
+		return other.ID < c.ID
+	}
+	return other.Rank < c.Rank
+}
+
+// searchArgs returns the cursor's rank and id as query args, nil when there
+// is no cursor
+func searchArgs(req *SearchRequest) (any, any) {
+	if req.After == nil {
+		return nil, nil
+	}
+	return req.After.Rank, req.After.ID
+}
+
+// newSearchPage builds a page from up to req.Limit+1 results, like newPage
+func newSearchPage(results []*SearchResult, req *SearchRequest) *Page[*SearchResult] {
+	page := &Page[*SearchResult]{Items: results}
+	if len(results) > req.Limit {
+		page.Items = results[:req.Limit]
+		page.NextCursor = encodeSearchCursor(page.Items[req.Limit-1].cursor())
+	}
+	return page
+}
+
+func encodeSearchCursor(c SearchCursor) string {
+	raw := fmt.Sprintf("%s:%d", strconv.FormatFloat(c.Rank, 'g', -1, 64), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSearchCursor(s string) (*SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+
+	rankStr, idStr, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	rank, err := strconv.ParseFloat(rankStr, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+
+	return &SearchCursor{Rank: rank, ID: id}, nil
+}
+
+// getSearchRequest reads the ?q=, ?type=, ?cursor= and ?limit= query params,
+// searching posts by default
+func getSearchRequest(r *http.Request) (*SearchRequest, error) {
+	query := r.URL.Query()
+	req := &SearchRequest{Query: strings.TrimSpace(query.Get("q")), Type: query.Get("type")}
+	if req.Query == "" {
+		return nil, fmt.Errorf("Missing search query")
+	}
+	if len(req.Query) > maxSearchQueryLength {
+		return nil, fmt.Errorf("Search query is too long, the maximum is %d characters", maxSearchQueryLength)
+	}
+
+	switch req.Type {
+	case "":
+		req.Type = SearchPosts
+	case SearchPosts, SearchComments, SearchUsers:
+	default:
+		return nil, fmt.Errorf("Invalid search type: %v", req.Type)
+	}
+
+	limit, err := getPageLimit(r)
+	if err != nil {
+		return nil, err
+	}
+	req.Limit = limit
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeSearchCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		req.After = after
+	}
+
+	return req, nil
+}
+
+// The MemoryStore can't use PostgreSQL's full-text search, so it matches
+// words itself: without stemming, ranking by how often the query's words
+// appear in the text.
+
+// searchWord is a lowercased word of a text and its byte offsets in it
+type searchWord struct {
+	Text       string
+	Start, End int
+}
+
+func searchWords(text string) []searchWord {
+	words := []searchWord{}
+	start := -1
+	for i, r := range text + " " {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && start < 0 {
+			start = i
+		}
+		if !isWordRune && start >= 0 {
+			words = append(words, searchWord{Text: strings.ToLower(text[start:i]), Start: start, End: i})
+			start = -1
+		}
+	}
+	return words
+}
+
+// searchTerms are the words a text must contain and the words it mustn't to
+// match a query
+type searchTerms struct {
+	Include map[string]bool
+	Exclude map[string]bool
+}
+
+func parseSearchQuery(query string) *searchTerms {
+	terms := &searchTerms{Include: map[string]bool{}, Exclude: map[string]bool{}}
+	for _, field := range strings.Fields(query) {
+		words := terms.Include
+		if strings.HasPrefix(field, "-") {
+			words = terms.Exclude
+		}
+		for _, word := range searchWords(field) {
+			words[word.Text] = true
+		}
+	}
+	return terms
+}
+
+// match reports whether text matches the terms, with its rank and snippet
+func (terms *searchTerms) match(text string) (float64, string, bool) {
+	words := searchWords(text)
+	found := map[string]bool{}
+	hits := []int{}
+	for i, word := range words {
+		if terms.Exclude[word.Text] {
+			return 0, "", false
+		}
+		if terms.Include[word.Text] {
+			found[word.Text] = true
+			hits = append(hits, i)
+		}
+	}
+	if len(terms.Include) == 0 || len(found) < len(terms.Include) {
+		return 0, "", false
+	}
+	return float64(len(hits)) / float64(len(words)), highlightWords(text, words, hits), true
+}
+
+// highlightWords returns up to snippetWords words of text around its first
+// hit, HTML-escaped, wrapping the words at the indexes of hits in <mark> tags
+func highlightWords(text string, words []searchWord, hits []int) string {
+	first := hits[0] - snippetWords/3
+	if first < 0 {
+		first = 0
+	}
+	last := first + snippetWords - 1
+	if last >= len(words) {
+		last = len(words) - 1
+	}
+
+	highlighted := map[int]bool{}
+	for _, i := range hits {
+		highlighted[i] = true
+	}
+
+	var snippet strings.Builder
+	offset := words[first].Start
+	for i := first; i <= last; i++ {
+		if !highlighted[i] {
+			continue
+		}
+		snippet.WriteString(html.EscapeString(text[offset:words[i].Start]))
+		snippet.WriteString(highlightStart + html.EscapeString(text[words[i].Start:words[i].End]) + highlightStop)
+		offset = words[i].End
+	}
+	snippet.WriteString(html.EscapeString(text[offset:words[last].End]))
+	return snippet.String()
+}
+
+// pageSearchResults sorts results by rank and returns the up to
+// req.Limit+1 after the request's cursor
+func pageSearchResults(results []*SearchResult, req *SearchRequest) *Page[*SearchResult] {
+	sort.Slice(results, func(i, j int) bool {
+		cursor := results[i].cursor()
+		return cursor.before(results[j].cursor())
+	})
+
+	rows := []*SearchResult{}
+	for _, result := range results {
+		if len(rows) > req.Limit {
+			break
+		}
+		if req.After.before(result.cursor()) {
+			rows = append(rows, result)
+		}
+	}
+	return newSearchPage(rows, req)
+}
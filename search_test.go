@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestSearchTermsMatch(t *testing.T) {
+	tests := []struct {
+		query, text string
+		want        string
+		ok          bool
+	}{
+		{"pasta", "Fresh Pasta recipe, more pasta!", "Fresh <mark>Pasta</mark> recipe, more <mark>pasta</mark>", true},
+		{"pasta sauce", "pasta recipe", "", false},
+		{"pasta -pizza", "pasta or pizza", "", false},
+		{"-pizza", "pasta", "", false},
+		{"café", "le Café du coin", "le <mark>Café</mark> du coin", true},
+		{"pasta", "x <img src=y onerror=alert(1)> pasta", "x &lt;img src=y onerror=alert(1)&gt; <mark>pasta</mark>", true},
+	}
+
+	for _, test := range tests {
+		_, snippet, ok := parseSearchQuery(test.query).match(test.text)
+		if ok != test.ok || snippet != test.want {
+			t.Errorf("match(%q, %q) = %q, %v, want %q, %v", test.query, test.text, snippet, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestHighlightHeadline(t *testing.T) {
+	headline := "<b onclick=x>" + headlineStart + "pasta" + headlineStop + " & sauce"
+	want := "&lt;b onclick=x&gt;<mark>pasta</mark> &amp; sauce"
+	if got := highlightHeadline(headline); got != want {
+		t.Errorf("highlightHeadline(%q) = %q, want %q", headline, got, want)
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	cursor := SearchCursor{Rank: 0.0607927106320858, ID: 42}
+	decoded, err := decodeSearchCursor(encodeSearchCursor(cursor))
+	if err != nil || *decoded != cursor {
+		t.Errorf("Expected the cursor to round trip, got %+v, %v", decoded, err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseHeartbeatPeriod is how often an idle stream gets a comment line, which
+// keeps proxies from timing it out and notices revoked sessions
+const sseHeartbeatPeriod = 15 * time.Second
+
+// handleEvents streams the authenticated user's events as Server-Sent Events.
+// Clients reconnecting with a Last-Event-ID header first receive the events
+// they missed that are still in the hub's replay buffer.
+func (s *ApiServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteJson(w, http.StatusInternalServerError, ApiError{Error: "streaming unsupported"})
+		return
+	}
+
+	lastEventID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	sub, missed, err := s.subscribe(getAuthUserID(r), lastEventID)
+	if err != nil {
+		WriteJson(w, http.StatusTooManyRequests, ApiError{Error: err.Error()})
+		return
+	}
+	defer s.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range missed {
+		if err := writeSSE(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseHeartbeatPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-sub.Events:
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-ticker.C:
+			if !s.sessionActive(getAuthSessionID(r)) {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-sub.Done():
+			return
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event *Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openEventStream connects to /events and returns a reader of its events,
+// the stream is closed when the test ends
+func openEventStream(t *testing.T, server *httptest.Server, token, lastEventID string) *bufio.Reader {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+	req.Header.Set("x-jwt-token", token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	expectStatus(t, res, http.StatusOK)
+
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", contentType)
+	}
+	return bufio.NewReader(res.Body)
+}
+
+type sseMessage struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+func readSSE(t *testing.T, stream *bufio.Reader) *sseMessage {
+	t.Helper()
+
+	done := make(chan *sseMessage)
+	go func() {
+		msg := new(sseMessage)
+		for {
+			line, err := stream.ReadString('\n')
+			if err != nil {
+				close(done)
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "" && msg.Event != "":
+				done <- msg
+				return
+			case strings.HasPrefix(line, "id: "):
+				msg.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				msg.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+
+	select {
+	case msg, ok := <-done:
+		if !ok {
+			t.Fatal("event stream ended")
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func TestEventStream(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	_, bobAuth := signUp(t, server, "bob")
+
+	res := doRequest(t, server, http.MethodGet, "/events", "", nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	post, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "hello"})
+	postPath := fmt.Sprintf("/posts/%d", post.ID)
+
+	stream := openEventStream(t, server, aliceAuth.Token, "")
+	res = doRequest(t, server, http.MethodPost, postPath+"/like", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	liked := readSSE(t, stream)
+	if liked.Event != EventPostLiked || !strings.Contains(liked.Data, fmt.Sprintf(`"postID":%d`, post.ID)) {
+		t.Errorf("Expected a like of post %d, got %+v", post.ID, liked)
+	}
+	if notification := readSSE(t, stream); notification.Event != EventNotification {
+		t.Errorf("Expected %s, got %s", EventNotification, notification.Event)
+	}
+
+	// events published while disconnected are replayed after Last-Event-ID
+	res = doRequest(t, server, http.MethodPost, postPath+"/comments", bobAuth.Token, CreateCommentRequest{Text: "nice"})
+	expectStatus(t, res, http.StatusCreated)
+
+	resumed := openEventStream(t, server, aliceAuth.Token, liked.ID)
+	for _, eventType := range []string{EventNotification, EventCommentCreated, EventNotification} {
+		if msg := readSSE(t, resumed); msg.Event != eventType {
+			t.Errorf("Expected %s to be replayed, got %s", eventType, msg.Event)
+		}
+	}
+}
@@ -1,44 +1,114 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
 	"os"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type Storage interface {
 	GetUserByName(username string) (*User, error)
 	GetUserByID(id int64) (*User, error)
-	GetUserProfile(username string) (*UserProfile, error)
+	GetUserProfile(username string, viewerID int64) (*UserProfile, error)
 	CreateUser(user *User) error
 	DeleteUser(username string) error
 	UpdateUser(username string, user *UpdateUserRequest) error
-	GetUserPosts(username string) ([]*Post, error)
+	GetUserPosts(username string, page *PageRequest) (*Page[*Post], error)
 	GetPost(id int64) (*Post, error)
-	CreatePost(req *CreatePostRequest) error
+	CreatePost(req *CreatePostRequest) (*Post, error)
 	DeletePost(id int64) error
 	UpdatePost(id int64, req *CreatePostRequest) error
-	GetCommentsFromPost(postID int64) ([]*Comment, error)
-	GetPostLikes(postID int64) ([]string, error)
+	DeleteRepost(userID, postID int64) error
+	GetTagPosts(tag string, viewerID int64, page *PageRequest) (*Page[*Post], error)
+	GetFeed(userID int64, page *PageRequest) (*Page[*Post], error)
+	GetCommentsFromPost(postID int64, view string, viewerID int64, page *PageRequest) (*Page[*Comment], error)
+	GetCommentReplies(commentID, viewerID int64, page *PageRequest) (*Page[*Comment], error)
+	GetPostLikes(postID, viewerID int64, page *PageRequest) (*Page[string], error)
 	GetComment(id int64) (*Comment, error)
-	CreateComment(postID int64, req *CreateCommentRequest) error
+	CreateComment(postID int64, req *CreateCommentRequest) (*Comment, error)
 	DeleteComment(id int64) error
 	UpdateComment(id int64, req *CreateCommentRequest) error
-	GetFollowers(username string) ([]string, error)
-	GetFollowing(username string) ([]string, error)
+	GetMentions(userID int64, page *PageRequest) (*Page[*UserMention], error)
+	SearchPosts(req *SearchRequest, viewerID int64) (*Page[*SearchResult], error)
+	SearchComments(req *SearchRequest, viewerID int64) (*Page[*SearchResult], error)
+	SearchUsers(req *SearchRequest, viewerID int64) (*Page[*SearchResult], error)
+	AutocompleteUsers(prefix string, viewerID int64, limit int) ([]*UserSummary, error)
+	GetSuggestions(userID int64, limit int) ([]*Suggestion, error)
+	RefreshSuggestions() error
+	ScoreTrendingPosts(now time.Time, window time.Duration, limit int) ([]*PostScore, error)
+	ScoreTrendingTags(now time.Time, window time.Duration, limit int) ([]*TrendingTag, error)
+	GetPostsByIDs(ids []int64, viewerID int64) ([]*Post, error)
+	GetFollowers(username string, page *PageRequest) (*Page[string], error)
+	GetFollowing(username string, page *PageRequest) (*Page[string], error)
+	GetFollowerIDs(userID int64) ([]int64, error)
+	IsFollowing(followerID, userID int64) (bool, error)
 	CreateFollow(req *FollowRequest) error
 	DeleteFollow(req *FollowRequest) error
+	CreateFollowRequest(req *FollowRequest) error
+	GetFollowRequests(userID int64, page *PageRequest) (*Page[string], error)
+	ApproveFollowRequest(userID, requesterID int64) error
+	DeleteFollowRequest(userID, requesterID int64) error
 	LikePost(userID, postID int64) error
 	UnlikePost(userID, postID int64) error
 	LikeComment(userID, postID int64) error
 	UnlikeComment(userID, postID int64) error
+	ReactToPost(userID, postID int64, reaction string) error
+	ReactToComment(userID, commentID int64, reaction string) error
+	GetPostReactions(postID int64, reaction string, viewerID int64, page *PageRequest) (*Page[string], error)
+	GetCommentReactions(commentID int64, reaction string, viewerID int64, page *PageRequest) (*Page[string], error)
+	BookmarkPost(userID, postID int64, collectionID *int64) error
+	DeleteBookmark(userID, postID int64) error
+	GetBookmarks(userID int64, collectionID *int64, page *PageRequest) (*Page[*Bookmark], error)
+	CreateCollection(userID int64, name string) (*Collection, error)
+	GetCollections(userID int64, page *PageRequest) (*Page[*Collection], error)
+	RenameCollection(userID, id int64, name string) error
+	DeleteCollection(userID, id int64) error
+	CreateSession(session *Session) error
+	GetSession(id string) (*Session, error)
+	GetSessionByRefreshToken(refreshToken string) (*Session, error)
+	GetUserSessions(userID int64) ([]*Session, error)
+	RotateSession(id, oldRefreshToken, refreshToken string, expiresAt time.Time) (bool, error)
+	DeleteSession(id string) error
+	GetNotifications(userID int64, page *PageRequest) (*Page[*NotificationGroup], error)
+	CountUnreadNotifications(userID int64) (int, error)
+	MarkNotificationsRead(userID int64, ids []int64) error
+	GetOrCreateDirectConversation(userID, otherID int64) (*Conversation, error)
+	GetConversation(id int64) (*Conversation, error)
+	GetUserConversations(userID int64, page *PageRequest) (*Page[*Conversation], error)
+	IsConversationMember(conversationID, userID int64) (bool, error)
+	GetMessages(conversationID int64, page *PageRequest) (*Page[*Message], error)
+	CreateMessage(conversationID int64, req *CreateMessageRequest) (*Message, error)
+	CreateGroupConversation(creatorID int64, title string, memberIDs []int64, notice *CreateMessageRequest) (*Conversation, error)
+	GetConversationMember(conversationID, userID int64) (*ConversationMember, error)
+	AddConversationMembers(conversationID int64, userIDs []int64, notice *CreateMessageRequest) (*Message, error)
+	RemoveConversationMember(conversationID, userID int64, notice *CreateMessageRequest) (*Message, error)
+	UpdateConversationTitle(id int64, title string, notice *CreateMessageRequest) (*Message, error)
+	SetConversationMemberRole(conversationID, userID int64, role string) error
+	MarkConversationRead(conversationID, userID, messageID int64) (int64, error)
+	GetConversationPartnerIDs(userID int64) ([]int64, error)
+	SetLastSeen(userID int64, at time.Time) error
+	BlockUser(userID, blockedID int64) error
+	UnblockUser(userID, blockedID int64) error
+	IsBlocked(userID, otherID int64) (bool, error)
+	MuteUser(userID, mutedID int64) error
+	UnmuteUser(userID, mutedID int64) error
+	IsMuted(userID, mutedID int64) (bool, error)
+	GetMutedByIDs(userID int64) ([]int64, error)
 }
 
 type PostgresStore struct {
-	db *sql.DB
+	db          *sql.DB
+	fanoutLimit int
+	maxDepth    int
+	reactions   []string
+	// suggestionsThreshold is the number of followed accounts above which
+	// suggestions are read from follow_suggestions
+	suggestionsThreshold int
 }
 
 func NewPostgresStore() (*PostgresStore, error) {
@@ -53,74 +123,26 @@ func NewPostgresStore() (*PostgresStore, error) {
 		return nil, err
 	}
 
-	return &PostgresStore{db: db}, nil
+	return &PostgresStore{
+		db:                   db,
+		fanoutLimit:          timelineFanoutLimit(),
+		maxDepth:             maxCommentDepth(),
+		reactions:            loadReactions(),
+		suggestionsThreshold: suggestionsPrecomputeThreshold(),
+	}, nil
 }
 
+// Init brings the database schema up to date by applying pending migrations
 func (s *PostgresStore) Init() error {
-	return s.CreateTables()
-}
-
-// CREATE DATABASE TABLES
-func (s *PostgresStore) CreateTables() error {
-	query := `CREATE TABLE IF NOT EXISTS users (
-		id SERIAL PRIMARY KEY,
-		userName VARCHAR(25) NOT NULL UNIQUE,
-		name VARCHAR(225),
-		email VARCHAR(255) NOT NULL,
-		bio VARCHAR(255),
-		passwordHash VARCHAR(1000) NOT NULL,
-		created_at timestamptz NOT NULL
-	);
-	
-	CREATE TABLE IF NOT EXISTS posts (
-		id SERIAL PRIMARY KEY,
-		userID BIGINT NOT NULL,
-		content VARCHAR(255) NOT NULL,
-		mediaUrl VARCHAR(10000),
-		created_at timestamptz NOT NULL,
-		FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
-	);
-	
-	CREATE TABLE IF NOT EXISTS comments (
-		id SERIAL PRIMARY KEY,
-		userID BIGINT NOT NULL,
-		postID BIGINT NOT NULL,
-		content VARCHAR(255) NOT NULL,
-		created_at timestamptz NOT NULL,
-		FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
-		FOREIGN KEY (postID) REFERENCES posts (id) ON DELETE CASCADE
-	);
-	
-	CREATE TABLE IF NOT EXISTS follows (
-		id SERIAL PRIMARY KEY,
-		userID BIGINT NOT NULL,
-		followerID BIGINT NOT NULL,
-		created_at timestamptz NOT NULL,
-		FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
-		FOREIGN KEY (followerID) REFERENCES users (id) ON DELETE CASCADE
-	);
-	
-	CREATE TABLE IF NOT EXISTS post_likes (
-		id SERIAL PRIMARY KEY,
-		userID BIGINT NOT NULL,
-		postID BIGINT NOT NULL,
-		created_at timestamptz NOT NULL,
-		UNIQUE (userID, postID),
-		FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
-		FOREIGN KEY (postID) REFERENCES posts (id) ON DELETE CASCADE
-	);
-	
-	CREATE TABLE IF NOT EXISTS comment_likes (
-		id SERIAL PRIMARY KEY,
-		userID BIGINT NOT NULL,
-		commentID BIGINT NOT NULL,
-		created_at timestamptz NOT NULL,
-		UNIQUE (userID, commentID),
-		FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE,
-		FOREIGN KEY (commentID) REFERENCES comments (id) ON DELETE CASCADE
-	);`
-
-	_, err := s.db.Exec(query)
+	migrator, err := NewMigrator(s.db)
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		log.Printf("applied migration %d_%s", migration.Version, migration.Name)
+	}
 	return err
 }
 
@@ -132,7 +154,7 @@ func (s *PostgresStore) GetUserByName(name string) (*User, error) {
 		return nil, fmt.Errorf("user %s not found", name)
 	}
 
-	rows, err := s.db.Query(`SELECT * FROM users WHERE id = $1`, user_id)
+	rows, err := s.db.Query(`SELECT `+userColumns+` FROM users WHERE id = $1`, user_id)
 	if err != nil {
 		return nil, err
 	}
@@ -146,7 +168,7 @@ func (s *PostgresStore) GetUserByName(name string) (*User, error) {
 }
 
 func (s *PostgresStore) GetUserByID(id int64) (*User, error) {
-	rows, err := s.db.Query(`SELECT * FROM users WHERE id = $1`, id)
+	rows, err := s.db.Query(`SELECT `+userColumns+` FROM users WHERE id = $1`, id)
 	if err != nil {
 		return nil, err
 	}
@@ -159,14 +181,21 @@ func (s *PostgresStore) GetUserByID(id int64) (*User, error) {
 	return nil, nil
 }
 
-func (s *PostgresStore) GetUserProfile(username string) (*UserProfile, error) {
+// GetUserProfile returns the profile of username as seen by viewerID, users
+// who blocked each other can't see each other's profiles. A viewerID of 0 is
+// an anonymous viewer.
+func (s *PostgresStore) GetUserProfile(username string, viewerID int64) (*UserProfile, error) {
 	user_id, err := s.getUserIDFromUserName(username)
 	if err != nil || user_id == 0 {
 		return nil, fmt.Errorf("user %s not found", username)
 	}
 
+	if blocked, err := s.IsBlocked(viewerID, user_id); err != nil || blocked {
+		return nil, fmt.Errorf("user %s not found", username)
+	}
+
 	// get user info
-	user_info, err := s.db.Query(`SELECT id, userName, name, bio FROM users WHERE id = $1`, user_id)
+	user_info, err := s.db.Query(`SELECT id, userName, name, bio, isPrivate FROM users WHERE id = $1`, user_id)
 	if err != nil {
 		return nil, err
 	}
@@ -179,6 +208,7 @@ func (s *PostgresStore) GetUserProfile(username string) (*UserProfile, error) {
 			&profile.UserName,
 			&profile.Name,
 			&profile.Bio,
+			&profile.IsPrivate,
 		); err != nil {
 			return nil, err
 		}
@@ -208,11 +238,15 @@ func (s *PostgresStore) GetUserProfile(username string) (*UserProfile, error) {
 }
 
 func (s *PostgresStore) CreateUser(user *User) error {
-	_, err := s.db.Exec(`INSERT INTO users (userName, name, email, bio, passwordHash, created_at)
-	 VALUES ($1, $2, $3, $4, $5, $6)`,
-		user.UserName, user.Name, user.Email, user.Bio, user.PasswordHash, user.Created_at)
+	if user.AllowMessagesFrom == "" {
+		user.AllowMessagesFrom = MessagesFromEveryone
+	}
 
-	return err
+	return s.db.QueryRow(`INSERT INTO users (userName, name, email, bio, passwordHash, created_at,
+	 allowMessagesFrom, hideReadReceipts, isPrivate)
+	 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		user.UserName, user.Name, user.Email, user.Bio, user.PasswordHash, user.Created_at,
+		user.AllowMessagesFrom, user.HideReadReceipts, user.IsPrivate).Scan(&user.ID)
 }
 
 func (s *PostgresStore) DeleteUser(username string) error {
@@ -271,17 +305,47 @@ func (s *PostgresStore) UpdateUser(username string, user *UpdateUserRequest) err
 		}
 	}
 
+	if user.AllowMessagesFrom != "" {
+		_, err := s.db.Exec(`UPDATE users SET allowMessagesFrom = $1 WHERE id = $2`,
+			user.AllowMessagesFrom, user_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if user.HideReadReceipts != nil {
+		_, err := s.db.Exec(`UPDATE users SET hideReadReceipts = $1 WHERE id = $2`,
+			*user.HideReadReceipts, user_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if user.IsPrivate != nil {
+		_, err := s.db.Exec(`UPDATE users SET isPrivate = $1 WHERE id = $2`,
+			*user.IsPrivate, user_id)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // CRUD OPERATIONS FOR POSTS
-func (s *PostgresStore) GetUserPosts(username string) ([]*Post, error) {
+func (s *PostgresStore) GetUserPosts(username string, page *PageRequest) (*Page[*Post], error) {
 	user_id, err := s.getUserIDFromUserName(username)
 	if err != nil {
 		return nil, fmt.Errorf("user %s not found", username)
 	}
 
-	rows, err := s.db.Query(`SELECT * FROM posts WHERE userID = $1`, user_id)
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT `+postColumns+` FROM posts
+		WHERE userID = $1
+		AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4`, user_id, afterTime, afterID, page.Limit+1)
 	if err != nil {
 		return nil, err
 	}
@@ -295,269 +359,2502 @@ func (s *PostgresStore) GetUserPosts(username string) ([]*Post, error) {
 		}
 		posts = append(posts, post)
 	}
-	return posts, nil
+	if err := s.attachOriginals(posts); err != nil {
+		return nil, err
+	}
+	return newPage(posts, page, postCursor), nil
 }
 
 func (s *PostgresStore) GetPost(id int64) (*Post, error) {
-	rows, err := s.db.Query(`SELECT * FROM posts WHERE id = $1`, id)
+	rows, err := s.db.Query(`SELECT `+postColumns+` FROM posts WHERE id = $1`, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	for rows.Next() {
-		return ScanIntoPost(rows)
+	if !rows.Next() {
+		return nil, nil
 	}
-
-	return nil, nil
+	post, err := ScanIntoPost(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachOriginals([]*Post{post}); err != nil {
+		return nil, err
+	}
+	return post, nil
 }
 
-func (s *PostgresStore) CreatePost(req *CreatePostRequest) error {
-	_, err := s.db.Exec(`INSERT INTO posts (userID, mediaUrl, content, created_at) 
-	VALUES ($1, $2, $3, $4)`,
+func (s *PostgresStore) CreatePost(req *CreatePostRequest) (*Post, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var followers int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM follows WHERE userID = $1`, req.UserID).Scan(&followers); err != nil {
+		return nil, err
+	}
+	fannedOut := followers <= s.fanoutLimit
+
+	if err := checkShareable(tx, req); err != nil {
+		return nil, err
+	}
+
+	var id int64
+	createdAt := time.Now().UTC()
+	err = tx.QueryRow(`INSERT INTO posts (userID, mediaUrl, content, created_at, fannedOut, repostOfID, quoteOfID) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
 		req.UserID,
 		req.MediaUrl,
-		req.Content, time.Now().UTC())
+		req.Content, createdAt, fannedOut, req.RepostOfID, req.QuoteOfID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	if err := indexHashtags(tx, id, req.Content, createdAt); err != nil {
+		return nil, err
+	}
+	if _, err := indexMentions(tx, req.UserID, id, nil, req.Content, createdAt); err != nil {
+		return nil, err
+	}
+
+	// push the post into the author's and their followers' timelines
+	if fannedOut {
+		_, err := tx.Exec(`INSERT INTO timelines (userID, postID, authorID, created_at)
+		SELECT followerID, $1, $2, $3 FROM follows WHERE userID = $2
+		UNION SELECT $2, $1, $2, $3`, id, req.UserID, createdAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// notify the shared post's author, unless they shared their own post
+	if originalID, notificationType := sharedPost(req); originalID != nil {
+		_, err := tx.Exec(`INSERT INTO notifications (userID, actorID, type, postID, created_at)
+		SELECT userID, $1, $2, id, $3 FROM posts WHERE id = $4 AND userID <> $1`,
+			req.UserID, notificationType, createdAt, *originalID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetPost(id)
 }
 
+// DeletePost deletes a post along with its reposts. Quotes of it are kept,
+// without their original.
 func (s *PostgresStore) DeletePost(id int64) error {
 	_, err := s.db.Exec(`DELETE FROM posts WHERE id = $1`, id)
 	return err
 }
 
+func (s *PostgresStore) DeleteRepost(userID, postID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM posts WHERE userID = $1 AND repostOfID = $2`, userID, postID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM notifications WHERE actorID = $1 AND type = $2 AND postID = $3`,
+		userID, NotificationRepost, postID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (s *PostgresStore) UpdatePost(id int64, req *CreatePostRequest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	if req.Content != "" {
-		_, err := s.db.Exec(`UPDATE posts SET content = $1 WHERE id = $2`, req.Content, id)
+		var authorID int64
+		var createdAt time.Time
+		err := tx.QueryRow(`UPDATE posts SET content = $1 WHERE id = $2 RETURNING userID, created_at`,
+			req.Content, id).Scan(&authorID, &createdAt)
+		if err == sql.ErrNoRows {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
+
+		// re-index the hashtags of the edited content
+		if _, err := tx.Exec(`DELETE FROM post_hashtags WHERE postID = $1`, id); err != nil {
+			return err
+		}
+		if err := indexHashtags(tx, id, req.Content, createdAt); err != nil {
+			return err
+		}
+		if _, err := indexMentions(tx, authorID, id, nil, req.Content, time.Now().UTC()); err != nil {
+			return err
+		}
 	}
 
 	if req.MediaUrl != "" {
-		_, err := s.db.Exec(`UPDATE posts SET mediaUrl = $1 WHERE id = $2`, req.MediaUrl, id)
+		_, err := tx.Exec(`UPDATE posts SET mediaUrl = $1 WHERE id = $2`, req.MediaUrl, id)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (s *PostgresStore) GetPostLikes(id int64) ([]string, error) {
+// GetTagPosts returns the posts tagged with tag that viewerID can see, newest
+// first
+func (s *PostgresStore) GetTagPosts(tag string, viewerID int64, page *PageRequest) (*Page[*Post], error) {
+	afterTime, afterID := pageArgs(page)
 	rows, err := s.db.Query(`
-	SELECT users.userName
-		FROM post_likes
-		INNER JOIN users ON post_likes.userID = users.id
-		WHERE post_likes.postID = $1`, id)
+	SELECT `+postColumns+` FROM post_hashtags
+		INNER JOIN posts ON post_hashtags.postID = posts.id
+		WHERE post_hashtags.tag = $5
+		AND ($2::timestamptz IS NULL OR (post_hashtags.created_at, post_hashtags.postID) < ($2, $3))
+		`+blockedAuthorsFilter+`
+		`+privateAuthorsFilter+`
+		ORDER BY post_hashtags.created_at DESC, post_hashtags.postID DESC
+		LIMIT $4`, viewerID, afterTime, afterID, page.Limit+1, tag)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	likedBy := []string{}
+	posts := []*Post{}
 	for rows.Next() {
-		var name string
-		err := rows.Scan(&name)
+		post, err := ScanIntoPost(rows)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to scan post row: %v", err)
 		}
-		likedBy = append(likedBy, name)
+		posts = append(posts, post)
 	}
-
-	return likedBy, nil
+	if err := s.attachOriginals(posts); err != nil {
+		return nil, err
+	}
+	return newPage(posts, page, postCursor), nil
 }
 
-// CRUD OPERATIONS FOR COMMENTS
-func (s *PostgresStore) GetCommentsFromPost(postID int64) ([]*Comment, error) {
-	rows, err := s.db.Query(`SELECT * FROM comments WHERE postID = $1`, postID)
+// blockedAuthorsFilter leaves out posts whose author blocked or was blocked
+// by the user $1
+const blockedAuthorsFilter = `AND NOT EXISTS (SELECT 1 FROM blocks
+			WHERE (blocks.userID = $1 AND blocks.blockedID = posts.userID)
+			OR (blocks.userID = posts.userID AND blocks.blockedID = $1))`
+
+// hiddenAuthorsFilter also leaves out posts whose author was muted by the
+// user $1. Mutes only hide content from the feed and notifications, other
+// reads use blockedAuthorsFilter.
+const hiddenAuthorsFilter = blockedAuthorsFilter + `
+		AND NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.userID = $1 AND mutes.mutedID = posts.userID)`
+
+// privateAuthorsFilter leaves out posts of private accounts, unless the user
+// $1 is their author or follows them
+const privateAuthorsFilter = `AND (posts.userID = $1
+			OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = posts.userID AND users.isPrivate)
+			OR EXISTS (SELECT 1 FROM follows WHERE follows.userID = posts.userID AND follows.followerID = $1))`
+
+// hiddenOriginalsFilter leaves out reposts and quotes of posts whose author
+// blocked or was blocked by the user $1
+const hiddenOriginalsFilter = `AND NOT EXISTS (SELECT 1 FROM posts AS originals
+			INNER JOIN blocks ON (blocks.userID = $1 AND blocks.blockedID = originals.userID)
+				OR (blocks.userID = originals.userID AND blocks.blockedID = $1)
+			WHERE originals.id = COALESCE(posts.repostOfID, posts.quoteOfID))`
+
+// GetFeed returns the posts of userID and everyone they follow, newest first.
+// Posts are read from the user's materialized timeline, merged with posts
+// that weren't fanned out on write. The two never overlap, so they're merged
+// with UNION ALL, which doesn't need to compare the json reactions column.
+func (s *PostgresStore) GetFeed(userID int64, page *PageRequest) (*Page[*Post], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT `+postColumns+` FROM timelines
+		INNER JOIN posts ON timelines.postID = posts.id
+		WHERE timelines.userID = $1
+		AND ($2::timestamptz IS NULL OR (timelines.created_at, timelines.postID) < ($2, $3))
+		`+hiddenAuthorsFilter+`
+		`+hiddenOriginalsFilter+`
+	UNION ALL
+	SELECT `+postColumns+` FROM posts
+		WHERE posts.fannedOut = FALSE
+		AND (posts.userID = $1 OR posts.userID IN (SELECT userID FROM follows WHERE followerID = $1))
+		AND ($2::timestamptz IS NULL OR (posts.created_at, posts.id) < ($2, $3))
+		`+hiddenAuthorsFilter+`
+		`+hiddenOriginalsFilter+`
+	ORDER BY created_at DESC, id DESC
+	LIMIT $4`, userID, afterTime, afterID, page.Limit+1)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	comments := []*Comment{}
+	posts := []*Post{}
 	for rows.Next() {
-		comment, err := ScanIntoComment(rows)
+		post, err := ScanIntoPost(rows)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to scan post row: %v", err)
 		}
-		comments = append(comments, comment)
+		posts = append(posts, post)
+	}
+	if err := s.attachOriginals(posts); err != nil {
+		return nil, err
 	}
 
-	return comments, nil
+	return newPage(posts, page, postCursor), nil
 }
 
-func (s *PostgresStore) GetComment(id int64) (*Comment, error) {
-	rows, err := s.db.Query(`SELECT * FROM comments WHERE id = $1`, id)
+// GetPostLikes lists who reacted to a post with the default reaction
+func (s *PostgresStore) GetPostLikes(id, viewerID int64, page *PageRequest) (*Page[string], error) {
+	return s.GetPostReactions(id, s.reactions[0], viewerID, page)
+}
+
+// blockedUsersFilter leaves out users who blocked or were blocked by the user
+// $1
+const blockedUsersFilter = `AND NOT EXISTS (SELECT 1 FROM blocks
+			WHERE (blocks.userID = $1 AND blocks.blockedID = users.id)
+			OR (blocks.userID = users.id AND blocks.blockedID = $1))`
+
+// blockedCommentersFilter leaves out comments by users who blocked or were
+// blocked by the user $1
+const blockedCommentersFilter = `AND NOT EXISTS (SELECT 1 FROM blocks
+			WHERE (blocks.userID = $1 AND blocks.blockedID = comments.userID)
+			OR (blocks.userID = comments.userID AND blocks.blockedID = $1))`
+
+// GetPostReactions lists who reacted to a post with reaction, or with any
+// reaction when it's empty, leaving out users blocked either way by viewerID
+func (s *PostgresStore) GetPostReactions(id int64, reaction string, viewerID int64, page *PageRequest) (*Page[string], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT users.userName, post_likes.created_at, post_likes.id
+		FROM post_likes
+		INNER JOIN users ON post_likes.userID = users.id
+		WHERE post_likes.postID = $6
+		AND ($5::text = '' OR post_likes.reaction = $5)
+		AND ($2::timestamptz IS NULL OR (post_likes.created_at, post_likes.id) < ($2, $3))
+		`+blockedUsersFilter+`
+		ORDER BY post_likes.created_at DESC, post_likes.id DESC
+		LIMIT $4`, viewerID, afterTime, afterID, page.Limit+1, reaction, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	for rows.Next() {
-		return ScanIntoComment(rows)
+	likedBy, err := ScanIntoNameRows(rows)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil, nil
+	return newNamePage(likedBy, page), nil
 }
 
-func (s *PostgresStore) CreateComment(postID int64, req *CreateCommentRequest) error {
-	_, err := s.db.Exec(`INSERT INTO comments (userID, postID, content, created_at) 
-	VALUES ($1, $2, $3, $4)`,
-		req.UserID,
-		postID, req.Text, time.Now().UTC())
+// CRUD OPERATIONS FOR COMMENTS
 
-	return err
-}
+// GetCommentsFromPost returns the top-level comments of a post, newest first,
+// with either a preview of their latest replies or their reply tree, bounded
+// as described in comments.go. Comments by users blocked either way by
+// viewerID are left out.
+func (s *PostgresStore) GetCommentsFromPost(postID int64, view string, viewerID int64, page *PageRequest) (*Page[*Comment], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT `+commentColumns+` FROM comments
+		WHERE postID = $5 AND parentCommentID IS NULL
+		AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+		`+blockedCommentersFilter+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4`, viewerID, afterTime, afterID, page.Limit+1, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-func (s *PostgresStore) DeleteComment(id int64) error {
-	_, err := s.db.Exec(`DELETE FROM comments WHERE id = $1`, id)
-	return err
-}
+	comments, err := ScanIntoComments(rows)
+	if err != nil {
+		return nil, err
+	}
+	res := newPage(comments, page, commentCursor)
 
-func (s *PostgresStore) UpdateComment(id int64, req *CreateCommentRequest) error {
-	_, err := s.db.Exec(`UPDATE comments SET content = $1 WHERE id = $2`,
-		req.Text, id)
+	ids := []int64{}
+	for _, comment := range res.Items {
+		ids = append(ids, comment.ID)
+	}
+	if len(ids) == 0 {
+		return res, nil
+	}
 
-	return err
+	var replyRows *sql.Rows
+	if view == CommentsViewThreaded {
+		// the thread is built level by level, so the limit keeps its shallowest
+		// replies and stops the recursion once it's reached
+		replyRows, err = s.db.Query(`
+		WITH RECURSIVE thread AS (
+			SELECT replies.* FROM unnest($2::bigint[]) AS parents(id)
+				CROSS JOIN LATERAL (`+latestRepliesQuery("parents.id")+`) AS replies
+			UNION ALL
+			SELECT replies.* FROM thread
+				CROSS JOIN LATERAL (`+latestRepliesQuery("thread.id")+`) AS replies
+				WHERE thread.depth < $4
+		)
+		SELECT * FROM (SELECT * FROM thread LIMIT $5) AS thread
+		ORDER BY created_at DESC, id DESC`, viewerID, pq.Array(ids), threadRepliesSize, s.maxDepth, threadSize)
+	} else {
+		replyRows, err = s.db.Query(`
+		SELECT `+commentColumns+` FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY parentCommentID ORDER BY created_at DESC, id DESC) AS rank
+			FROM comments WHERE parentCommentID = ANY($2)
+			`+blockedCommentersFilter+`
+		) AS comments
+		WHERE rank <= $3
+		ORDER BY created_at DESC, id DESC`, viewerID, pq.Array(ids), replyPreviewSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer replyRows.Close()
+
+	replies, err := ScanIntoComments(replyRows)
+	if err != nil {
+		return nil, err
+	}
+	nestReplies(res.Items, replies)
+	return res, nil
 }
 
-// CRUD OPERATIONS FOR FOLLOWS
-func (s *PostgresStore) GetFollowers(username string) ([]string, error) {
-	id, err := s.getUserIDFromUserName(username)
+// latestRepliesQuery selects the $3 latest replies to the comment parent that
+// the user $1 can see
+func latestRepliesQuery(parent string) string {
+	return `SELECT ` + commentColumns + ` FROM comments
+		WHERE comments.parentCommentID = ` + parent + `
+		` + blockedCommentersFilter + `
+		ORDER BY comments.created_at DESC, comments.id DESC
+		LIMIT $3`
+}
+
+func (s *PostgresStore) GetCommentReplies(commentID, viewerID int64, page *PageRequest) (*Page[*Comment], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT `+commentColumns+` FROM comments
+		WHERE parentCommentID = $5
+		AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+		`+blockedCommentersFilter+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4`, viewerID, afterTime, afterID, page.Limit+1, commentID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user_id from username: %v", err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	rows, err := s.db.Query(`SELECT userName FROM follows WHERE userID = $1`, id)
+	replies, err := ScanIntoComments(rows)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get followers row")
+		return nil, err
+	}
+	return newPage(replies, page, commentCursor), nil
+}
+
+func (s *PostgresStore) GetComment(id int64) (*Comment, error) {
+	rows, err := s.db.Query(`SELECT `+commentColumns+` FROM comments WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 
-	followers := []string{}
 	for rows.Next() {
-		follower := ""
-		err := rows.Scan(&follower)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan user")
-		}
-		followers = append(followers, follower)
-	}
-	if followers == nil {
-		return nil, fmt.Errorf("User has no followers")
+		return ScanIntoComment(rows)
 	}
 
-	return followers, nil
+	return nil, nil
 }
 
-func (s *PostgresStore) GetFollowing(username string) ([]string, error) {
-	id, err := s.getUserIDFromUserName(username)
+func (s *PostgresStore) CreateComment(postID int64, req *CreateCommentRequest) (*Comment, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user_id from username: %v", err)
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	rows, err := s.db.Query(`SELECT userName FROM follows WHERE followerID = $1`, id)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get following row")
+	if err := checkNotBlockedByAuthor(tx, req.UserID, "post", postID); err != nil {
+		return nil, err
 	}
-	defer rows.Close()
 
-	following := []string{}
-	for rows.Next() {
-		follow := ""
-		err := rows.Scan(&follow)
+	var parentID *int64
+	var parentAuthorID int64
+	depth := 0
+	if req.ParentCommentID != nil {
+		parent := new(Comment)
+		err := tx.QueryRow(`SELECT id, userID, postID, parentCommentID, depth FROM comments WHERE id = $1`,
+			*req.ParentCommentID).Scan(&parent.ID, &parent.UserID, &parent.PostID, &parent.ParentCommentID, &parent.Depth)
+		if err == sql.ErrNoRows || (err == nil && parent.PostID != postID) {
+			return nil, fmt.Errorf("comment %d not found on post %d", *req.ParentCommentID, postID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := checkNotBlocked(tx, req.UserID, parent.UserID); err != nil {
+			return nil, err
+		}
+		parentID, depth = replyParent(parent, s.maxDepth)
+	}
+	if parentID != nil {
+		err := tx.QueryRow(`SELECT userID FROM comments WHERE id = $1`, *parentID).Scan(&parentAuthorID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan user")
+			return nil, err
 		}
+	}
 
-		following = append(following, follow)
+	var id int64
+	createdAt := time.Now().UTC()
+	err = tx.QueryRow(`INSERT INTO comments (userID, postID, content, created_at, parentCommentID, depth) 
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		req.UserID,
+		postID, req.Text, createdAt, parentID, depth).Scan(&id)
+	if err != nil {
+		return nil, err
 	}
 
-	return following, nil
-}
+	mentions, err := indexMentions(tx, req.UserID, postID, &id, req.Text, createdAt)
+	if err != nil {
+		return nil, err
+	}
 
-func (s *PostgresStore) CreateFollow(req *FollowRequest) error {
-	_, err := s.db.Exec(`INSERT INTO follows (userID, followerID, created_at) 
-	VALUES ($1, $2, $3)`,
-		req.UserID,
-		req.FollowingID, time.Now().UTC())
+	// notify the author of the comment replied to, and the post's author
+	// unless that's the same person
+	if parentID != nil && parentAuthorID != req.UserID {
+		_, err = tx.Exec(`INSERT INTO notifications (userID, actorID, type, postID, commentID, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+			parentAuthorID, req.UserID, NotificationReply, postID, id, createdAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO notifications (userID, actorID, type, postID, commentID, created_at)
+	SELECT userID, $1, $2, id, $3, $4 FROM posts WHERE id = $5 AND userID <> $1 AND userID <> $6`,
+		req.UserID, NotificationComment, id, createdAt, postID, parentAuthorID)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
-}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
-func (s *PostgresStore) DeleteFollow(req *FollowRequest) error {
-	_, err := s.db.Exec(`DELETE FROM follows WHERE userID = $1 AND followerID = $2`,
-		req.UserID,
-		req.FollowingID)
-	return err
+	return &Comment{
+		ID:              id,
+		Text:            req.Text,
+		UserID:          req.UserID,
+		PostID:          postID,
+		Created_at:      createdAt,
+		ParentCommentID: parentID,
+		Depth:           depth,
+		Mentions:        mentions,
+	}, nil
 }
 
-func (s *PostgresStore) LikePost(userID, postID int64) error {
-	_, err := s.db.Exec(`INSERT INTO post_likes (userID, postID, created_at)
-	 VALUES($1, $2, $3)`,
-		userID, postID, time.Now().UTC())
+func (s *PostgresStore) DeleteComment(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM comments WHERE id = $1`, id)
 	return err
 }
 
-func (s *PostgresStore) UnlikePost(userID, postID int64) error {
-	_, err := s.db.Exec(`DELETE FROM post_likes WHERE userID = $1 AND postID = $2`, userID, postID)
-	return err
-}
+func (s *PostgresStore) UpdateComment(id int64, req *CreateCommentRequest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-func (s *PostgresStore) LikeComment(userID, commentID int64) error {
-	_, err := s.db.Exec(`INSERT INTO comment_likes (userID, commentID, created_at) VALUES($1, $2, $3)`,
-		userID, commentID, time.Now().UTC())
-	return err
-}
+	var authorID, postID int64
+	err = tx.QueryRow(`UPDATE comments SET content = $1 WHERE id = $2 RETURNING userID, postID`,
+		req.Text, id).Scan(&authorID, &postID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-func (s *PostgresStore) UnlikeComment(userID, commentID int64) error {
-	_, err := s.db.Exec(`DELETE FROM comment_likes WHERE userID = $1 AND commentID = $2`, userID, commentID)
-	return err
+	if _, err := indexMentions(tx, authorID, postID, &id, req.Text, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// FUNCTIONS FOR CREATING STRUCTS FROM SQL ROWS
-func ScanIntoUser(rows *sql.Rows) (*User, error) {
-	user := new(User)
-	err := rows.Scan(
-		&user.ID,
-		&user.UserName,
-		&user.Name,
-		&user.Email,
-		&user.Bio,
-		&user.PasswordHash,
-		&user.Created_at,
-	)
+// CRUD OPERATIONS FOR MENTIONS
 
-	return user, err
+// GetMentions returns the posts and comments mentioning userID, newest first.
+// Content mentioning them several times is listed once. Mentions are
+// notifications, so like those they leave out users userID muted, but only
+// blocks hide the posts a comment mentioning them is on.
+func (s *PostgresStore) GetMentions(userID int64, page *PageRequest) (*Page[*UserMention], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT mentions.id, mentions.created_at, mentions.commentID, `+postColumns+` FROM mentions
+		INNER JOIN posts ON mentions.postID = posts.id
+		WHERE mentions.userID = $1
+		AND ($2::timestamptz IS NULL OR (mentions.created_at, mentions.id) < ($2, $3))
+		AND NOT EXISTS (SELECT 1 FROM mentions AS earlier
+			WHERE earlier.userID = mentions.userID AND earlier.postID = mentions.postID
+			AND earlier.commentID IS NOT DISTINCT FROM mentions.commentID
+			AND earlier.position < mentions.position)
+		`+hiddenMentionersFilter+`
+		`+blockedAuthorsFilter+`
+		`+privateAuthorsFilter+`
+		ORDER BY mentions.created_at DESC, mentions.id DESC
+		LIMIT $4`, userID, afterTime, afterID, page.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []*UserMention{}
+	posts := []*Post{}
+	commentIDs := []int64{}
+	for rows.Next() {
+		mention := &UserMention{Post: new(Post)}
+		var commentID *int64
+		fields := append([]any{&mention.ID, &mention.Created_at, &commentID}, postFields(mention.Post)...)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, fmt.Errorf("failed to scan mention row: %v", err)
+		}
+		if commentID != nil {
+			mention.Comment = &Comment{ID: *commentID}
+			commentIDs = append(commentIDs, *commentID)
+		}
+		mentions = append(mentions, mention)
+		posts = append(posts, mention.Post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachOriginals(posts); err != nil {
+		return nil, err
+	}
+	if len(commentIDs) > 0 {
+		commentRows, err := s.db.Query(`SELECT `+commentColumns+` FROM comments WHERE id = ANY($1)`, pq.Array(commentIDs))
+		if err != nil {
+			return nil, err
+		}
+		defer commentRows.Close()
+
+		comments, err := ScanIntoComments(commentRows)
+		if err != nil {
+			return nil, err
+		}
+		byID := map[int64]*Comment{}
+		for _, comment := range comments {
+			byID[comment.ID] = comment
+		}
+		for _, mention := range mentions {
+			if mention.Comment != nil {
+				mention.Comment = byID[mention.Comment.ID]
+			}
+		}
+	}
+	return newPage(mentions, page, userMentionCursor), nil
+}
+
+// CRUD OPERATIONS FOR SEARCH
+
+// SearchPosts returns the posts matching req.Query that viewerID can see, best
+// ranked first
+func (s *PostgresStore) SearchPosts(req *SearchRequest, viewerID int64) (*Page[*SearchResult], error) {
+	afterRank, afterID := searchArgs(req)
+	rows, err := s.db.Query(`
+	SELECT posts.rank, ts_headline('english', translate(posts.content, $7, ''), posts.query, $6), `+postColumns+` FROM (
+		SELECT posts.*, ts_rank(posts.search, query)::float8 AS rank, query
+			FROM posts, websearch_to_tsquery('english', $5) AS query
+			WHERE posts.search @@ query
+			`+blockedAuthorsFilter+`
+			`+hiddenOriginalsFilter+`
+			`+privateAuthorsFilter+`
+	) AS posts
+		WHERE ($2::float8 IS NULL OR (posts.rank, posts.id) < ($2, $3))
+		ORDER BY posts.rank DESC, posts.id DESC
+		LIMIT $4`, viewerID, afterRank, afterID, req.Limit+1, req.Query, searchHeadlineOptions, headlineStart+headlineStop)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	posts := []*Post{}
+	for rows.Next() {
+		result := &SearchResult{Post: new(Post)}
+		fields := append([]any{&result.Rank, &result.Snippet}, postFields(result.Post)...)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, fmt.Errorf("failed to scan post row: %v", err)
+		}
+		result.Snippet = highlightHeadline(result.Snippet)
+		results = append(results, result)
+		posts = append(posts, result.Post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.attachOriginals(posts); err != nil {
+		return nil, err
+	}
+	return newSearchPage(results, req), nil
+}
+
+// SearchComments returns the comments matching req.Query that viewerID can
+// see, best ranked first
+func (s *PostgresStore) SearchComments(req *SearchRequest, viewerID int64) (*Page[*SearchResult], error) {
+	afterRank, afterID := searchArgs(req)
+	rows, err := s.db.Query(`
+	SELECT comments.rank, ts_headline('english', translate(comments.content, $7, ''), comments.query, $6), `+commentColumns+` FROM (
+		SELECT comments.*, ts_rank(comments.search, query)::float8 AS rank, query
+			FROM comments INNER JOIN posts ON comments.postID = posts.id,
+			websearch_to_tsquery('english', $5) AS query
+			WHERE comments.search @@ query
+			`+blockedCommentersFilter+`
+			`+blockedAuthorsFilter+`
+			`+privateAuthorsFilter+`
+	) AS comments
+		WHERE ($2::float8 IS NULL OR (comments.rank, comments.id) < ($2, $3))
+		ORDER BY comments.rank DESC, comments.id DESC
+		LIMIT $4`, viewerID, afterRank, afterID, req.Limit+1, req.Query, searchHeadlineOptions, headlineStart+headlineStop)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	for rows.Next() {
+		result := &SearchResult{Comment: new(Comment)}
+		if err := rows.Scan(append([]any{&result.Rank, &result.Snippet}, commentFields(result.Comment)...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan comment row: %v", err)
+		}
+		result.Snippet = highlightHeadline(result.Snippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newSearchPage(results, req), nil
+}
+
+// SearchUsers returns the users whose username, name or bio match req.Query,
+// best ranked first. Users who blocked or were blocked by viewerID are left
+// out, private accounts aren't.
+func (s *PostgresStore) SearchUsers(req *SearchRequest, viewerID int64) (*Page[*SearchResult], error) {
+	afterRank, afterID := searchArgs(req)
+	rows, err := s.db.Query(`
+	SELECT users.rank, ts_headline('simple', translate(users.text, $7, ''), users.query, $6),
+		users.id, users.userName, COALESCE(users.name, ''), COALESCE(users.bio, ''), users.isPrivate FROM (
+		SELECT users.*, ts_rank(users.search, query)::float8 AS rank, query,
+			users.userName || ' ' || COALESCE(users.name, '') || ' ' || COALESCE(users.bio, '') AS text
+			FROM users, websearch_to_tsquery('simple', $5) AS query
+			WHERE users.search @@ query
+			AND NOT EXISTS (SELECT 1 FROM blocks
+				WHERE (blocks.userID = $1 AND blocks.blockedID = users.id)
+				OR (blocks.userID = users.id AND blocks.blockedID = $1))
+	) AS users
+		WHERE ($2::float8 IS NULL OR (users.rank, users.id) < ($2, $3))
+		ORDER BY users.rank DESC, users.id DESC
+		LIMIT $4`, viewerID, afterRank, afterID, req.Limit+1, req.Query, searchHeadlineOptions, headlineStart+headlineStop)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	for rows.Next() {
+		result := &SearchResult{User: new(UserSummary)}
+		err := rows.Scan(&result.Rank, &result.Snippet, &result.User.UserID, &result.User.UserName,
+			&result.User.Name, &result.User.Bio, &result.User.IsPrivate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %v", err)
+		}
+		result.Snippet = highlightHeadline(result.Snippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newSearchPage(results, req), nil
+}
+
+// AutocompleteUsers returns up to limit users whose lowercased username or
+// name starts with prefix, for viewerID to mention. Users they follow come
+// first, then usernames matching before names, shorter usernames first. The
+// lookup gives up after autocompleteTimeout.
+func (s *PostgresStore) AutocompleteUsers(prefix string, viewerID int64, limit int) ([]*UserSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), autocompleteTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT users.id, users.userName, COALESCE(users.name, ''), COALESCE(users.bio, ''), users.isPrivate FROM users
+		WHERE (lower(users.userName) LIKE $2 OR lower(users.name) LIKE $2)
+		AND users.id <> $1
+		AND NOT EXISTS (SELECT 1 FROM blocks
+			WHERE (blocks.userID = $1 AND blocks.blockedID = users.id)
+			OR (blocks.userID = users.id AND blocks.blockedID = $1))
+		ORDER BY EXISTS (SELECT 1 FROM follows WHERE follows.userID = users.id AND follows.followerID = $1) DESC,
+			lower(users.userName) LIKE $2 DESC, char_length(users.userName), users.userName
+		LIMIT $3`, viewerID, escapeLike(prefix)+"%", limit)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*UserSummary{}
+	for rows.Next() {
+		user := new(UserSummary)
+		if err := rows.Scan(&user.UserID, &user.UserName, &user.Name, &user.Bio, &user.IsPrivate); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %v", err)
+		}
+		users = append(users, user)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return users, rows.Err()
+}
+
+// hiddenMentionersFilter leaves out mentions by users who blocked, were
+// blocked or were muted by the user $1
+const hiddenMentionersFilter = `AND NOT EXISTS (SELECT 1 FROM blocks
+			WHERE (blocks.userID = $1 AND blocks.blockedID = mentions.authorID)
+			OR (blocks.userID = mentions.authorID AND blocks.blockedID = $1))
+		AND NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.userID = $1 AND mutes.mutedID = mentions.authorID)`
+
+// indexMentions stores the mentions of a post's content, or of a comment's
+// when commentID is set, in place of the ones it had. Users mentioned for the
+// first time are notified, and users no longer mentioned lose their
+// notification.
+func indexMentions(tx *sql.Tx, authorID, postID int64, commentID *int64, content string, createdAt time.Time) (Mentions, error) {
+	rows, err := tx.Query(`DELETE FROM mentions WHERE postID = $1 AND commentID IS NOT DISTINCT FROM $2
+	RETURNING userID`, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	previous := map[int64]bool{}
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		previous[userID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	matches := extractMentions(content)
+	userIDs := map[string]int64{}
+	if len(matches) > 0 {
+		rows, err := tx.Query(`SELECT id, userName FROM users WHERE userName = ANY($1)`, pq.Array(mentionedNames(matches)))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var userName string
+			if err := rows.Scan(&id, &userName); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			userIDs[userName] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	mentions := resolveMentions(matches, userIDs)
+	mentioned := map[int64]bool{}
+	for _, mention := range mentions {
+		_, err := tx.Exec(`INSERT INTO mentions (userID, authorID, postID, commentID, position, length, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			mention.UserID, authorID, postID, commentID, mention.Offset, mention.Length, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		if mention.UserID != authorID && !previous[mention.UserID] && !mentioned[mention.UserID] {
+			_, err := tx.Exec(`INSERT INTO notifications (userID, actorID, type, postID, commentID, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+				mention.UserID, authorID, NotificationMention, postID, commentID, createdAt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		mentioned[mention.UserID] = true
+	}
+
+	for userID := range previous {
+		if mentioned[userID] {
+			continue
+		}
+		_, err := tx.Exec(`DELETE FROM notifications WHERE userID = $1 AND actorID = $2 AND type = $3
+		AND postID = $4 AND commentID IS NOT DISTINCT FROM $5`,
+			userID, authorID, NotificationMention, postID, commentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mentions, nil
+}
+
+// CRUD OPERATIONS FOR FOLLOWS
+func (s *PostgresStore) GetFollowers(username string, page *PageRequest) (*Page[string], error) {
+	id, err := s.getUserIDFromUserName(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user_id from username: %v", err)
+	}
+
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT users.userName, follows.created_at, follows.id
+		FROM follows
+		INNER JOIN users ON follows.followerID = users.id
+		WHERE follows.userID = $1
+		AND ($2::timestamptz IS NULL OR (follows.created_at, follows.id) < ($2, $3))
+		ORDER BY follows.created_at DESC, follows.id DESC
+		LIMIT $4`, id, afterTime, afterID, page.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get followers row")
+	}
+	defer rows.Close()
+
+	followers, err := ScanIntoNameRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan user")
+	}
+	return newNamePage(followers, page), nil
+}
+
+func (s *PostgresStore) GetFollowing(username string, page *PageRequest) (*Page[string], error) {
+	id, err := s.getUserIDFromUserName(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user_id from username: %v", err)
+	}
+
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT users.userName, follows.created_at, follows.id
+		FROM follows
+		INNER JOIN users ON follows.userID = users.id
+		WHERE follows.followerID = $1
+		AND ($2::timestamptz IS NULL OR (follows.created_at, follows.id) < ($2, $3))
+		ORDER BY follows.created_at DESC, follows.id DESC
+		LIMIT $4`, id, afterTime, afterID, page.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get following row")
+	}
+	defer rows.Close()
+
+	following, err := ScanIntoNameRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan user")
+	}
+	return newNamePage(following, page), nil
+}
+
+// GetFollowerIDs returns the ids of everyone following userID
+func (s *PostgresStore) GetFollowerIDs(userID int64) ([]int64, error) {
+	rows, err := s.db.Query(`SELECT followerID FROM follows WHERE userID = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *PostgresStore) IsFollowing(followerID, userID int64) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM follows WHERE userID = $1 AND followerID = $2)`,
+		userID, followerID).Scan(&exists)
+	return exists, err
+}
+
+func (s *PostgresStore) CreateFollow(req *FollowRequest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotBlocked(tx, req.UserID, req.FollowingID); err != nil {
+		return err
+	}
+
+	if err := insertFollow(tx, req); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO notifications (userID, actorID, type, created_at)
+	VALUES ($1, $2, $3, $4)`, req.FollowingID, req.UserID, NotificationFollow, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeleteFollow(req *FollowRequest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM follows WHERE userID = $1 AND followerID = $2`,
+		req.FollowingID,
+		req.UserID)
+	if err != nil {
+		return err
+	}
+
+	// prune the unfollowed account's posts from the follower's timeline
+	_, err = tx.Exec(`DELETE FROM timelines WHERE userID = $1 AND authorID = $2`,
+		req.UserID, req.FollowingID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM notifications WHERE userID = $1 AND actorID = $2 AND type = $3`,
+		req.FollowingID, req.UserID, NotificationFollow)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateFollowRequest asks the private account req.FollowingID to let
+// req.UserID follow it
+func (s *PostgresStore) CreateFollowRequest(req *FollowRequest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotBlocked(tx, req.UserID, req.FollowingID); err != nil {
+		return err
+	}
+
+	createdAt := time.Now().UTC()
+	res, err := tx.Exec(`INSERT INTO follow_requests (userID, requesterID, created_at)
+	SELECT $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM follows WHERE userID = $1 AND followerID = $2)`,
+		req.FollowingID, req.UserID, createdAt)
+	if err != nil {
+		return err
+	}
+	if inserted, err := res.RowsAffected(); err != nil || inserted == 0 {
+		return fmt.Errorf("user %d already follows user %d", req.UserID, req.FollowingID)
+	}
+
+	_, err = tx.Exec(`INSERT INTO notifications (userID, actorID, type, created_at)
+	VALUES ($1, $2, $3, $4)`, req.FollowingID, req.UserID, NotificationFollowRequest, createdAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetFollowRequests returns the usernames of the accounts asking to follow
+// userID, newest first
+func (s *PostgresStore) GetFollowRequests(userID int64, page *PageRequest) (*Page[string], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT users.userName, follow_requests.created_at, follow_requests.id
+		FROM follow_requests
+		INNER JOIN users ON follow_requests.requesterID = users.id
+		WHERE follow_requests.userID = $1
+		AND ($2::timestamptz IS NULL OR (follow_requests.created_at, follow_requests.id) < ($2, $3))
+		ORDER BY follow_requests.created_at DESC, follow_requests.id DESC
+		LIMIT $4`, userID, afterTime, afterID, page.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get follow requests: %v", err)
+	}
+	defer rows.Close()
+
+	requesters, err := ScanIntoNameRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	return newNamePage(requesters, page), nil
+}
+
+// ApproveFollowRequest turns requesterID's pending request into a follow of
+// userID and lets the requester know
+func (s *PostgresStore) ApproveFollowRequest(userID, requesterID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteFollowRequest(tx, userID, requesterID); err != nil {
+		return err
+	}
+
+	if err := insertFollow(tx, &FollowRequest{UserID: requesterID, FollowingID: userID}); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO notifications (userID, actorID, type, created_at)
+	VALUES ($1, $2, $3, $4)`, requesterID, userID, NotificationFollowAccepted, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteFollowRequest denies or cancels requesterID's request to follow userID
+func (s *PostgresStore) DeleteFollowRequest(userID, requesterID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteFollowRequest(tx, userID, requesterID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) LikePost(userID, postID int64) error {
+	return s.ReactToPost(userID, postID, s.reactions[0])
+}
+
+// ReactToPost sets userID's reaction to a post, replacing any earlier one
+func (s *PostgresStore) ReactToPost(userID, postID int64, reaction string) error {
+	if err := checkReaction(s.reactions, reaction); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotBlockedByAuthor(tx, userID, "post", postID); err != nil {
+		return err
+	}
+
+	createdAt := time.Now().UTC()
+	res, err := tx.Exec(`INSERT INTO post_likes (userID, postID, reaction, created_at)
+	 VALUES($1, $2, $3, $4)
+	 ON CONFLICT (userID, postID) DO UPDATE SET reaction = EXCLUDED.reaction, created_at = EXCLUDED.created_at
+	 WHERE post_likes.reaction <> EXCLUDED.reaction`,
+		userID, postID, reaction, createdAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("user %d already reacted to post %d with %s", userID, postID, reaction)
+	}
+
+	// notify the post's author, unless they reacted to their own post,
+	// replacing the notification about an earlier reaction
+	_, err = tx.Exec(`DELETE FROM notifications WHERE actorID = $1 AND type IN ($2, $3) AND postID = $4`,
+		userID, NotificationLikePost, NotificationReactPost, postID)
+	if err != nil {
+		return err
+	}
+	notificationType := reactionNotification(s.reactions, reaction, NotificationLikePost, NotificationReactPost)
+	_, err = tx.Exec(`INSERT INTO notifications (userID, actorID, type, postID, created_at)
+	SELECT userID, $1, $2, id, $3 FROM posts WHERE id = $4 AND userID <> $1`,
+		userID, notificationType, createdAt, postID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnlikePost removes userID's reaction to a post, whichever it is
+func (s *PostgresStore) UnlikePost(userID, postID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM post_likes WHERE userID = $1 AND postID = $2`, userID, postID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM notifications WHERE actorID = $1 AND type IN ($2, $3) AND postID = $4`,
+		userID, NotificationLikePost, NotificationReactPost, postID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) LikeComment(userID, commentID int64) error {
+	return s.ReactToComment(userID, commentID, s.reactions[0])
+}
+
+// ReactToComment sets userID's reaction to a comment, replacing any earlier one
+func (s *PostgresStore) ReactToComment(userID, commentID int64, reaction string) error {
+	if err := checkReaction(s.reactions, reaction); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotBlockedByAuthor(tx, userID, "comment", commentID); err != nil {
+		return err
+	}
+
+	createdAt := time.Now().UTC()
+	res, err := tx.Exec(`INSERT INTO comment_likes (userID, commentID, reaction, created_at) VALUES($1, $2, $3, $4)
+	 ON CONFLICT (userID, commentID) DO UPDATE SET reaction = EXCLUDED.reaction, created_at = EXCLUDED.created_at
+	 WHERE comment_likes.reaction <> EXCLUDED.reaction`,
+		userID, commentID, reaction, createdAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("user %d already reacted to comment %d with %s", userID, commentID, reaction)
+	}
+
+	// notify the comment's author, unless they reacted to their own comment,
+	// replacing the notification about an earlier reaction
+	_, err = tx.Exec(`DELETE FROM notifications WHERE actorID = $1 AND type IN ($2, $3) AND commentID = $4`,
+		userID, NotificationLikeComment, NotificationReactComment, commentID)
+	if err != nil {
+		return err
+	}
+	notificationType := reactionNotification(s.reactions, reaction, NotificationLikeComment, NotificationReactComment)
+	_, err = tx.Exec(`INSERT INTO notifications (userID, actorID, type, postID, commentID, created_at)
+	SELECT userID, $1, $2, postID, id, $3 FROM comments WHERE id = $4 AND userID <> $1`,
+		userID, notificationType, createdAt, commentID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnlikeComment removes userID's reaction to a comment, whichever it is
+func (s *PostgresStore) UnlikeComment(userID, commentID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM comment_likes WHERE userID = $1 AND commentID = $2`, userID, commentID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM notifications WHERE actorID = $1 AND type IN ($2, $3) AND commentID = $4`,
+		userID, NotificationLikeComment, NotificationReactComment, commentID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetCommentReactions lists who reacted to a comment with reaction, or with
+// any reaction when it's empty, leaving out users blocked either way by
+// viewerID
+func (s *PostgresStore) GetCommentReactions(id int64, reaction string, viewerID int64, page *PageRequest) (*Page[string], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT users.userName, comment_likes.created_at, comment_likes.id
+		FROM comment_likes
+		INNER JOIN users ON comment_likes.userID = users.id
+		WHERE comment_likes.commentID = $6
+		AND ($5::text = '' OR comment_likes.reaction = $5)
+		AND ($2::timestamptz IS NULL OR (comment_likes.created_at, comment_likes.id) < ($2, $3))
+		`+blockedUsersFilter+`
+		ORDER BY comment_likes.created_at DESC, comment_likes.id DESC
+		LIMIT $4`, viewerID, afterTime, afterID, page.Limit+1, reaction, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactedBy, err := ScanIntoNameRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	return newNamePage(reactedBy, page), nil
+}
+
+// CRUD OPERATIONS FOR FOLLOW SUGGESTIONS
+
+// GetSuggestions returns up to limit accounts for userID to follow, the ones
+// the most of the accounts they follow follow first. Users following more
+// than s.suggestionsThreshold accounts get their precomputed suggestions, even
+// when there are none yet.
+func (s *PostgresStore) GetSuggestions(userID int64, limit int) ([]*Suggestion, error) {
+	var following int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM follows WHERE followerID = $1`, userID).Scan(&following)
+	if err != nil {
+		return nil, err
+	}
+
+	if following > s.suggestionsThreshold {
+		rows, err := s.db.Query(`
+		SELECT `+suggestionColumns+`, follow_suggestions.mutuals FROM follow_suggestions
+			INNER JOIN users ON follow_suggestions.suggestedID = users.id
+			WHERE follow_suggestions.userID = $1
+			`+suggestableFilter+`
+			ORDER BY follow_suggestions.mutuals DESC, users.id
+			LIMIT $2`, userID, limit)
+		if err != nil {
+			return nil, err
+		}
+		return scanIntoSuggestions(rows)
+	}
+
+	rows, err := s.db.Query(`
+	SELECT `+suggestionColumns+`, COUNT(*) AS mutuals FROM follows AS mine
+		INNER JOIN follows AS theirs ON theirs.followerID = mine.userID
+		INNER JOIN users ON theirs.userID = users.id
+		WHERE mine.followerID = $1
+		`+suggestableFilter+`
+		GROUP BY users.id
+		ORDER BY mutuals DESC, users.id
+		LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanIntoSuggestions(rows)
+}
+
+// RefreshSuggestions precomputes the suggestions of every user following more
+// than s.suggestionsThreshold accounts, and drops those of users who no longer
+// do. It does nothing while another server refreshes them, or when one did
+// less than half a refresh interval ago.
+func (s *PostgresStore) RefreshSuggestions() error {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, suggestionsLockID).Scan(&locked)
+	if err != nil {
+		return fmt.Errorf("failed to acquire suggestions lock: %v", err)
+	}
+	if !locked {
+		return nil
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, suggestionsLockID)
+
+	var computedAt sql.NullTime
+	if err := s.db.QueryRow(`SELECT MAX(computed_at) FROM follow_suggestions`).Scan(&computedAt); err != nil {
+		return err
+	}
+	if computedAt.Valid && time.Since(computedAt.Time) < suggestionsRefreshInterval/2 {
+		return nil
+	}
+	return s.refreshSuggestions()
+}
+
+func (s *PostgresStore) refreshSuggestions() error {
+	_, err := s.db.Exec(`DELETE FROM follow_suggestions
+	WHERE (SELECT COUNT(*) FROM follows WHERE follows.followerID = follow_suggestions.userID) <= $1`,
+		s.suggestionsThreshold)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(`SELECT followerID FROM follows GROUP BY followerID HAVING COUNT(*) > $1`,
+		s.suggestionsThreshold)
+	if err != nil {
+		return err
+	}
+	userIDs := []int64{}
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := s.refreshUserSuggestions(userID); err != nil {
+			return fmt.Errorf("failed to refresh suggestions of user %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) refreshUserSuggestions(userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM follow_suggestions WHERE userID = $1`, userID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO follow_suggestions (userID, suggestedID, mutuals, computed_at)
+	SELECT $1, users.id, COUNT(*), $2 FROM follows AS mine
+		INNER JOIN follows AS theirs ON theirs.followerID = mine.userID
+		INNER JOIN users ON theirs.userID = users.id
+		WHERE mine.followerID = $1
+		`+suggestableFilter+`
+		GROUP BY users.id
+		ORDER BY COUNT(*) DESC, users.id
+		LIMIT $3`, userID, time.Now().UTC(), precomputedSuggestions)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// suggestionColumns lists the users columns scanIntoSuggestions expects before
+// the mutuals count
+const suggestionColumns = `users.id, users.userName, COALESCE(users.name, ''), COALESCE(users.bio, ''), users.isPrivate`
+
+// suggestableFilter leaves out the user $1, private accounts and the accounts
+// $1 follows, blocked, was blocked by or muted
+const suggestableFilter = `AND users.id <> $1
+		AND NOT users.isPrivate
+		AND NOT EXISTS (SELECT 1 FROM follows WHERE follows.followerID = $1 AND follows.userID = users.id)
+		AND NOT EXISTS (SELECT 1 FROM blocks
+			WHERE (blocks.userID = $1 AND blocks.blockedID = users.id)
+			OR (blocks.userID = users.id AND blocks.blockedID = $1))
+		AND NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.userID = $1 AND mutes.mutedID = users.id)`
+
+func scanIntoSuggestions(rows *sql.Rows) ([]*Suggestion, error) {
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+	for rows.Next() {
+		suggestion := &Suggestion{User: new(UserSummary)}
+		err := rows.Scan(&suggestion.User.UserID, &suggestion.User.UserName, &suggestion.User.Name,
+			&suggestion.User.Bio, &suggestion.User.IsPrivate, &suggestion.Mutuals)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan suggestion row: %v", err)
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, rows.Err()
+}
+
+// CRUD OPERATIONS FOR TRENDING
+
+// ScoreTrendingPosts returns the up to limit highest scoring posts over the
+// window ending at now. Reposts aren't scored themselves, they score the post
+// they share.
+func (s *PostgresStore) ScoreTrendingPosts(now time.Time, window time.Duration, limit int) ([]*PostScore, error) {
+	rows, err := s.db.Query(`
+	SELECT posts.id, trending.score FROM (
+		SELECT postID, SUM(weight * exp(-ln(2) * extract(epoch FROM $1::timestamptz - created_at)::float8 / $7::float8)) AS score FROM (
+			SELECT postID, created_at, $3::float8 AS weight FROM post_likes WHERE created_at > $2
+			UNION ALL
+			SELECT postID, created_at, $4::float8 FROM comments WHERE created_at > $2
+			UNION ALL
+			SELECT COALESCE(repostOfID, quoteOfID), created_at, $5::float8 FROM posts
+				WHERE (repostOfID IS NOT NULL OR quoteOfID IS NOT NULL) AND created_at > $2
+		) AS interactions
+		GROUP BY postID
+	) AS trending
+		INNER JOIN posts ON trending.postID = posts.id
+		INNER JOIN users ON posts.userID = users.id
+		WHERE posts.repostOfID IS NULL AND NOT users.isPrivate
+		ORDER BY trending.score DESC, posts.id DESC
+		LIMIT $6`, now, now.Add(-window), trendingReactionScore, trendingCommentScore, trendingRepostScore,
+		limit, trendingHalfLife.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := []*PostScore{}
+	for rows.Next() {
+		score := new(PostScore)
+		if err := rows.Scan(&score.PostID, &score.Score); err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, rows.Err()
+}
+
+// ScoreTrendingTags returns the up to limit highest scoring hashtags over the
+// window ending at now, counting the authors who used them over that window
+// and the one before it
+func (s *PostgresStore) ScoreTrendingTags(now time.Time, window time.Duration, limit int) ([]*TrendingTag, error) {
+	rows, err := s.db.Query(`
+	SELECT tag, posts, authors, previousAuthors FROM (
+		SELECT uses.tag,
+			COUNT(DISTINCT uses.postID) FILTER (WHERE uses.created_at > $2) AS posts,
+			COUNT(DISTINCT uses.userID) FILTER (WHERE uses.created_at > $2) AS authors,
+			COUNT(DISTINCT uses.userID) FILTER (WHERE uses.created_at <= $2) AS previousAuthors
+		FROM (
+			SELECT post_hashtags.tag, post_hashtags.postID, posts.userID, post_hashtags.created_at FROM post_hashtags
+				INNER JOIN posts ON post_hashtags.postID = posts.id
+				INNER JOIN users ON posts.userID = users.id
+				WHERE post_hashtags.created_at > $1 AND post_hashtags.created_at <= $3 AND NOT users.isPrivate
+		) AS uses
+		GROUP BY uses.tag
+	) AS tags
+		WHERE authors > 0
+		ORDER BY authors::float8 * authors / (previousAuthors + 1) DESC, authors DESC, tag
+		LIMIT $4`, now.Add(-2*window), now.Add(-window), now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*TrendingTag{}
+	for rows.Next() {
+		tag := new(TrendingTag)
+		if err := rows.Scan(&tag.Tag, &tag.Posts, &tag.Authors, &tag.PreviousAuthors); err != nil {
+			return nil, err
+		}
+		tag.Score = trendingTagScore(tag.Authors, tag.PreviousAuthors)
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// GetPostsByIDs returns the posts of ids that viewerID can see, in the order
+// of ids. Posts that were deleted are left out.
+func (s *PostgresStore) GetPostsByIDs(ids []int64, viewerID int64) ([]*Post, error) {
+	rows, err := s.db.Query(`
+	SELECT `+postColumns+` FROM posts
+		WHERE posts.id = ANY($2)
+		`+blockedAuthorsFilter+`
+		`+privateAuthorsFilter+`
+		`+hiddenOriginalsFilter, viewerID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[int64]*Post{}
+	for rows.Next() {
+		post, err := ScanIntoPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan post row: %v", err)
+		}
+		found[post.ID] = post
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	posts := []*Post{}
+	for _, id := range ids {
+		if post, ok := found[id]; ok {
+			posts = append(posts, post)
+		}
+	}
+	if err := s.attachOriginals(posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// CRUD OPERATIONS FOR BOOKMARKS
+
+// BookmarkPost saves a post for userID, into collectionID when it's set.
+// Bookmarking a post again moves it to collectionID.
+func (s *PostgresStore) BookmarkPost(userID, postID int64, collectionID *int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotBlockedByAuthor(tx, userID, "post", postID); err != nil {
+		return err
+	}
+	if collectionID != nil {
+		if err := checkCollectionOwner(tx, userID, *collectionID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO bookmarks (userID, postID, collectionID, created_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (userID, postID) DO UPDATE SET collectionID = EXCLUDED.collectionID`,
+		userID, postID, collectionID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeleteBookmark(userID, postID int64) error {
+	_, err := s.db.Exec(`DELETE FROM bookmarks WHERE userID = $1 AND postID = $2`, userID, postID)
+	return err
+}
+
+// GetBookmarks returns the posts userID bookmarked, newest bookmark first,
+// only those in collectionID when it's set
+func (s *PostgresStore) GetBookmarks(userID int64, collectionID *int64, page *PageRequest) (*Page[*Bookmark], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT bookmarks.id, bookmarks.collectionID, bookmarks.created_at, `+postColumns+`
+		FROM bookmarks
+		INNER JOIN posts ON bookmarks.postID = posts.id
+		WHERE bookmarks.userID = $1
+		AND ($5::bigint IS NULL OR bookmarks.collectionID = $5)
+		AND ($2::timestamptz IS NULL OR (bookmarks.created_at, bookmarks.id) < ($2, $3))
+		ORDER BY bookmarks.created_at DESC, bookmarks.id DESC
+		LIMIT $4`, userID, afterTime, afterID, page.Limit+1, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []*Bookmark{}
+	posts := []*Post{}
+	for rows.Next() {
+		bookmark := &Bookmark{Post: new(Post)}
+		fields := append([]any{&bookmark.ID, &bookmark.CollectionID, &bookmark.Created_at}, postFields(bookmark.Post)...)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, bookmark)
+		posts = append(posts, bookmark.Post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.attachOriginals(posts); err != nil {
+		return nil, err
+	}
+
+	return newPage(bookmarks, page, bookmarkCursor), nil
+}
+
+func (s *PostgresStore) CreateCollection(userID int64, name string) (*Collection, error) {
+	collection := &Collection{UserID: userID, Name: name, Created_at: time.Now().UTC()}
+	err := s.db.QueryRow(`INSERT INTO bookmark_collections (userID, name, created_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (userID, name) DO NOTHING
+	RETURNING id`, userID, name, collection.Created_at).Scan(&collection.ID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("collection %q already exists", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func (s *PostgresStore) GetCollections(userID int64, page *PageRequest) (*Page[*Collection], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT id, userID, name, created_at,
+		(SELECT COUNT(*) FROM bookmarks WHERE bookmarks.collectionID = bookmark_collections.id)
+		FROM bookmark_collections
+		WHERE userID = $1
+		AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4`, userID, afterTime, afterID, page.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+	for rows.Next() {
+		collection := new(Collection)
+		err := rows.Scan(&collection.ID, &collection.UserID, &collection.Name, &collection.Created_at, &collection.Bookmarks)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newPage(collections, page, collectionCursor), nil
+}
+
+func (s *PostgresStore) RenameCollection(userID, id int64, name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkCollectionOwner(tx, userID, id); err != nil {
+		return err
+	}
+
+	var taken bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM bookmark_collections WHERE userID = $1 AND name = $2 AND id <> $3)`,
+		userID, name, id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("collection %q already exists", name)
+	}
+
+	if _, err := tx.Exec(`UPDATE bookmark_collections SET name = $1 WHERE id = $2`, name, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCollection deletes one of userID's collections, its bookmarks are
+// kept outside of any collection
+func (s *PostgresStore) DeleteCollection(userID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM bookmark_collections WHERE id = $1 AND userID = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("collection %d not found", id)
+	}
+	return nil
+}
+
+// CRUD OPERATIONS FOR BLOCKS AND MUTES
+
+// BlockUser makes userID block blockedID, which also removes any follows and
+// follow requests between them
+func (s *PostgresStore) BlockUser(userID, blockedID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO blocks (userID, blockedID, created_at) VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING`, userID, blockedID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM follows
+		WHERE (userID = $1 AND followerID = $2) OR (userID = $2 AND followerID = $1)`, userID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM timelines
+		WHERE (userID = $1 AND authorID = $2) OR (userID = $2 AND authorID = $1)`, userID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM follow_requests
+		WHERE (userID = $1 AND requesterID = $2) OR (userID = $2 AND requesterID = $1)`, userID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) UnblockUser(userID, blockedID int64) error {
+	_, err := s.db.Exec(`DELETE FROM blocks WHERE userID = $1 AND blockedID = $2`, userID, blockedID)
+	return err
+}
+
+// IsBlocked reports whether either user has blocked the other
+func (s *PostgresStore) IsBlocked(userID, otherID int64) (bool, error) {
+	var blocked bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM blocks
+		WHERE (userID = $1 AND blockedID = $2) OR (userID = $2 AND blockedID = $1))`,
+		userID, otherID).Scan(&blocked)
+	return blocked, err
+}
+
+func (s *PostgresStore) MuteUser(userID, mutedID int64) error {
+	_, err := s.db.Exec(`INSERT INTO mutes (userID, mutedID, created_at) VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING`, userID, mutedID, time.Now().UTC())
+	return err
+}
+
+func (s *PostgresStore) UnmuteUser(userID, mutedID int64) error {
+	_, err := s.db.Exec(`DELETE FROM mutes WHERE userID = $1 AND mutedID = $2`, userID, mutedID)
+	return err
+}
+
+func (s *PostgresStore) IsMuted(userID, mutedID int64) (bool, error) {
+	var muted bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM mutes WHERE userID = $1 AND mutedID = $2)`,
+		userID, mutedID).Scan(&muted)
+	return muted, err
+}
+
+// GetMutedByIDs returns the ids of everyone who muted userID
+func (s *PostgresStore) GetMutedByIDs(userID int64) ([]int64, error) {
+	rows, err := s.db.Query(`SELECT userID FROM mutes WHERE mutedID = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CRUD OPERATIONS FOR SESSIONS
+func (s *PostgresStore) CreateSession(session *Session) error {
+	_, err := s.db.Exec(`INSERT INTO sessions (id, userID, refreshToken, expirationTime, isBlocked,
+	 created_at, device, ip, userAgent, lastUsedAt)
+	 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		session.ID, session.UserID, session.RefreshToken,
+		session.ExpirationTime, session.IsBlocked, session.CreatedAt,
+		session.Device, session.IP, session.UserAgent, session.LastUsedAt)
+	return err
+}
+
+func (s *PostgresStore) GetSession(id string) (*Session, error) {
+	rows, err := s.db.Query(`SELECT * FROM sessions WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		return ScanIntoSession(rows)
+	}
+
+	return nil, nil
+}
+
+// GetSessionByRefreshToken returns the session whose current or previous
+// refresh token hash is refreshToken.
+func (s *PostgresStore) GetSessionByRefreshToken(refreshToken string) (*Session, error) {
+	rows, err := s.db.Query(`SELECT * FROM sessions WHERE refreshToken = $1 OR previousRefreshToken = $1`, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		return ScanIntoSession(rows)
+	}
+
+	return nil, nil
+}
+
+func (s *PostgresStore) GetUserSessions(userID int64) ([]*Session, error) {
+	rows, err := s.db.Query(`SELECT * FROM sessions WHERE userID = $1 ORDER BY lastUsedAt DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := ScanIntoSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session row: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// RotateSession replaces the refresh token hash of a session, as long as it's
+// still oldRefreshToken, and keeps oldRefreshToken as its previous one. It
+// reports false when it isn't anymore, the old token having been used already.
+func (s *PostgresStore) RotateSession(id, oldRefreshToken, refreshToken string, expiresAt time.Time) (bool, error) {
+	res, err := s.db.Exec(`UPDATE sessions SET refreshToken = $1, previousRefreshToken = $5,
+	 expirationTime = $2, lastUsedAt = $3
+	 WHERE id = $4 AND refreshToken = $5 AND isBlocked = FALSE`,
+		refreshToken, expiresAt, time.Now().UTC(), id, oldRefreshToken)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *PostgresStore) DeleteSession(id string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE id = $1`, id)
+	return err
+}
+
+// CRUD OPERATIONS FOR NOTIFICATIONS
+
+// hiddenActorsFilter leaves out notifications about users the recipient
+// blocked or muted
+const hiddenActorsFilter = `AND NOT EXISTS (SELECT 1 FROM blocks
+			WHERE blocks.userID = notifications.userID AND blocks.blockedID = notifications.actorID)
+		AND NOT EXISTS (SELECT 1 FROM mutes
+			WHERE mutes.userID = notifications.userID AND mutes.mutedID = notifications.actorID)`
+
+// notificationGroupKey computes groupKey in SQL
+const notificationGroupKey = `CASE WHEN notifications.type = 'mention' THEN 'mention:' || notifications.id
+		ELSE notifications.type || ':' || COALESCE(notifications.postID, 0) || ':' || COALESCE(notifications.commentID, 0) END`
+
+// GetNotifications returns a page of notification groups, ordered by their
+// newest notification. Pages are made of whole groups so a group is never
+// split across two pages.
+func (s *PostgresStore) GetNotifications(userID int64, page *PageRequest) (*Page[*NotificationGroup], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	WITH visible AS (
+		SELECT notifications.id, notifications.userID, notifications.actorID, users.userName,
+			notifications.type, notifications.postID, notifications.commentID,
+			notifications.isRead, notifications.created_at, `+notificationGroupKey+` AS groupKey
+			FROM notifications
+			INNER JOIN users ON notifications.actorID = users.id
+			WHERE notifications.userID = $1
+			`+hiddenActorsFilter+`
+	), groups AS (
+		SELECT groupKey FROM (
+			SELECT DISTINCT ON (groupKey) groupKey, created_at, id FROM visible
+				ORDER BY groupKey, created_at DESC, id DESC
+		) AS newest
+			WHERE $2::timestamptz IS NULL OR (created_at, id) < ($2, $3)
+			ORDER BY created_at DESC, id DESC
+			LIMIT $4
+	)
+	SELECT id, userID, actorID, userName, type, postID, commentID, isRead, created_at FROM visible
+		WHERE groupKey IN (SELECT groupKey FROM groups)
+		ORDER BY created_at DESC, id DESC`, userID, afterTime, afterID, page.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %v", err)
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		notification, err := ScanIntoNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newGroupPage(notifications, page), nil
+}
+
+func (s *PostgresStore) CountUnreadNotifications(userID int64) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM notifications
+		WHERE notifications.userID = $1 AND notifications.isRead = FALSE
+		`+hiddenActorsFilter, userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationsRead marks the given notifications of userID as read, or
+// all of them when ids is empty
+func (s *PostgresStore) MarkNotificationsRead(userID int64, ids []int64) error {
+	if len(ids) == 0 {
+		_, err := s.db.Exec(`UPDATE notifications SET isRead = TRUE WHERE userID = $1 AND isRead = FALSE`, userID)
+		return err
+	}
+
+	_, err := s.db.Exec(`UPDATE notifications SET isRead = TRUE WHERE userID = $1 AND id = ANY($2)`,
+		userID, pq.Array(ids))
+	return err
+}
+
+// CRUD OPERATIONS FOR CONVERSATIONS
+func (s *PostgresStore) GetOrCreateDirectConversation(userID, otherID int64) (*Conversation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	key := directConversationKey(userID, otherID)
+	now := time.Now().UTC()
+	_, err = tx.Exec(`INSERT INTO conversations (directKey, created_at, lastMessageAt)
+	VALUES ($1, $2, $2) ON CONFLICT (directKey) DO NOTHING`, key, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int64
+	if err := tx.QueryRow(`SELECT id FROM conversations WHERE directKey = $1`, key).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO conversation_members (conversationID, userID, joined_at)
+	VALUES ($1, $2, $4), ($1, $3, $4) ON CONFLICT DO NOTHING`, id, userID, otherID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetConversation(id)
+}
+
+func (s *PostgresStore) GetConversation(id int64) (*Conversation, error) {
+	rows, err := s.db.Query(`SELECT `+conversationColumns+` FROM conversations WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations, err := ScanIntoConversations(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return nil, nil
+	}
+
+	if err := s.fillConversations(conversations); err != nil {
+		return nil, err
+	}
+	return conversations[0], nil
+}
+
+// GetUserConversations returns the conversations userID is a member of, the
+// most recently active first
+func (s *PostgresStore) GetUserConversations(userID int64, page *PageRequest) (*Page[*Conversation], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT `+conversationColumns+`
+		FROM conversations
+		INNER JOIN conversation_members ON conversation_members.conversationID = conversations.id
+		WHERE conversation_members.userID = $1
+		AND ($2::timestamptz IS NULL OR (conversations.lastMessageAt, conversations.id) < ($2, $3))
+		ORDER BY conversations.lastMessageAt DESC, conversations.id DESC
+		LIMIT $4`, userID, afterTime, afterID, page.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversations: %v", err)
+	}
+	defer rows.Close()
+
+	conversations, err := ScanIntoConversations(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	res := newPage(conversations, page, conversationCursor)
+	if err := s.fillConversations(res.Items); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *PostgresStore) IsConversationMember(conversationID, userID int64) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (
+		SELECT 1 FROM conversation_members WHERE conversationID = $1 AND userID = $2)`,
+		conversationID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (s *PostgresStore) GetMessages(conversationID int64, page *PageRequest) (*Page[*Message], error) {
+	afterTime, afterID := pageArgs(page)
+	rows, err := s.db.Query(`
+	SELECT `+messageColumns+` FROM messages
+		WHERE conversationID = $1
+		AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4`, conversationID, afterTime, afterID, page.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %v", err)
+	}
+	defer rows.Close()
+
+	messages := []*Message{}
+	for rows.Next() {
+		message, err := ScanIntoMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return newPage(messages, page, messageCursor), nil
+}
+
+func (s *PostgresStore) CreateMessage(conversationID int64, req *CreateMessageRequest) (*Message, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	message, err := insertMessage(tx, conversationID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// CreateGroupConversation creates a group with creatorID as its admin and
+// memberIDs as members, notice being the system message announcing it
+func (s *PostgresStore) CreateGroupConversation(creatorID int64, title string, memberIDs []int64, notice *CreateMessageRequest) (*Conversation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	now := time.Now().UTC()
+	err = tx.QueryRow(`INSERT INTO conversations (kind, title, created_at, lastMessageAt)
+	VALUES ($1, $2, $3, $3) RETURNING id`, ConversationGroup, title, now).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO conversation_members (conversationID, userID, role, joined_at)
+	VALUES ($1, $2, $3, $4)`, id, creatorID, RoleAdmin, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addMembers(tx, id, memberIDs); err != nil {
+		return nil, err
+	}
+
+	if _, err := insertMessage(tx, id, notice); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetConversation(id)
+}
+
+func (s *PostgresStore) GetConversationMember(conversationID, userID int64) (*ConversationMember, error) {
+	member := new(ConversationMember)
+	err := s.db.QueryRow(`
+	SELECT `+memberColumns+`
+		FROM conversation_members
+		INNER JOIN users ON conversation_members.userID = users.id
+		WHERE conversation_members.conversationID = $1 AND conversation_members.userID = $2`,
+		conversationID, userID).Scan(memberFields(member)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *PostgresStore) AddConversationMembers(conversationID int64, userIDs []int64, notice *CreateMessageRequest) (*Message, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// lock the conversation so concurrent adds can't overshoot the member limit
+	if _, err := tx.Exec(`SELECT id FROM conversations WHERE id = $1 FOR UPDATE`, conversationID); err != nil {
+		return nil, err
+	}
+
+	if err := addMembers(tx, conversationID, userIDs); err != nil {
+		return nil, err
+	}
+
+	message, err := insertMessage(tx, conversationID, notice)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// RemoveConversationMember removes userID from a group. When the last admin
+// leaves, the longest standing member becomes admin, and a group nobody is
+// left in is deleted, in which case no message is returned.
+func (s *PostgresStore) RemoveConversationMember(conversationID, userID int64, notice *CreateMessageRequest) (*Message, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM conversations WHERE id = $1 FOR UPDATE`, conversationID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM conversation_members WHERE conversationID = $1 AND userID = $2`,
+		conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var remaining int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM conversation_members WHERE conversationID = $1`,
+		conversationID).Scan(&remaining)
+	if err != nil {
+		return nil, err
+	}
+	if remaining == 0 {
+		if _, err := tx.Exec(`DELETE FROM conversations WHERE id = $1`, conversationID); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	}
+
+	_, err = tx.Exec(`UPDATE conversation_members SET role = $2
+	WHERE conversationID = $1
+	AND userID = (SELECT userID FROM conversation_members
+		WHERE conversationID = $1 ORDER BY joined_at, userID LIMIT 1)
+	AND NOT EXISTS (SELECT 1 FROM conversation_members WHERE conversationID = $1 AND role = $2)`,
+		conversationID, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := insertMessage(tx, conversationID, notice)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func (s *PostgresStore) UpdateConversationTitle(id int64, title string, notice *CreateMessageRequest) (*Message, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE conversations SET title = $1 WHERE id = $2`, title, id); err != nil {
+		return nil, err
+	}
+
+	message, err := insertMessage(tx, id, notice)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func (s *PostgresStore) SetConversationMemberRole(conversationID, userID int64, role string) error {
+	_, err := s.db.Exec(`UPDATE conversation_members SET role = $1 WHERE conversationID = $2 AND userID = $3`,
+		role, conversationID, userID)
+	return err
+}
+
+// MarkConversationRead moves userID's read marker forward to messageID, or to
+// the latest message when messageID is 0, and returns where the marker is
+func (s *PostgresStore) MarkConversationRead(conversationID, userID, messageID int64) (int64, error) {
+	_, err := s.db.Exec(`
+	UPDATE conversation_members SET lastReadMessageID = latest.id
+		FROM (SELECT MAX(id) AS id FROM messages
+			WHERE conversationID = $1 AND ($3 = 0 OR id = $3)) latest
+		WHERE conversation_members.conversationID = $1 AND conversation_members.userID = $2
+		AND latest.id IS NOT NULL
+		AND (conversation_members.lastReadMessageID IS NULL OR conversation_members.lastReadMessageID < latest.id)`,
+		conversationID, userID, messageID)
+	if err != nil {
+		return 0, err
+	}
+
+	var lastRead sql.NullInt64
+	err = s.db.QueryRow(`SELECT lastReadMessageID FROM conversation_members WHERE conversationID = $1 AND userID = $2`,
+		conversationID, userID).Scan(&lastRead)
+	if err != nil {
+		return 0, err
+	}
+	return lastRead.Int64, nil
+}
+
+// GetConversationPartnerIDs returns the ids of everyone sharing a
+// conversation with userID, but for users who blocked or were blocked by them
+func (s *PostgresStore) GetConversationPartnerIDs(userID int64) ([]int64, error) {
+	rows, err := s.db.Query(`
+	SELECT DISTINCT others.userID FROM conversation_members
+		INNER JOIN conversation_members others ON others.conversationID = conversation_members.conversationID
+		WHERE conversation_members.userID = $1 AND others.userID != $1
+		AND NOT EXISTS (SELECT 1 FROM blocks
+			WHERE (blocks.userID = $1 AND blocks.blockedID = others.userID)
+			OR (blocks.userID = others.userID AND blocks.blockedID = $1))`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *PostgresStore) SetLastSeen(userID int64, at time.Time) error {
+	_, err := s.db.Exec(`UPDATE users SET lastSeenAt = $1 WHERE id = $2`, at, userID)
+	return err
+}
+
+// fillConversations loads the members and latest message of conversations
+func (s *PostgresStore) fillConversations(conversations []*Conversation) error {
+	if len(conversations) == 0 {
+		return nil
+	}
+
+	byID := map[int64]*Conversation{}
+	ids := []int64{}
+	for _, conversation := range conversations {
+		byID[conversation.ID] = conversation
+		ids = append(ids, conversation.ID)
+	}
+
+	rows, err := s.db.Query(`
+	SELECT conversation_members.conversationID, `+memberColumns+`
+		FROM conversation_members
+		INNER JOIN users ON conversation_members.userID = users.id
+		WHERE conversation_members.conversationID = ANY($1)
+		ORDER BY conversation_members.joined_at, users.id`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to get conversation members: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var conversationID int64
+		member := new(ConversationMember)
+		if err := rows.Scan(append([]any{&conversationID}, memberFields(member)...)...); err != nil {
+			return err
+		}
+		byID[conversationID].Members = append(byID[conversationID].Members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	lastRows, err := s.db.Query(`
+	SELECT DISTINCT ON (conversationID) `+messageColumns+` FROM messages
+		WHERE conversationID = ANY($1)
+		ORDER BY conversationID, created_at DESC, id DESC`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to get last messages: %v", err)
+	}
+	defer lastRows.Close()
+
+	for lastRows.Next() {
+		message, err := ScanIntoMessage(lastRows)
+		if err != nil {
+			return err
+		}
+		byID[message.ConversationID].LastMessage = message
+	}
+	return lastRows.Err()
+}
+
+// FUNCTIONS FOR CREATING STRUCTS FROM SQL ROWS
+// userColumns lists the users columns in the order ScanIntoUser expects
+const userColumns = `id, userName, name, email, bio, passwordHash, created_at, allowMessagesFrom, hideReadReceipts, isPrivate`
+
+func ScanIntoUser(rows *sql.Rows) (*User, error) {
+	user := new(User)
+	err := rows.Scan(
+		&user.ID,
+		&user.UserName,
+		&user.Name,
+		&user.Email,
+		&user.Bio,
+		&user.PasswordHash,
+		&user.Created_at,
+		&user.AllowMessagesFrom,
+		&user.HideReadReceipts,
+		&user.IsPrivate,
+	)
+
+	return user, err
 }
 
+// postColumns lists the posts columns in the order ScanIntoPost expects
+const postColumns = `posts.id, posts.userID, posts.content, posts.mediaUrl, posts.created_at,
+	posts.repostOfID, posts.quoteOfID,
+	(SELECT COUNT(*) FROM posts AS shares WHERE shares.repostOfID = posts.id OR shares.quoteOfID = posts.id),
+	(SELECT COALESCE(json_object_agg(reaction, total), '{}') FROM (
+		SELECT reaction, COUNT(*) AS total FROM post_likes WHERE post_likes.postID = posts.id GROUP BY reaction
+	) AS reactions),
+	(SELECT ` + mentionsColumn + ` FROM mentions INNER JOIN users ON mentions.userID = users.id
+		WHERE mentions.postID = posts.id AND mentions.commentID IS NULL)`
+
+// mentionsColumn aggregates the mentions rows, joined with their users, into
+// the JSON array Mentions scans
+const mentionsColumn = `COALESCE(json_agg(json_build_object('userID', mentions.userID, 'userName', users.userName,
+		'offset', mentions.position, 'length', mentions.length) ORDER BY mentions.position), '[]')`
+
 func ScanIntoPost(rows *sql.Rows) (*Post, error) {
 	post := new(Post)
-	err := rows.Scan(
+	err := rows.Scan(postFields(post)...)
+
+	return post, err
+}
+
+func postFields(post *Post) []any {
+	return []any{
 		&post.ID,
 		&post.UserID,
 		&post.Content,
 		&post.MediaUrl,
 		&post.Created_at,
-	)
+		&post.RepostOfID,
+		&post.QuoteOfID,
+		&post.Reposts,
+		&post.Reactions,
+		&post.Mentions,
+	}
+}
 
-	return post, err
+// attachOriginals sets the post shared by each repost and quote in posts
+func (s *PostgresStore) attachOriginals(posts []*Post) error {
+	ids := []int64{}
+	for _, post := range posts {
+		if id := originalID(post); id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := s.db.Query(`SELECT `+postColumns+` FROM posts WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	originals := map[int64]*Post{}
+	for rows.Next() {
+		original, err := ScanIntoPost(rows)
+		if err != nil {
+			return err
+		}
+		originals[original.ID] = original
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		if id := originalID(post); id != nil {
+			post.Original = originals[*id]
+		}
+	}
+	return nil
 }
 
+// commentColumns lists the comments columns in the order ScanIntoComment
+// expects
+const commentColumns = `comments.id, comments.userID, comments.postID, comments.content, comments.created_at,
+	comments.parentCommentID, comments.depth,
+	(SELECT COUNT(*) FROM comments AS replies WHERE replies.parentCommentID = comments.id) AS replyCount,
+	(SELECT COALESCE(json_object_agg(reaction, total), '{}') FROM (
+		SELECT reaction, COUNT(*) AS total FROM comment_likes WHERE comment_likes.commentID = comments.id GROUP BY reaction
+	) AS reactions) AS reactions,
+	(SELECT ` + mentionsColumn + ` FROM mentions INNER JOIN users ON mentions.userID = users.id
+		WHERE mentions.commentID = comments.id) AS mentions`
+
 func ScanIntoComment(rows *sql.Rows) (*Comment, error) {
 	comment := new(Comment)
-	err := rows.Scan(
+	err := rows.Scan(commentFields(comment)...)
+
+	return comment, err
+}
+
+func commentFields(comment *Comment) []any {
+	return []any{
 		&comment.ID,
 		&comment.UserID,
 		&comment.PostID,
 		&comment.Text,
 		&comment.Created_at,
-	)
+		&comment.ParentCommentID,
+		&comment.Depth,
+		&comment.ReplyCount,
+		&comment.Reactions,
+		&comment.Mentions,
+	}
+}
 
-	return comment, err
+func ScanIntoComments(rows *sql.Rows) ([]*Comment, error) {
+	comments := []*Comment{}
+	for rows.Next() {
+		comment, err := ScanIntoComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
 }
 
 func ScanIntoFollow(rows *sql.Rows) (*Follow, error) {
@@ -572,7 +2869,318 @@ func ScanIntoFollow(rows *sql.Rows) (*Follow, error) {
 	return follow, err
 }
 
+// ScanIntoNameRows scans (userName, created_at, id) rows of user lists
+func ScanIntoNameRows(rows *sql.Rows) ([]*nameRow, error) {
+	names := []*nameRow{}
+	for rows.Next() {
+		row := new(nameRow)
+		if err := rows.Scan(&row.Name, &row.Cursor.CreatedAt, &row.Cursor.ID); err != nil {
+			return nil, err
+		}
+		names = append(names, row)
+	}
+	return names, rows.Err()
+}
+
+func ScanIntoSession(rows *sql.Rows) (*Session, error) {
+	session := new(Session)
+	err := rows.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.RefreshToken,
+		&session.ExpirationTime,
+		&session.IsBlocked,
+		&session.CreatedAt,
+		&session.Device,
+		&session.IP,
+		&session.UserAgent,
+		&session.LastUsedAt,
+		&session.PreviousRefreshToken,
+	)
+
+	return session, err
+}
+
+func ScanIntoNotification(rows *sql.Rows) (*Notification, error) {
+	notification := new(Notification)
+	err := rows.Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.ActorID,
+		&notification.ActorName,
+		&notification.Type,
+		&notification.PostID,
+		&notification.CommentID,
+		&notification.IsRead,
+		&notification.Created_at)
+
+	return notification, err
+}
+
+// conversationColumns lists the conversations columns in the order
+// ScanIntoConversations expects
+const conversationColumns = `conversations.id, conversations.kind, conversations.title,
+	conversations.created_at, conversations.lastMessageAt`
+
+func ScanIntoConversations(rows *sql.Rows) ([]*Conversation, error) {
+	conversations := []*Conversation{}
+	for rows.Next() {
+		conversation := &Conversation{Members: []*ConversationMember{}}
+		err := rows.Scan(
+			&conversation.ID,
+			&conversation.Kind,
+			&conversation.Title,
+			&conversation.Created_at,
+			&conversation.LastMessageAt)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, rows.Err()
+}
+
+// messageColumns lists the messages columns in the order ScanIntoMessage expects
+const messageColumns = `id, conversationID, userID, kind, content, created_at`
+
+func ScanIntoMessage(rows *sql.Rows) (*Message, error) {
+	message := new(Message)
+	err := rows.Scan(
+		&message.ID,
+		&message.ConversationID,
+		&message.UserID,
+		&message.Kind,
+		&message.Content,
+		&message.Created_at)
+
+	return message, err
+}
+
 // HELPER FUNCTIONS
+// pageArgs returns the created_at and id to continue after, created_at being
+// NULL for the first page
+func pageArgs(page *PageRequest) (any, int64) {
+	if page.After == nil {
+		return nil, 0
+	}
+	return page.After.CreatedAt, page.After.ID
+}
+
+func postCursor(post *Post) Cursor {
+	return Cursor{CreatedAt: post.Created_at, ID: post.ID}
+}
+
+func commentCursor(comment *Comment) Cursor {
+	return Cursor{CreatedAt: comment.Created_at, ID: comment.ID}
+}
+
+func notificationCursor(notification *Notification) Cursor {
+	return Cursor{CreatedAt: notification.Created_at, ID: notification.ID}
+}
+
+// conversationCursor orders conversations by their latest activity
+func conversationCursor(conversation *Conversation) Cursor {
+	return Cursor{CreatedAt: conversation.LastMessageAt, ID: conversation.ID}
+}
+
+func messageCursor(message *Message) Cursor {
+	return Cursor{CreatedAt: message.Created_at, ID: message.ID}
+}
+
+// memberColumns lists the conversation member columns in the order
+// memberFields expects, conversation_members joined with users
+const memberColumns = `users.id, users.userName, conversation_members.role, conversation_members.joined_at,
+		conversation_members.lastReadMessageID, users.hideReadReceipts, users.lastSeenAt`
+
+func memberFields(member *ConversationMember) []any {
+	return []any{
+		&member.UserID,
+		&member.UserName,
+		&member.Role,
+		&member.Joined_at,
+		&member.LastReadMessageID,
+		&member.HideReadReceipts,
+		&member.LastSeenAt,
+	}
+}
+
+// insertMessage adds a message to a conversation and bumps its activity
+func insertMessage(tx *sql.Tx, conversationID int64, req *CreateMessageRequest) (*Message, error) {
+	message := &Message{
+		ConversationID: conversationID,
+		UserID:         req.UserID,
+		Kind:           req.Kind,
+		Content:        req.Content,
+		Created_at:     time.Now().UTC(),
+	}
+	if message.Kind == "" {
+		message.Kind = MessageText
+	}
+
+	err := tx.QueryRow(`INSERT INTO messages (conversationID, userID, kind, content, created_at)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		conversationID, message.UserID, message.Kind, message.Content, message.Created_at).Scan(&message.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE conversations SET lastMessageAt = $1 WHERE id = $2`,
+		message.Created_at, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	// senders have read their own message
+	_, err = tx.Exec(`UPDATE conversation_members SET lastReadMessageID = $1 WHERE conversationID = $2 AND userID = $3`,
+		message.ID, conversationID, message.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// insertFollow makes req.UserID follow req.FollowingID and backfills the
+// follower's timeline with the account's latest posts
+func insertFollow(tx *sql.Tx, req *FollowRequest) error {
+	// follows.userID is the followed account, followerID the account following it
+	_, err := tx.Exec(`INSERT INTO follows (userID, followerID, created_at) 
+	VALUES ($1, $2, $3)`,
+		req.FollowingID,
+		req.UserID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO timelines (userID, postID, authorID, created_at)
+	SELECT $1, id, userID, created_at FROM posts
+		WHERE userID = $2 AND fannedOut = TRUE
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	ON CONFLICT DO NOTHING`, req.UserID, req.FollowingID, timelineBackfillSize)
+	return err
+}
+
+// deleteFollowRequest removes a pending follow request along with the
+// notification about it, failing when there is none
+func deleteFollowRequest(tx *sql.Tx, userID, requesterID int64) error {
+	res, err := tx.Exec(`DELETE FROM follow_requests WHERE userID = $1 AND requesterID = $2`,
+		userID, requesterID)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err != nil || deleted == 0 {
+		return fmt.Errorf("no follow request from user %d", requesterID)
+	}
+
+	_, err = tx.Exec(`DELETE FROM notifications WHERE userID = $1 AND actorID = $2 AND type = $3`,
+		userID, requesterID, NotificationFollowRequest)
+	return err
+}
+
+// checkNotBlocked fails with errBlocked when either user has blocked the other
+func checkNotBlocked(tx *sql.Tx, userID, otherID int64) error {
+	var blocked bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM blocks
+		WHERE (userID = $1 AND blockedID = $2) OR (userID = $2 AND blockedID = $1))`,
+		userID, otherID).Scan(&blocked)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errBlocked
+	}
+	return nil
+}
+
+// checkShareable fails when req reposts or quotes a post that doesn't exist,
+// whose author blocked or was blocked by the sharer, or that the sharer
+// already reposted
+func checkShareable(tx *sql.Tx, req *CreatePostRequest) error {
+	originalID, _ := sharedPost(req)
+	if originalID == nil {
+		return nil
+	}
+	if err := checkNotBlockedByAuthor(tx, req.UserID, "post", *originalID); err != nil {
+		return err
+	}
+	if req.RepostOfID == nil {
+		return nil
+	}
+
+	var reposted bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM posts WHERE userID = $1 AND repostOfID = $2)`,
+		req.UserID, *req.RepostOfID).Scan(&reposted)
+	if err != nil {
+		return err
+	}
+	if reposted {
+		return errAlreadyReposted
+	}
+	return nil
+}
+
+// indexHashtags stores the hashtags of a post's content in post_hashtags
+func indexHashtags(tx *sql.Tx, postID int64, content string, createdAt time.Time) error {
+	tags := extractHashtags(content)
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO post_hashtags (postID, tag, created_at)
+	SELECT $1, unnest($2::text[]), $3`, postID, pq.Array(tags), createdAt)
+	return err
+}
+
+// checkCollectionOwner fails when collectionID isn't one of userID's
+// collections
+func checkCollectionOwner(tx *sql.Tx, userID, collectionID int64) error {
+	var owned bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM bookmark_collections WHERE id = $1 AND userID = $2)`,
+		collectionID, userID).Scan(&owned)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return fmt.Errorf("collection %d not found", collectionID)
+	}
+	return nil
+}
+
+// checkNotBlockedByAuthor fails with errBlocked when userID and the author of
+// a "post" or "comment" blocked each other
+func checkNotBlockedByAuthor(tx *sql.Tx, userID int64, resourceType string, id int64) error {
+	var authorID int64
+	err := tx.QueryRow(`SELECT userID FROM `+resourceType+`s WHERE id = $1`, id).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%s %d not found", resourceType, id)
+	}
+	if err != nil {
+		return err
+	}
+	return checkNotBlocked(tx, userID, authorID)
+}
+
+// addMembers adds userIDs to a group, skipping existing members, and fails
+// with errGroupFull when that would exceed maxGroupMembers
+func addMembers(tx *sql.Tx, conversationID int64, userIDs []int64) error {
+	_, err := tx.Exec(`INSERT INTO conversation_members (conversationID, userID, role, joined_at)
+	SELECT $1, unnest($2::bigint[]), $3, $4
+	ON CONFLICT DO NOTHING`, conversationID, pq.Array(userIDs), RoleMember, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	var members int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM conversation_members WHERE conversationID = $1`,
+		conversationID).Scan(&members)
+	if err != nil {
+		return err
+	}
+	if members > maxGroupMembers {
+		return errGroupFull
+	}
+	return nil
+}
+
 func (s *PostgresStore) getUserIDFromUserName(username string) (int64, error) {
 	var id int64
 	idrow, err := s.db.Query(`SELECT id FROM users WHERE username = $1`, username)
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestPostgresStore connects to the database configured by DB_USER,
+// DB_NAME and DB_PASS, skipping the test when DB_NAME isn't set
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	if os.Getenv("DB_NAME") == "" {
+		t.Skip("DB_NAME isn't set, skipping PostgreSQL store tests")
+	}
+	store, err := NewPostgresStore()
+	if err != nil {
+		t.Fatalf("NewPostgresStore returned an error: %v", err)
+	}
+	if err := store.Init(); err != nil {
+		t.Fatalf("Init returned an error: %v", err)
+	}
+	t.Cleanup(func() { store.db.Close() })
+	return store
+}
+
+// createTestPostgresUser creates a user with a unique name, deleted when the
+// test ends
+func createTestPostgresUser(t *testing.T, s *PostgresStore, name string) *User {
+	t.Helper()
+	user := createTestUser(t, s, fmt.Sprintf("%s%d", name, time.Now().UnixNano()))
+	t.Cleanup(func() { s.DeleteUser(user.UserName) })
+	return user
+}
+
+// rerunMigration runs the up or down SQL of an applied migration again
+func rerunMigration(t *testing.T, migrator *Migrator, version int64, up bool) {
+	t.Helper()
+	migration := migrator.migrations[version-1]
+	query := migration.Down
+	if up {
+		query = migration.Up
+	}
+
+	tx, err := migrator.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := migrator.exec(tx, query); err != nil {
+		t.Fatalf("Migration %d_%s returned an error: %v", version, migration.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresStoreGetFeed(t *testing.T) {
+	s := newTestPostgresStore(t)
+	alice := createTestPostgresUser(t, s, "alice")
+	bob := createTestPostgresUser(t, s, "bob")
+	if err := s.CreateFollow(&FollowRequest{UserID: bob.ID, FollowingID: alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// one post fanned out to bob's timeline and one read from alice's posts
+	s.fanoutLimit = 1
+	fannedOut, err := s.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "fanned out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.fanoutLimit = 0
+	pulled, err := s.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "pulled"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.LikePost(bob.ID, fannedOut.ID)
+
+	feed, err := s.GetFeed(bob.ID, firstPage)
+	if err != nil {
+		t.Fatalf("GetFeed returned an error: %v", err)
+	}
+	if len(feed.Items) != 2 || feed.Items[0].ID != pulled.ID || feed.Items[1].ID != fannedOut.ID {
+		t.Fatalf("Expected both of alice's posts, newest first, got %+v", feed.Items)
+	}
+	if feed.Items[1].Reactions[s.reactions[0]] != 1 {
+		t.Errorf("Expected bob's like on the fanned out post, got %v", feed.Items[1].Reactions)
+	}
+}
+
+func TestPostgresStoreMigrateLegacyLikes(t *testing.T) {
+	s := newTestPostgresStore(t)
+	alice := createTestPostgresUser(t, s, "alice")
+	bob := createTestPostgresUser(t, s, "bob")
+	post, err := s.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "liked long ago"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alice's like predates reactions, bob's is a 👍 given since
+	_, err = s.db.Exec(`INSERT INTO post_likes (userID, postID, reaction, created_at) VALUES
+		($1, $3, '👍', '2000-01-01'), ($2, $3, '👍', NOW())`, alice.ID, bob.ID, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator.settings["app.default_reaction"] = "❤️"
+
+	rerunMigration(t, migrator, 25, true)
+	post, _ = s.GetPost(post.ID)
+	if post.Reactions["❤️"] != 1 || post.Reactions["👍"] != 1 {
+		t.Errorf("Expected only the legacy like to move to ❤️, got %v", post.Reactions)
+	}
+
+	rerunMigration(t, migrator, 25, false)
+	post, _ = s.GetPost(post.ID)
+	if post.Reactions["👍"] != 2 {
+		t.Errorf("Expected reverting to give the legacy like 👍 back, got %v", post.Reactions)
+	}
+}
+
+func TestPostgresStoreSearchEscapesSnippets(t *testing.T) {
+	s := newTestPostgresStore(t)
+	alice := createTestPostgresUser(t, s, "alice")
+	content := "<img src=x onerror=alert(1)> pasta " + headlineStart + "night"
+	post, err := s.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.SearchPosts(&SearchRequest{Query: "pasta", Limit: maxPageSize}, alice.ID)
+	if err != nil {
+		t.Fatalf("SearchPosts returned an error: %v", err)
+	}
+	for _, result := range results.Items {
+		if result.Post.ID != post.ID {
+			continue
+		}
+		if strings.Contains(result.Snippet, "<img") || strings.Count(result.Snippet, highlightStart) != 1 {
+			t.Errorf("Expected an escaped snippet with one match, got %q", result.Snippet)
+		}
+		return
+	}
+	t.Errorf("Expected alice's post among the results, got %+v", results.Items)
+}
+
+func TestPostgresStorePrecomputedSuggestions(t *testing.T) {
+	s := newTestPostgresStore(t)
+	alice := createTestPostgresUser(t, s, "alice")
+	bob := createTestPostgresUser(t, s, "bob")
+	carol := createTestPostgresUser(t, s, "carol")
+	s.CreateFollow(&FollowRequest{UserID: alice.ID, FollowingID: bob.ID})
+	s.CreateFollow(&FollowRequest{UserID: bob.ID, FollowingID: carol.ID})
+
+	// alice's suggestions are precomputed, and there are none yet
+	s.suggestionsThreshold = 0
+	suggestions, err := s.GetSuggestions(alice.ID, maxPageSize)
+	if err != nil {
+		t.Fatalf("GetSuggestions returned an error: %v", err)
+	}
+	if len(suggestions) != 0 {
+		t.Errorf("Expected no suggestions before they're computed, got %+v", suggestions)
+	}
+
+	if err := s.refreshUserSuggestions(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	suggestions, _ = s.GetSuggestions(alice.ID, maxPageSize)
+	if len(suggestions) != 1 || suggestions[0].User.UserID != carol.ID {
+		t.Errorf("Expected carol to be suggested, got %+v", suggestions)
+	}
+}
+
+func TestPostgresStoreRotateSession(t *testing.T) {
+	s := newTestPostgresStore(t)
+	alice := createTestPostgresUser(t, s, "alice")
+	now := time.Now().UTC()
+	session := &Session{
+		ID:             fmt.Sprintf("session%d", now.UnixNano()),
+		UserID:         alice.ID,
+		RefreshToken:   hashRefreshToken("first"),
+		ExpirationTime: now.Add(time.Hour),
+		CreatedAt:      now,
+		LastUsedAt:     now,
+	}
+	if err := s.CreateSession(session); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := s.RotateSession(session.ID, hashRefreshToken("first"), hashRefreshToken("second"), now.Add(time.Hour))
+	if err != nil || !rotated {
+		t.Fatalf("Expected the session to rotate, got %v, %v", rotated, err)
+	}
+
+	// the token it was rotated from still finds it, so a replay can revoke it
+	found, err := s.GetSessionByRefreshToken(hashRefreshToken("first"))
+	if err != nil || found == nil || found.ID != session.ID {
+		t.Fatalf("Expected the previous token to find the session, got %+v, %v", found, err)
+	}
+	if found.RefreshToken != hashRefreshToken("second") || found.PreviousRefreshToken != hashRefreshToken("first") {
+		t.Errorf("Expected the current and previous token hashes, got %+v", found)
+	}
+}
+
+func TestPostgresStoreSwapLegacyFollows(t *testing.T) {
+	s := newTestPostgresStore(t)
+	alice := createTestPostgresUser(t, s, "alice")
+	bob := createTestPostgresUser(t, s, "bob")
+	carol := createTestPostgresUser(t, s, "carol")
+
+	// alice and bob followed each other before migrations existed, and
+	// carol followed bob both then and since
+	_, err := s.db.Exec(`INSERT INTO follows (userID, followerID, created_at) VALUES
+		($1, $2, '2000-01-01'), ($2, $1, '2000-01-01'), ($3, $2, '2000-01-01')`, alice.ID, bob.ID, carol.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFollow(&FollowRequest{UserID: carol.ID, FollowingID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rerunMigration(t, migrator, 26, true)
+
+	following, err := s.GetFollowing(alice.UserName, firstPage)
+	if err != nil || len(following.Items) != 1 || following.Items[0] != bob.UserName {
+		t.Errorf("Expected alice to follow bob, got %+v, %v", following, err)
+	}
+	followers, err := s.GetFollowers(bob.UserName, firstPage)
+	if err != nil || len(followers.Items) != 2 {
+		t.Errorf("Expected alice and carol to follow bob once each, got %+v, %v", followers, err)
+	}
+	following, err = s.GetFollowing(carol.UserName, firstPage)
+	if err != nil || len(following.Items) != 1 || following.Items[0] != bob.UserName {
+		t.Errorf("Expected carol to follow bob, got %+v, %v", following, err)
+	}
+}
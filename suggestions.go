@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// "Who to follow" suggestions are friends of friends: the accounts followed
+// by the people a user follows, ranked by how many of them do. Private
+// accounts and accounts the user already follows, blocked, was blocked by or
+// muted are never suggested.
+//
+// That join grows with the number of accounts a user follows, so for users
+// following more than the precompute threshold a background job computes the
+// suggestions ahead of time into follow_suggestions, and reads only use those:
+// until the job first runs for them, these users get no suggestions. Servers
+// take turns running the job, through a postgres advisory lock, and skip it
+// when another one ran it less than half an interval ago.
+const (
+	defaultSuggestionsPrecomputeThreshold = 1000
+
+	// suggestionsRefreshInterval is how often precomputed suggestions are
+	// recomputed
+	suggestionsRefreshInterval = time.Hour
+
+	// precomputedSuggestions is how many suggestions are kept per user, the
+	// most a page can ask for
+	precomputedSuggestions = maxPageSize
+
+	// suggestionsLockID is the key of the postgres advisory lock held while
+	// refreshing suggestions
+	suggestionsLockID = 4712
+)
+
+// Suggestion is an account a user may want to follow, Mutuals being how many
+// of the accounts they follow already follow it
+type Suggestion struct {
+	User    *UserSummary `json:"user"`
+	Mutuals int          `json:"mutuals"`
+}
+
+// suggestionsPrecomputeThreshold reads SUGGESTIONS_PRECOMPUTE_THRESHOLD, the
+// number of followed accounts above which a user's suggestions are precomputed
+func suggestionsPrecomputeThreshold() int {
+	threshold, err := strconv.Atoi(os.Getenv("SUGGESTIONS_PRECOMPUTE_THRESHOLD"))
+	if err != nil || threshold < 0 {
+		return defaultSuggestionsPrecomputeThreshold
+	}
+	return threshold
+}
+
+// runJob runs job now and then every interval until ctx is done. Failures
+// are logged and retried at the next tick.
+func runJob(ctx context.Context, name string, interval time.Duration, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := job(); err != nil {
+			log.Printf("job %s failed: %v", name, err)
+		} else {
+			log.Printf("job %s done in %v", name, time.Since(start))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunJobStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		runJob(ctx, "test", time.Millisecond, func() error {
+			runs <- struct{}{}
+			return nil
+		})
+		close(done)
+	}()
+
+	<-runs
+	<-runs
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected runJob to return once its context is done")
+	}
+}
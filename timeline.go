@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+// Home timelines are materialized on write: CreatePost pushes the new post
+// into the timeline of every follower, so reading a feed is a single index
+// scan instead of a join over follows and posts.
+//
+// Authors with more followers than the fan-out limit are "celebrities", their
+// posts aren't pushed anywhere and are merged into the feed at read time
+// instead. Whether a post was pushed is recorded on the post itself so feeds
+// stay correct when an author crosses the limit in either direction.
+const (
+	defaultTimelineFanoutLimit = 10000
+
+	// timelineBackfillSize is how many of an account's latest posts are
+	// copied into a new follower's timeline
+	timelineBackfillSize = 200
+)
+
+// timelineFanoutLimit reads TIMELINE_FANOUT_LIMIT, the follower count above
+// which posts are merged into feeds on read rather than fanned out on write
+func timelineFanoutLimit() int {
+	limit, err := strconv.Atoi(os.Getenv("TIMELINE_FANOUT_LIMIT"))
+	if err != nil || limit < 0 {
+		return defaultTimelineFanoutLimit
+	}
+	return limit
+}
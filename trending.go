@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Trending posts are scored by the reactions, comments and reposts or quotes
+// they got over a window, each weighted by how recent it is: an interaction
+// counts half as much every trendingHalfLife. Trending hashtags are the tags
+// used by the most authors over a window, boosted by how much more they were
+// used than over the window before it.
+//
+// Scoring scans every interaction of the window, so a background job computes
+// both for every window and GET /trending reads them from an in-process cache.
+// Posts of private accounts are never trending.
+//
+// Trending isn't a feed, so muting an account doesn't hide its posts there:
+// each viewer only misses the posts of accounts they blocked or were blocked
+// by, and of private accounts they don't follow.
+const (
+	trendingHalfLife      = 6 * time.Hour
+	trendingReactionScore = 1.0
+	trendingCommentScore  = 2.0
+	trendingRepostScore   = 3.0
+
+	// trendingRefreshInterval is how often trending posts and hashtags are
+	// recomputed
+	trendingRefreshInterval = 5 * time.Minute
+	// trendingMaxAge is how old cached results may get, when the job falls
+	// behind, before a request recomputes them
+	trendingMaxAge = 2 * trendingRefreshInterval
+
+	// trendingCacheSize is how many posts and hashtags are cached per window,
+	// the most a response can ask for
+	trendingCacheSize = maxPageSize
+
+	defaultTrendingWindow = "24h"
+)
+
+// trendingWindows are the windows GET /trending accepts, by name
+var trendingWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// PostScore is the trending score of a post
+type PostScore struct {
+	PostID int64
+	Score  float64
+}
+
+// TrendingPost is a trending post and its score
+type TrendingPost struct {
+	Score float64 `json:"score"`
+	Post  *Post   `json:"post"`
+}
+
+// TrendingTag is a trending hashtag, with how many posts and authors used it
+// over the window and how many authors did over the window before it
+type TrendingTag struct {
+	Tag             string  `json:"tag"`
+	Score           float64 `json:"score"`
+	Posts           int     `json:"posts"`
+	Authors         int     `json:"authors"`
+	PreviousAuthors int     `json:"previousAuthors"`
+}
+
+// Trending is what GET /trending returns for a window
+type Trending struct {
+	Window     string          `json:"window"`
+	ComputedAt time.Time       `json:"computedAt"`
+	Posts      []*TrendingPost `json:"posts"`
+	Tags       []*TrendingTag  `json:"tags"`
+}
+
+// trendingWeight is the score an interaction of the given weight that
+// happened age ago adds to a post
+func trendingWeight(weight float64, age time.Duration) float64 {
+	return weight * math.Exp(-math.Ln2*age.Seconds()/trendingHalfLife.Seconds())
+}
+
+// trendingTagScore ranks a hashtag used by authors accounts over a window and
+// previousAuthors over the window before it
+func trendingTagScore(authors, previousAuthors int) float64 {
+	return float64(authors) * float64(authors) / float64(previousAuthors+1)
+}
+
+// sortPostScores orders scores from the highest, newest post first on ties,
+// and keeps up to limit of them
+func sortPostScores(scores []*PostScore, limit int) []*PostScore {
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score == scores[j].Score {
+			return scores[i].PostID > scores[j].PostID
+		}
+		return scores[i].Score > scores[j].Score
+	})
+	if len(scores) > limit {
+		scores = scores[:limit]
+	}
+	return scores
+}
+
+// sortTrendingTags orders tags from the highest score, then by authors and
+// tag, and keeps up to limit of them
+func sortTrendingTags(tags []*TrendingTag, limit int) []*TrendingTag {
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Score != tags[j].Score {
+			return tags[i].Score > tags[j].Score
+		}
+		if tags[i].Authors != tags[j].Authors {
+			return tags[i].Authors > tags[j].Authors
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags
+}
+
+// trendingCache keeps the trending posts and hashtags of every window, keyed
+// by window name
+type trendingCache struct {
+	mu      sync.RWMutex
+	entries map[string]*trendingEntry
+}
+
+type trendingEntry struct {
+	posts      []*PostScore
+	tags       []*TrendingTag
+	computedAt time.Time
+}
+
+func newTrendingCache() *trendingCache {
+	return &trendingCache{entries: map[string]*trendingEntry{}}
+}
+
+func (c *trendingCache) get(window string) (*trendingEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[window]
+	if !ok || time.Since(entry.computedAt) > trendingMaxAge {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (c *trendingCache) set(window string, entry *trendingEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[window] = entry
+}
+
+// computeTrending scores the posts and hashtags of a window
+func computeTrending(store Storage, window time.Duration) (*trendingEntry, error) {
+	now := time.Now().UTC()
+	posts, err := store.ScoreTrendingPosts(now, window, trendingCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := store.ScoreTrendingTags(now, window, trendingCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &trendingEntry{posts: posts, tags: tags, computedAt: now}, nil
+}
+
+// refreshTrending recomputes the trending posts and hashtags of every window
+func (s *ApiServer) refreshTrending() error {
+	for name, window := range trendingWindows {
+		entry, err := computeTrending(s.Store, window)
+		if err != nil {
+			return fmt.Errorf("failed to compute trending over %s: %v", name, err)
+		}
+		s.trending.set(name, entry)
+	}
+	return nil
+}
+
+// getTrending returns the cached trending posts and hashtags of a window,
+// computing them when the cache has none recent enough
+func (s *ApiServer) getTrending(window string) (*trendingEntry, error) {
+	if entry, ok := s.trending.get(window); ok {
+		return entry, nil
+	}
+
+	entry, err := computeTrending(s.Store, trendingWindows[window])
+	if err != nil {
+		return nil, err
+	}
+	s.trending.set(window, entry)
+	return entry, nil
+}
+
+// getTrendingWindow reads the ?window= query param, 24h by default
+func getTrendingWindow(r *http.Request) (string, error) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		return defaultTrendingWindow, nil
+	}
+	if _, ok := trendingWindows[window]; !ok {
+		return "", fmt.Errorf("Invalid window: %v, expected 1h, 24h or 7d", window)
+	}
+	return window, nil
+}
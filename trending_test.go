@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrendingWeight(t *testing.T) {
+	if got := trendingWeight(2, 0); got != 2 {
+		t.Errorf("Expected a fresh interaction to count fully, got %v", got)
+	}
+	if got := trendingWeight(2, trendingHalfLife); math.Abs(got-1) > 1e-9 {
+		t.Errorf("Expected an interaction to count half after a half-life, got %v", got)
+	}
+	if trendingTagScore(4, 0) <= trendingTagScore(4, 3) {
+		t.Error("Expected growing hashtags to score higher")
+	}
+}
+
+func TestScoreTrendingTags(t *testing.T) {
+	store := NewMemoryStore()
+	alice := &User{UserName: "alice"}
+	bob := &User{UserName: "bob"}
+	store.CreateUser(alice)
+	store.CreateUser(bob)
+	now := time.Now().UTC()
+	post := func(userID int64, content string, age time.Duration) {
+		created, err := store.CreatePost(&CreatePostRequest{UserID: userID, Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.posts[created.ID].Created_at = now.Add(-age)
+	}
+	// #go was as popular the hour before, #rust is new
+	post(alice.ID, "#go", 10*time.Minute)
+	post(bob.ID, "#go #rust", 20*time.Minute)
+	post(alice.ID, "#rust again", 30*time.Minute)
+	post(alice.ID, "#go", 70*time.Minute)
+	post(bob.ID, "#go", 80*time.Minute)
+	post(bob.ID, "#old", 3*time.Hour)
+
+	tags, err := store.ScoreTrendingTags(now, time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Tag != "rust" || tags[0].Posts != 2 || tags[0].Authors != 2 ||
+		tags[1].Tag != "go" || tags[1].PreviousAuthors != 2 {
+		t.Fatalf("Expected #rust then #go, got %+v", tags)
+	}
+}
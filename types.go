@@ -8,13 +8,16 @@ import (
 )
 
 type User struct {
-	ID           int64     `json:"id"`
-	UserName     string    `json:"userName"`
-	Name         string    `json:"name"`
-	Email        string    `json:"email"`
-	Bio          string    `json:"bio"`
-	PasswordHash string    `json:"-"`
-	Created_at   time.Time `json:"createdAt"`
+	ID                int64     `json:"id"`
+	UserName          string    `json:"userName"`
+	Name              string    `json:"name"`
+	Email             string    `json:"email"`
+	Bio               string    `json:"bio"`
+	PasswordHash      string    `json:"-"`
+	Created_at        time.Time `json:"createdAt"`
+	AllowMessagesFrom string    `json:"allowMessagesFrom"`
+	HideReadReceipts  bool      `json:"hideReadReceipts"`
+	IsPrivate         bool      `json:"isPrivate"`
 }
 
 type UserProfile struct {
@@ -22,24 +25,67 @@ type UserProfile struct {
 	UserName  string `json:"userName"`
 	Name      string `json:"name"`
 	Bio       string `json:"bio"`
+	IsPrivate bool   `json:"isPrivate"`
 	Posts     int    `json:"posts"`
 	Followers int    `json:"followers"`
 	Following int    `json:"following"`
 }
 
+// UserSummary is the public part of a user listed among others, such as in
+// search results
+type UserSummary struct {
+	UserID    int64  `json:"userID"`
+	UserName  string `json:"userName"`
+	Name      string `json:"name"`
+	Bio       string `json:"bio"`
+	IsPrivate bool   `json:"isPrivate"`
+}
+
 type Post struct {
 	ID         int64     `json:"id"`
 	UserID     int64     `json:"userID"`
 	Content    string    `json:"content"`
 	MediaUrl   string    `json:"mediaUrl"`
 	Created_at time.Time `json:"createdAt"`
+	// a repost shares RepostOfID as is, a quote shares QuoteOfID with the
+	// post's content as commentary. Original is the shared post, missing when
+	// the quoted post was deleted.
+	RepostOfID *int64    `json:"repostOfID,omitempty"`
+	QuoteOfID  *int64    `json:"quoteOfID,omitempty"`
+	Original   *Post     `json:"original,omitempty"`
+	Reposts    int       `json:"reposts"`
+	Reactions  Reactions `json:"reactions"`
+	Mentions   Mentions  `json:"mentions"`
 }
 
 type Comment struct {
+	ID              int64      `json:"id"`
+	Text            string     `json:"text"`
+	UserID          int64      `json:"userID"`
+	PostID          int64      `json:"postID"`
+	Created_at      time.Time  `json:"createdAt"`
+	ParentCommentID *int64     `json:"parentCommentID,omitempty"`
+	Depth           int        `json:"depth"`
+	ReplyCount      int        `json:"replyCount"`
+	Replies         []*Comment `json:"replies,omitempty"`
+	Reactions       Reactions  `json:"reactions"`
+	Mentions        Mentions   `json:"mentions"`
+}
+
+// Bookmark is a post a user saved privately, optionally into one of their
+// collections
+type Bookmark struct {
+	ID           int64     `json:"id"`
+	CollectionID *int64    `json:"collectionID,omitempty"`
+	Created_at   time.Time `json:"createdAt"`
+	Post         *Post     `json:"post"`
+}
+
+type Collection struct {
 	ID         int64     `json:"id"`
-	Text       string    `json:"text"`
 	UserID     int64     `json:"userID"`
-	PostID     int64     `json:"postID"`
+	Name       string    `json:"name"`
+	Bookmarks  int       `json:"bookmarks"`
 	Created_at time.Time `json:"createdAt"`
 }
 
@@ -50,31 +96,112 @@ type Follow struct {
 	Created_at time.Time `json:"createdAt"`
 }
 
+type Conversation struct {
+	ID            int64                 `json:"id"`
+	Kind          string                `json:"kind"`
+	Title         string                `json:"title"`
+	Members       []*ConversationMember `json:"members"`
+	LastMessage   *Message              `json:"lastMessage"`
+	Created_at    time.Time             `json:"createdAt"`
+	LastMessageAt time.Time             `json:"lastMessageAt"`
+}
+
+type ConversationMember struct {
+	UserID            int64      `json:"userID"`
+	UserName          string     `json:"userName"`
+	Role              string     `json:"role"`
+	Joined_at         time.Time  `json:"joinedAt"`
+	LastReadMessageID *int64     `json:"lastReadMessageID,omitempty"`
+	HideReadReceipts  bool       `json:"-"`
+	Online            bool       `json:"online"`
+	LastSeenAt        *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+type Message struct {
+	ID             int64     `json:"id"`
+	ConversationID int64     `json:"conversationID"`
+	UserID         int64     `json:"userID"`
+	Kind           string    `json:"kind"`
+	Content        string    `json:"content"`
+	Created_at     time.Time `json:"createdAt"`
+}
+
+type Notification struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"userID"`
+	ActorID    int64     `json:"actorID"`
+	ActorName  string    `json:"actorName"`
+	Type       string    `json:"type"`
+	PostID     *int64    `json:"postID"`
+	CommentID  *int64    `json:"commentID"`
+	IsRead     bool      `json:"isRead"`
+	Created_at time.Time `json:"createdAt"`
+}
+
+type NotificationGroup struct {
+	Type            string    `json:"type"`
+	PostID          *int64    `json:"postID"`
+	CommentID       *int64    `json:"commentID"`
+	Actors          []string  `json:"actors"`
+	ActorCount      int       `json:"actorCount"`
+	Message         string    `json:"message"`
+	NotificationIDs []int64   `json:"notificationIDs"`
+	IsRead          bool      `json:"isRead"`
+	LatestAt        time.Time `json:"latestAt"`
+}
+
+type NotificationsResponse struct {
+	UnreadCount int                  `json:"unreadCount"`
+	Items       []*NotificationGroup `json:"items"`
+	NextCursor  string               `json:"nextCursor"`
+}
+
 type CreateUserRequest struct {
-	UserName string `json:"userName"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Bio      string `json:"bio"`
-	Password string `json:"password"`
+	UserName          string `json:"userName"`
+	Name              string `json:"name"`
+	Email             string `json:"email"`
+	Bio               string `json:"bio"`
+	Password          string `json:"password"`
+	AllowMessagesFrom string `json:"allowMessagesFrom"`
+	HideReadReceipts  *bool  `json:"hideReadReceipts"`
+	IsPrivate         *bool  `json:"isPrivate"`
 }
 
 type UpdateUserRequest struct {
-	UserName     string `json:"userName"`
-	Name         string `json:"name"`
-	Email        string `json:"email"`
-	Bio          string `json:"bio"`
-	PasswordHash string `json:"passwordHash"`
+	UserName          string `json:"userName"`
+	Name              string `json:"name"`
+	Email             string `json:"email"`
+	Bio               string `json:"bio"`
+	PasswordHash      string `json:"passwordHash"`
+	AllowMessagesFrom string `json:"allowMessagesFrom"`
+	HideReadReceipts  *bool  `json:"hideReadReceipts"`
+	IsPrivate         *bool  `json:"isPrivate"`
 }
 
 type CreatePostRequest struct {
-	UserID   int64  `json:"userID"`
-	Content  string `json:"content"`
-	MediaUrl string `json:"mediaUrl"`
+	UserID     int64  `json:"userID"`
+	Content    string `json:"content"`
+	MediaUrl   string `json:"mediaUrl"`
+	RepostOfID *int64 `json:"-"`
+	QuoteOfID  *int64 `json:"-"`
+}
+
+type BookmarkRequest struct {
+	CollectionID *int64 `json:"collectionID"`
+}
+
+type CollectionRequest struct {
+	Name string `json:"name"`
+}
+
+type ReactionRequest struct {
+	Reaction string `json:"reaction"`
 }
 
 type CreateCommentRequest struct {
-	Text   string `json:"text"`
-	UserID int64  `json:"userID"`
+	Text            string `json:"text"`
+	UserID          int64  `json:"userID"`
+	ParentCommentID *int64 `json:"parentCommentID,omitempty"`
 }
 
 type FollowRequest struct {
@@ -82,23 +209,74 @@ type FollowRequest struct {
 	FollowingID int64 `json:"followingID"`
 }
 
+type CreateConversationRequest struct {
+	UserName string `json:"userName"`
+}
+
+type CreateGroupRequest struct {
+	Title     string   `json:"title"`
+	UserNames []string `json:"userNames"`
+}
+
+type UpdateGroupRequest struct {
+	Title string `json:"title"`
+}
+
+type AddMembersRequest struct {
+	UserNames []string `json:"userNames"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// MarkReadRequest marks a conversation read up to MessageID, or up to its
+// latest message when MessageID is 0
+type MarkReadRequest struct {
+	MessageID int64 `json:"messageID"`
+}
+
+type CreateMessageRequest struct {
+	Content string `json:"content"`
+	UserID  int64  `json:"userID"`
+	// Kind is set by the server, clients can only send text messages
+	Kind string `json:"-"`
+}
+
+type MarkNotificationsReadRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
 type LoginRequest struct {
 	UserName string `json:"userName"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 }
 
 type LoginResponse struct {
-	UserName string `json:"userName"`
-	Token    string `json:"token"`
+	UserName     string `json:"userName"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
 type Session struct {
 	ID             string    `json:"id"`
-	UserID         int       `json:"user_id"`
-	RefreshToken   string    `json:"refresh_token"`
-	ExpirationTime time.Time `json:"expiration_time"`
-	IsBlocked      bool      `json:"id_blocked"`
-	CreatedAt      time.Time `json:"created_at"`
+	UserID         int64     `json:"userID"`
+	RefreshToken   string    `json:"-"` // hash of the current refresh token
+	ExpirationTime time.Time `json:"expirationTime"`
+	IsBlocked      bool      `json:"isBlocked"`
+	CreatedAt      time.Time `json:"createdAt"`
+	Device         string    `json:"device"`
+	IP             string    `json:"ip"`
+	UserAgent      string    `json:"userAgent"`
+	LastUsedAt     time.Time `json:"lastUsedAt"`
+	Current        bool      `json:"current"`
+	// hash of the refresh token the session was last rotated from
+	PreviousRefreshToken string `json:"-"`
 }
 
 func NewUser(req *CreateUserRequest) (*User, error) {
@@ -108,12 +286,40 @@ func NewUser(req *CreateUserRequest) (*User, error) {
 	}
 
 	return &User{
-		ID:           int64(rand.Intn(10000)),
-		UserName:     req.UserName,
-		Name:         req.Name,
-		Email:        req.Email,
-		Bio:          req.Bio,
-		PasswordHash: string(passwordHash),
-		Created_at:   time.Now().UTC(),
+		ID:                int64(rand.Intn(10000)),
+		UserName:          req.UserName,
+		Name:              req.Name,
+		Email:             req.Email,
+		Bio:               req.Bio,
+		PasswordHash:      string(passwordHash),
+		Created_at:        time.Now().UTC(),
+		AllowMessagesFrom: req.AllowMessagesFrom,
+		HideReadReceipts:  req.HideReadReceipts != nil && *req.HideReadReceipts,
+		IsPrivate:         req.IsPrivate != nil && *req.IsPrivate,
 	}, nil
 }
+
+// NewSession returns a new session of userID and its refresh token, the
+// session only holding the token's hash
+func NewSession(userID int64) (*Session, string, error) {
+	id, err := generateRandomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+
+	refreshToken, err := generateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	return &Session{
+		ID:             id,
+		UserID:         userID,
+		RefreshToken:   hashRefreshToken(refreshToken),
+		ExpirationTime: now.Add(refreshTokenTTL),
+		IsBlocked:      false,
+		CreatedAt:      now,
+		LastUsedAt:     now,
+	}, refreshToken, nil
+}
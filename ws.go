@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait is how long a single write to a client may take
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long a client may go without answering a ping
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod must be shorter than wsPongWait so a pong can arrive in time
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsMaxMessageSize limits what clients may send, they only ever send
+	// control frames
+	wsMaxMessageSize = 512
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// clients authenticate with a token rather than cookies, so cross-origin
+	// connections can't act on a user's behalf
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// handleWebSocket upgrades the request and streams the authenticated user's
+// events until either side closes the connection
+func (s *ApiServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	sub, _, err := s.subscribe(getAuthUserID(r), 0)
+	if err != nil {
+		WriteJson(w, http.StatusTooManyRequests, ApiError{Error: err.Error()})
+		return
+	}
+	defer s.unsubscribe(sub)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	go readWebSocket(conn, sub)
+	s.writeWebSocket(conn, sub, getAuthSessionID(r))
+}
+
+// readWebSocket discards anything the client sends, keeping the read deadline
+// alive on pongs, and ends the subscription when the connection goes away
+func readWebSocket(conn *websocket.Conn, sub *Subscriber) {
+	defer sub.close()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writeWebSocket writes events to the client and pings it periodically. The
+// session is checked on every ping so logging out or revoking it closes the
+// connection too.
+func (s *ApiServer) writeWebSocket(conn *websocket.Conn, sub *Subscriber, sessionID string) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-sub.Events:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			if !s.sessionActive(sessionID) {
+				closeWebSocket(conn, websocket.ClosePolicyViolation, "session ended")
+				return
+			}
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+
+		case <-sub.Done():
+			switch sub.Err() {
+			case errTooSlow:
+				closeWebSocket(conn, websocket.CloseTryAgainLater, errTooSlow.Error())
+			case errServerShutdown:
+				closeWebSocket(conn, websocket.CloseGoingAway, errServerShutdown.Error())
+			default:
+				closeWebSocket(conn, websocket.CloseNormalClosure, "")
+			}
+			return
+		}
+	}
+}
+
+func closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+}
+
+// sessionActive reports whether a session is still usable, for long-lived
+// connections that outlive the access token they were opened with
+func (s *ApiServer) sessionActive(sessionID string) bool {
+	session, err := s.Store.GetSession(sessionID)
+	if err != nil || session == nil {
+		return false
+	}
+	return !session.IsBlocked && time.Now().Before(session.ExpirationTime)
+}
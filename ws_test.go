@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWebSocket(t *testing.T, server *httptest.Server, token string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + token
+	conn, res, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, res, err
+}
+
+// expectEvents reads the next events from conn and checks their types
+func expectEvents(t *testing.T, conn *websocket.Conn, types ...string) {
+	t.Helper()
+
+	for _, eventType := range types {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		event := new(Event)
+		if err := conn.ReadJSON(event); err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		if event.Type != eventType {
+			t.Errorf("Expected %s, got %s", eventType, event.Type)
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	server, store := newTestServer(t)
+	alice, aliceAuth := signUp(t, server, "alice")
+	_, bobAuth := signUp(t, server, "bob")
+
+	if _, res, err := dialWebSocket(t, server, "invalid"); err == nil || res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected an invalid token to be rejected, got %v", err)
+	}
+
+	conn, _, err := dialWebSocket(t, server, aliceAuth.Token)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	post, _ := store.CreatePost(&CreatePostRequest{UserID: alice.ID, Content: "hello"})
+	postPath := fmt.Sprintf("/posts/%d", post.ID)
+
+	res := doRequest(t, server, http.MethodPost, postPath+"/like", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	expectEvents(t, conn, EventPostLiked, EventNotification)
+
+	res = doRequest(t, server, http.MethodPost, postPath+"/comments", bobAuth.Token, CreateCommentRequest{Text: "nice"})
+	expectStatus(t, res, http.StatusCreated)
+	expectEvents(t, conn, EventCommentCreated, EventNotification)
+
+	res = doRequest(t, server, http.MethodPost, "/bob/follow", bobAuth.Token, FollowRequest{FollowingID: alice.ID})
+	expectStatus(t, res, http.StatusOK)
+	expectEvents(t, conn, EventUserFollowed, EventNotification)
+
+	// bob now follows alice so her new posts reach him
+	bobConn, _, err := dialWebSocket(t, server, bobAuth.Token)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	res = doRequest(t, server, http.MethodPost, "/alice/posts", aliceAuth.Token, CreatePostRequest{Content: "second"})
+	expectStatus(t, res, http.StatusCreated)
+	expectEvents(t, conn, EventPostCreated)
+	expectEvents(t, bobConn, EventPostCreated)
+}
+
+func TestWebSocketConnectionLimit(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, aliceAuth := signUp(t, server, "alice")
+
+	for i := 0; i < maxConnectionsPerUser; i++ {
+		if _, _, err := dialWebSocket(t, server, aliceAuth.Token); err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+	}
+
+	_, res, err := dialWebSocket(t, server, aliceAuth.Token)
+	if err == nil || res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected connection %d to be rejected, got %v", maxConnectionsPerUser+1, err)
+	}
+}
+
+func TestWebSocketServerShutdown(t *testing.T) {
+	api := NewApiServer("", NewMemoryStore())
+	server := httptest.NewServer(api.Router())
+	t.Cleanup(server.Close)
+	_, aliceAuth := signUp(t, server, "alice")
+
+	conn, _, err := dialWebSocket(t, server, aliceAuth.Token)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	// the hook Run registers on the http.Server
+	api.Hub.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected the connection to be closed as going away, got %v", err)
+	}
+}
+
+func TestConversationPresence(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, aliceAuth := signUp(t, server, "alice")
+	bob, bobAuth := signUp(t, server, "bob")
+
+	res := doRequest(t, server, http.MethodPost, "/conversations", aliceAuth.Token, CreateConversationRequest{UserName: "bob"})
+	expectStatus(t, res, http.StatusOK)
+	conversation := new(Conversation)
+	decodeBody(t, res, conversation)
+	conversationPath := fmt.Sprintf("/conversations/%d", conversation.ID)
+
+	conn, _, err := dialWebSocket(t, server, aliceAuth.Token)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	bobConn, _, err := dialWebSocket(t, server, bobAuth.Token)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	expectEvents(t, conn, EventPresence)
+
+	res = doRequest(t, server, http.MethodPost, conversationPath+"/typing", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	expectEvents(t, conn, EventTyping)
+
+	res = doRequest(t, server, http.MethodPost, conversationPath+"/messages", aliceAuth.Token, CreateMessageRequest{Content: "hi"})
+	expectStatus(t, res, http.StatusOK)
+	message := new(Message)
+	decodeBody(t, res, message)
+	expectEvents(t, conn, EventMessageCreated)
+
+	res = doRequest(t, server, http.MethodPost, conversationPath+"/read", bobAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	expectEvents(t, conn, EventConversationRead)
+
+	res = doRequest(t, server, http.MethodGet, conversationPath, aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	decodeBody(t, res, conversation)
+	for _, member := range conversation.Members {
+		if member.LastReadMessageID == nil || *member.LastReadMessageID != message.ID || !member.Online {
+			t.Errorf("Expected %s to be online and to have read message %d, got %+v", member.UserName, message.ID, member)
+		}
+	}
+
+	// once bob hides his read receipts alice can't see how far he has read
+	hide := true
+	res = doRequest(t, server, http.MethodPatch, "/bob", bobAuth.Token, CreateUserRequest{HideReadReceipts: &hide})
+	expectStatus(t, res, http.StatusOK)
+	res = doRequest(t, server, http.MethodGet, conversationPath, aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+	conversation = new(Conversation)
+	decodeBody(t, res, conversation)
+	for _, member := range conversation.Members {
+		if member.UserID == bob.ID && member.LastReadMessageID != nil {
+			t.Errorf("Expected bob's read receipt to be hidden, got %+v", member)
+		}
+	}
+
+	bobConn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	event := new(Event)
+	if err := conn.ReadJSON(event); err != nil {
+		t.Fatalf("failed to read event: %v", err)
+	}
+	presence, _ := event.Data.(map[string]any)
+	if event.Type != EventPresence || presence["online"] != false || presence["lastSeenAt"] == nil {
+		t.Errorf("Expected bob to go offline, got %+v", event)
+	}
+}
+
+func TestConversationPresenceBlocked(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, aliceAuth := signUp(t, server, "alice")
+	_, bobAuth := signUp(t, server, "bob")
+
+	res := doRequest(t, server, http.MethodPost, "/conversations", aliceAuth.Token, CreateConversationRequest{UserName: "bob"})
+	expectStatus(t, res, http.StatusOK)
+	conversation := new(Conversation)
+	decodeBody(t, res, conversation)
+
+	conn, _, err := dialWebSocket(t, server, aliceAuth.Token)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	res = doRequest(t, server, http.MethodPost, "/bob/block", aliceAuth.Token, nil)
+	expectStatus(t, res, http.StatusOK)
+
+	// bob coming online, typing and going offline isn't pushed to alice
+	bobConn, _, err := dialWebSocket(t, server, bobAuth.Token)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	doRequest(t, server, http.MethodPost, fmt.Sprintf("/conversations/%d/typing", conversation.ID), bobAuth.Token, nil)
+	bobConn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	event := new(Event)
+	if err := conn.ReadJSON(event); err == nil {
+		t.Errorf("Expected no events about bob, got %+v", event)
+	}
+}